@@ -5,17 +5,30 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
+	"url-shortener/internal/applinks"
 	"url-shortener/internal/config"
 	"url-shortener/internal/handlers"
+	"url-shortener/internal/logging"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/migrate"
+	"url-shortener/internal/repository"
 	"url-shortener/internal/repository/cache"
 	"url-shortener/internal/repository/postgres"
+	"url-shortener/internal/safety"
 	"url-shortener/internal/service"
+	"url-shortener/internal/tracing"
+	"url-shortener/migrations"
 
 	_ "github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
@@ -26,8 +39,31 @@ import (
 func main() {
 	// 1. Загрузка конфигурации
 	cfg := config.LoadConfig()
+	logLevel, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("Invalid LOG_LEVEL: %v", err)
+	}
+	logging.Setup(os.Stdout, logLevel)
 	log.Println("Configuration loaded")
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(cfg, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "owner-token" {
+		runOwnerToken(cfg, os.Args[2:])
+		return
+	}
+
+	shutdownTracing, err := tracing.Init(context.Background(), tracing.Config{
+		Exporter:    cfg.TracingExporter,
+		ServiceName: cfg.TracingServiceName,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
 	// 2. Инициализация PostgreSQL
 	db, err := initPostgres(cfg)
 	if err != nil {
@@ -36,40 +72,209 @@ func main() {
 	defer db.Close()
 	log.Println("PostgreSQL connected")
 
+	if cfg.MigrateOnStart {
+		migrator, err := migrate.New(db, migrations.FS, migrations.Go(canonicalizer(cfg))...)
+		if err != nil {
+			log.Fatalf("Failed to load migrations: %v", err)
+		}
+		if err := migrateUp(context.Background(), migrator); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+	}
+
+	replicas := postgres.NewDBRouter(db, initReplicas(cfg), postgres.RouterConfig{
+		HealthInterval: cfg.ReplicaHealthInterval,
+		HealthTimeout:  cfg.ReplicaHealthTimeout,
+		MaxLag:         cfg.ReplicaMaxLag,
+	})
+	replicas.CheckReplicas(context.Background())
+	replicas.Start()
+
 	// 3. Инициализация Redis
 	redisClient := initRedis(cfg)
 	defer redisClient.Close()
-	log.Println("Redis connected")
 
 	// 4. Инициализация репозиториев
-	urlRepo := postgres.NewPostgresURLRepo(db)
-	clickRepo := postgres.NewPostgresClickRepo(db)
-	cacheRepo := cache.NewCacheRepository(redisClient)
+	urlRepo := postgres.NewPostgresURLRepo(db, replicas)
+	clickRepo := postgres.NewPostgresClickRepo(db, replicas)
+	variantRepo := postgres.NewPostgresVariantRepo(db)
+	scheduleRepo := postgres.NewPostgresScheduleRepo(db)
+	auditRepo := postgres.NewPostgresAuditRepo(db)
+	healthRepo := postgres.NewPostgresHealthRepo(db)
+	webhookRepo := postgres.NewPostgresWebhookRepo(db)
+	domainRepo := postgres.NewPostgresDomainRepo(db)
+	alertRepo := postgres.NewPostgresAlertRepo(db)
+	txManager := postgres.NewTxManager(db)
+	redisCache := cache.NewCacheRepository(redisClient, cache.NewBreaker(cfg.CacheBreakerThreshold, cfg.CacheBreakerCooldown))
+	var cacheRepo repository.CacheRepository = redisCache
+	var localCache *cache.TieredCache
+	if cfg.LocalCacheSize > 0 {
+		localCache = cache.NewTieredCache(redisCache, cache.NewLocalCache(cfg.LocalCacheSize), cfg.LocalCacheTTL)
+		localCache.Start()
+		metrics.RegisterLocalCache(localCache.Len)
+		cacheRepo = localCache
+	}
+	// Промах кэша читает ссылку с реплики, которая могла еще не получить изменение. Реплика
+	// может отстать сильнее MaxLag и обслуживать чтения до следующей проверки.
+	var delayedInvalidation *cache.DelayedInvalidation
+	if len(cfg.DBReplicaHosts) > 0 && cfg.ReplicaMaxLag > 0 {
+		delay := cfg.ReplicaMaxLag + cfg.ReplicaHealthInterval + cfg.ReplicaHealthTimeout
+		delayedInvalidation = cache.NewDelayedInvalidation(cacheRepo, delay)
+		cacheRepo = delayedInvalidation
+	}
 
-	// 5. Инициализация сервисов
-	urlService := service.NewURLService(urlRepo, cacheRepo)
+	// 5. Инициализация проверки безопасности ссылок
+	checker, err := initSafetyChecker(cfg)
+	if err != nil {
+		log.Fatalf("Failed to init safety checker: %v", err)
+	}
+
+	// 6. Инициализация сервисов
+	domainService := service.NewDomainService(domainRepo, redisCache, nil, cfg.DefaultDomain, cfg.ShortURLScheme, cfg.DomainRefreshInterval)
+	if err := domainService.Refresh(context.Background()); err != nil {
+		log.Fatalf("Failed to load domains: %v", err)
+	}
+	domainService.Start()
+	webhookService := service.NewWebhookService(webhookRepo, urlRepo, checker, nil, service.WebhookConfig{
+		PollInterval: cfg.WebhookPollInterval,
+		Timeout:      cfg.WebhookTimeout,
+		MaxAttempts:  cfg.WebhookMaxAttempts,
+		BaseBackoff:  30 * time.Second,
+		MaxBackoff:   6 * time.Hour,
+	})
+	webhookService.Start()
+	var codeFilter *service.CodeFilter
+	if cfg.CodeFilterEnabled {
+		codeFilter = service.NewCodeFilter(urlRepo, redisCache, service.CodeFilterConfig{
+			FalsePositiveRate: cfg.CodeFilterFPRate,
+			SyncInterval:      cfg.CodeFilterSyncInterval,
+			RebuildInterval:   cfg.CodeFilterRebuildInterval,
+		})
+		if err := codeFilter.Load(context.Background()); err != nil {
+			log.Fatalf("Failed to load short code filter: %v", err)
+		}
+		codeFilter.Start()
+	}
+	urlService := service.NewURLService(urlRepo, cacheRepo, variantRepo, scheduleRepo, auditRepo, txManager, checker, canonicalizer(cfg), webhookService, domainService, service.CachePolicy{
+		NotFoundTTL:      cfg.CacheNotFoundTTL,
+		EarlyRefreshBeta: cfg.CacheEarlyRefreshBeta,
+	}, codeFilter)
 	analyticsService := service.NewAnalyticsService(clickRepo, urlRepo)
-	workerService := service.NewWorkerService(analyticsService, 5) // 5 воркеров
+	workerService := service.NewWorkerService(analyticsService, webhookService, 5) // 5 воркеров
+
+	metrics.RegisterDB(db, "postgres")
+	for _, replica := range replicas.Replicas() {
+		metrics.RegisterDB(replica.DB, replica.Name)
+	}
+	metrics.RegisterQueue(workerService.QueueDepth, workerService.QueueCapacity)
+
+	readiness := service.NewReadiness(cfg.ReadinessTimeout)
+	readiness.AddCheck("postgres", db.PingContext)
+	readiness.AddOptionalCheck("redis", func(ctx context.Context) error {
+		return redisClient.Ping(ctx).Err()
+	})
+	readiness.AddCheck("click_queue", workerService.CheckQueue)
+
+	safetyScanner := service.NewSafetyScanner(urlRepo, variantRepo, scheduleRepo, cacheRepo, auditRepo, txManager, checker, cfg.SafetyRecheckInterval)
+	safetyScanner.Start()
+	healthChecker := service.NewHealthChecker(urlRepo, healthRepo, nil, service.HealthCheckerConfig{
+		Interval:    cfg.HealthCheckInterval,
+		Concurrency: cfg.HealthCheckConcurrency,
+		HostDelay:   cfg.HealthCheckHostDelay,
+		Timeout:     cfg.HealthCheckTimeout,
+	})
+	healthChecker.Start()
+	expiryWatcher := service.NewExpiryWatcher(urlRepo, cacheRepo, txManager, webhookService, cfg.ExpiryCheckInterval)
+	expiryWatcher.Start()
+	anomalyDetector := service.NewAnomalyDetector(clickRepo, urlRepo, alertRepo, cacheRepo, auditRepo, txManager, webhookService, service.AnomalyConfig{
+		Interval:        cfg.AnomalyInterval,
+		Window:          cfg.AnomalyWindow,
+		BaselineWindows: cfg.AnomalyBaselineWindows,
+		ZThreshold:      cfg.AnomalyZThreshold,
+		MinClicks:       cfg.AnomalyMinClicks,
+		MinBaseline:     cfg.AnomalyMinBaseline,
+		AbuseThreshold:  cfg.AnomalyAbuseThreshold,
+	})
+	anomalyDetector.Start()
 
-	// 6. Инициализация хендлеров
-	urlHandler := handlers.NewURLHandler(urlService, workerService)
+	// 7. Инициализация хендлеров
+	fallbackPages := handlers.NewFallbackPages(cfg.FallbackTemplateDir)
+	urlHandler := handlers.NewURLHandler(urlService, workerService, domainService, fallbackPages)
 	analyticsHandler := handlers.NewAnalyticsHandler(analyticsService)
 
-	// 7. Настройка роутинга с middleware
+	qrLogo, err := loadQRLogo(cfg.QRLogoFile)
+	if err != nil {
+		log.Fatalf("Failed to load QR logo: %v", err)
+	}
+	qrHandler := handlers.NewQRHandler(urlService, domainService, qrLogo)
+	healthHandler := handlers.NewHealthHandler(urlService, healthChecker)
+	webhookHandler := handlers.NewWebhookHandler(webhookService)
+	domainHandler := handlers.NewDomainHandler(domainService, fallbackPages)
+	alertHandler := handlers.NewAlertHandler(anomalyDetector)
+
+	appLinks, err := applinks.Load(cfg.AppLinksFile)
+	if err != nil {
+		log.Fatalf("Failed to load app links: %v", err)
+	}
+	log.Printf("App links configured for %d hosts", appLinks.Len())
+	appLinksHandler := handlers.NewAppLinksHandler(appLinks)
+	probeHandler := handlers.NewProbeHandler(readiness)
+
+	// 8. Настройка роутинга с middleware
 	router := mux.NewRouter()
+	router.Use(handlers.RequestIDMiddleware)
+	router.Use(handlers.TracingMiddleware)
 	router.Use(handlers.LoggingMiddleware)
+	router.Use(handlers.MetricsMiddleware)
 	router.Use(handlers.RecoveryMiddleware)
 	router.Use(handlers.CORSMiddleware)
+	router.Use(handlers.OwnerAuthMiddleware(cfg.OwnerTokenSecret, cfg.TrustOwnerHeader))
 
 	// API endpoints
 	router.HandleFunc("/api/v1/urls", urlHandler.CreateShortURL).Methods("POST")
 	router.HandleFunc("/api/v1/urls/{shortCode}", urlHandler.GetURLInfo).Methods("GET")
+	router.HandleFunc("/api/v1/urls/{shortCode}", urlHandler.UpdateURL).Methods("PATCH")
+	router.HandleFunc("/api/v1/urls/{shortCode}", urlHandler.DeleteURL).Methods("DELETE")
+	router.HandleFunc("/api/v1/urls/{shortCode}/disable", urlHandler.DisableURL).Methods("POST")
+	router.HandleFunc("/api/v1/urls/{shortCode}/enable", urlHandler.EnableURL).Methods("POST")
+	router.HandleFunc("/api/v1/urls/{shortCode}/audit", urlHandler.GetAuditLog).Methods("GET")
+	router.HandleFunc("/api/v1/urls/{shortCode}/qr", qrHandler.GetQRCode).Methods("GET")
+	router.HandleFunc("/api/v1/urls/{shortCode}/preview", urlHandler.SetPreview).Methods("PUT")
+	router.HandleFunc("/api/v1/urls/{shortCode}/deep-links", urlHandler.SetDeepLinks).Methods("PUT")
+	router.HandleFunc("/api/v1/urls/{shortCode}/passthrough", urlHandler.SetPassthrough).Methods("PUT")
+	router.HandleFunc("/api/v1/urls/{shortCode}/schedule", urlHandler.SetSchedule).Methods("PUT")
+	router.HandleFunc("/api/v1/urls/{shortCode}/health", healthHandler.GetURLHealth).Methods("GET")
+	router.HandleFunc("/api/v1/broken-links", healthHandler.ListBrokenLinks).Methods("GET")
+	router.HandleFunc("/api/v1/alerts", alertHandler.ListAlerts).Methods("GET")
+	router.HandleFunc("/api/v1/domains", domainHandler.CreateDomain).Methods("POST")
+	router.HandleFunc("/api/v1/domains", domainHandler.ListDomains).Methods("GET")
+	router.HandleFunc("/api/v1/domains/{hostname}", domainHandler.DeleteDomain).Methods("DELETE")
+	router.HandleFunc("/api/v1/domains/{hostname}/verify", domainHandler.VerifyDomain).Methods("POST")
+	router.HandleFunc("/api/v1/domains/{hostname}/fallback", domainHandler.SetFallback).Methods("PUT")
+	router.HandleFunc("/api/v1/webhooks", webhookHandler.CreateWebhook).Methods("POST")
+	router.HandleFunc("/api/v1/webhooks", webhookHandler.ListWebhooks).Methods("GET")
+	router.HandleFunc("/api/v1/webhooks/{id}", webhookHandler.DeleteWebhook).Methods("DELETE")
+	router.HandleFunc("/api/v1/webhooks/{id}/deliveries", webhookHandler.ListDeliveries).Methods("GET")
+	router.HandleFunc("/api/v1/webhooks/{id}/deliveries/{deliveryID}/attempts", webhookHandler.ListAttempts).Methods("GET")
+	router.HandleFunc("/api/v1/webhooks/{id}/deliveries/{deliveryID}/replay", webhookHandler.ReplayDelivery).Methods("POST")
+	router.HandleFunc("/api/v1/urls/{shortCode}/variants", urlHandler.SetVariants).Methods("PUT")
 	router.HandleFunc("/api/v1/analytics/{shortCode}", analyticsHandler.GetAnalytics).Methods("GET")
 
-	// Redirect endpoint
-	router.HandleFunc("/{shortCode}", urlHandler.Redirect)
+	// Проверки живости и готовности
+	router.HandleFunc("/livez", probeHandler.Livez).Methods("GET")
+	router.HandleFunc("/readyz", probeHandler.Readyz).Methods("GET")
+
+	// Ассоциация доменов с мобильными приложениями
+	router.HandleFunc("/.well-known/apple-app-site-association", appLinksHandler.AppleAppSiteAssociation).Methods("GET")
+	router.HandleFunc("/apple-app-site-association", appLinksHandler.AppleAppSiteAssociation).Methods("GET")
+	router.HandleFunc("/.well-known/assetlinks.json", appLinksHandler.AssetLinks).Methods("GET")
 
-	// 8. Настройка HTTP сервера
+	// Redirect endpoint. Пути /api/ сюда не попадают, чтобы опечатка в адресе API
+	// или неверный метод не превращались в поиск короткой ссылки.
+	router.HandleFunc("/{shortCode}", urlHandler.Redirect).Methods("GET", "HEAD")
+	router.HandleFunc("/{shortCode}/{rest:.*}", urlHandler.Redirect).Methods("GET", "HEAD").MatcherFunc(notAPIPath)
+
+	// 9. Настройка HTTP сервера
 	server := &http.Server{
 		Addr:         ":" + cfg.ServerPort,
 		Handler:      router,
@@ -78,13 +283,29 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	// 9. Graceful shutdown
+	// Метрики Prometheus отдаются на отдельном порту, который не публикуется наружу
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("GET /metrics", metrics.Handler())
+	metricsServer := &http.Server{
+		Addr:         ":" + cfg.MetricsPort,
+		Handler:      metricsMux,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+	}
+
+	// 10. Graceful shutdown
 	go func() {
 		log.Printf("Server starting on port %s", cfg.ServerPort)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server failed: %v", err)
 		}
 	}()
+	go func() {
+		log.Printf("Metrics server starting on port %s", cfg.MetricsPort)
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Metrics server failed: %v", err)
+		}
+	}()
 
 	// Ожидание сигнала для graceful shutdown
 	quit := make(chan os.Signal, 1)
@@ -92,24 +313,54 @@ func main() {
 	<-quit
 	log.Println("Shutting down server...")
 
-	// Graceful shutdown воркеров
-	workerService.Shutdown()
+	// /readyz сразу начинает отвечать 503, балансировщику дается время вывести экземпляр из ротации
+	readiness.SetDraining()
+	time.Sleep(cfg.ShutdownDrainDelay)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// Сервер останавливается первым, чтобы обработчики не писали в закрытую очередь кликов
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+	if err := metricsServer.Shutdown(ctx); err != nil {
+		log.Printf("Metrics server forced to shutdown: %v", err)
+	}
+
+	// Graceful shutdown воркеров
+	workerService.Shutdown()
+	safetyScanner.Shutdown()
+	healthChecker.Shutdown()
+	expiryWatcher.Shutdown()
+	anomalyDetector.Shutdown()
+	webhookService.Shutdown()
+	domainService.Shutdown()
+	if codeFilter != nil {
+		codeFilter.Shutdown()
+	}
+	if delayedInvalidation != nil {
+		delayedInvalidation.Shutdown()
+	}
+	if localCache != nil {
+		localCache.Shutdown()
+	}
+	replicas.Shutdown()
+
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
 
 	log.Println("Server exited")
 }
 
-func initPostgres(cfg *config.Config) (*sql.DB, error) {
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPassword, cfg.DBName)
+// notAPIPath отсекает пути API от маршрута редиректа
+func notAPIPath(r *http.Request, _ *mux.RouteMatch) bool {
+	return !strings.HasPrefix(r.URL.Path, "/api/")
+}
 
-	db, err := sql.Open("postgres", connStr)
+func initPostgres(cfg *config.Config) (*sql.DB, error) {
+	db, err := openPostgres(cfg, cfg.DBHost, cfg.DBPort)
 	if err != nil {
 		return nil, err
 	}
@@ -118,6 +369,37 @@ func initPostgres(cfg *config.Config) (*sql.DB, error) {
 		return nil, err
 	}
 
+	return db, nil
+}
+
+// initReplicas открывает пулы соединений с репликами. Недоступная реплика не мешает
+// запуску: маршрутизатор не отправит на нее запросы, пока она не пройдет проверку.
+func initReplicas(cfg *config.Config) []postgres.Replica {
+	var replicas []postgres.Replica
+	for _, addr := range cfg.DBReplicaHosts {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			host, port = addr, cfg.DBPort
+		}
+
+		db, err := openPostgres(cfg, host, port)
+		if err != nil {
+			log.Fatalf("Invalid PostgreSQL replica %q: %v", addr, err)
+		}
+		replicas = append(replicas, postgres.Replica{Name: net.JoinHostPort(host, port), DB: db})
+	}
+	return replicas
+}
+
+func openPostgres(cfg *config.Config, host, port string) (*sql.DB, error) {
+	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		host, port, cfg.DBUser, cfg.DBPassword, cfg.DBName)
+
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, err
+	}
+
 	db.SetMaxOpenConns(25)
 	db.SetMaxIdleConns(25)
 	db.SetConnMaxLifetime(5 * time.Minute)
@@ -125,15 +407,81 @@ func initPostgres(cfg *config.Config) (*sql.DB, error) {
 	return db, nil
 }
 
+// runOwnerToken печатает токен владельца для заголовка Authorization: Bearer
+func runOwnerToken(cfg *config.Config, args []string) {
+	if len(args) != 1 || args[0] == "" {
+		log.Fatal("usage: url-shortener owner-token <owner-id>")
+	}
+	if cfg.OwnerTokenSecret == "" {
+		log.Fatal("OWNER_TOKEN_SECRET is not set")
+	}
+	fmt.Println(handlers.SignOwnerToken(cfg.OwnerTokenSecret, args[0]))
+}
+
+// canonicalizer используется и сервисом, и миграцией, пересчитывающей каноническую форму старых ссылок
+func canonicalizer(cfg *config.Config) service.Canonicalizer {
+	return service.Canonicalizer{StripTracking: cfg.StripTrackingParams}
+}
+
+func initSafetyChecker(cfg *config.Config) (safety.Checker, error) {
+	deny, err := safety.LoadDomainList(cfg.SafetyDenylistFile)
+	if err != nil {
+		return nil, err
+	}
+
+	allow, err := safety.LoadDomainList(cfg.SafetyAllowlistFile)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Safety checker: %d denylisted, %d allowlisted domains", deny.Len(), allow.Len())
+
+	return safety.NewChain(
+		allow,
+		safety.NewDenylistChecker(deny),
+		safety.NewPrivateNetworkChecker(nil),
+	), nil
+}
+
+// loadQRLogo загружает логотип для центра QR-кодов. Пустой путь означает, что логотипа нет.
+func loadQRLogo(path string) (image.Image, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	logo, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return logo, nil
+}
+
+// initRedis создает клиент Redis. Недоступный Redis не мешает запуску: сервис работает
+// без кэша, а клиент переподключается сам, когда Redis снова поднимется.
 func initRedis(cfg *config.Config) *redis.Client {
 	client := redis.NewClient(&redis.Options{
-		Addr:     cfg.RedisAddr,
-		Password: "",
-		DB:       0,
+		Addr:         cfg.RedisAddr,
+		Password:     "",
+		DB:           0,
+		DialTimeout:  cfg.RedisTimeout,
+		ReadTimeout:  cfg.RedisTimeout,
+		WriteTimeout: cfg.RedisTimeout,
+		MaxRetries:   1,
 	})
 
-	if err := client.Ping(context.Background()).Err(); err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.RedisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Printf("Redis is unavailable, starting without cache: %v", err)
+	} else {
+		log.Println("Redis connected")
 	}
 
 	return client
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"url-shortener/internal/config"
+	"url-shortener/internal/migrate"
+	"url-shortener/migrations"
+)
+
+const migrateUsage = "usage: url-shortener migrate up|down|status|baseline <version>"
+
+// runMigrate выполняет подкоманду migrate и завершает процесс
+func runMigrate(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	db, err := initPostgres(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to PostgreSQL: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db, migrations.FS, migrations.Go(canonicalizer(cfg))...)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		err = migrateUp(ctx, migrator)
+	case "down":
+		var migration *migrate.Migration
+		migration, err = migrator.Down(ctx)
+		if err == nil {
+			log.Printf("Rolled back migration %d_%s", migration.Version, migration.Name)
+		}
+	case "status":
+		var statuses []migrate.Status
+		statuses, err = migrator.Status(ctx)
+		if err == nil {
+			printStatus(statuses)
+		}
+	case "baseline":
+		if len(args) != 2 {
+			log.Fatal(migrateUsage)
+		}
+		var version int64
+		version, err = strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid version %q: %v", args[1], err)
+		}
+		var marked int
+		marked, err = migrator.Baseline(ctx, version)
+		if err == nil {
+			log.Printf("Marked %d migrations up to %d as applied", marked, version)
+		}
+	default:
+		log.Fatal(migrateUsage)
+	}
+
+	if err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+}
+
+// migrateUp применяет непримененные миграции, используется подкомандой и при старте сервера
+func migrateUp(ctx context.Context, migrator *migrate.Migrator) error {
+	done, err := migrator.Up(ctx)
+	for _, migration := range done {
+		log.Printf("Applied migration %d_%s", migration.Version, migration.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(done) == 0 {
+		log.Println("Database schema is up to date")
+	}
+	return nil
+}
+
+func printStatus(statuses []migrate.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+	}
+	w.Flush()
+}
@@ -0,0 +1,140 @@
+// Package applinks строит файлы ассоциации доменов с мобильными приложениями:
+// apple-app-site-association для Universal Links и assetlinks.json для Android App Links.
+package applinks
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultHost - ключ настроек, которые применяются к доменам без собственной записи
+const DefaultHost = "*"
+
+// AppleApp - приложение iOS, которому разрешено открывать ссылки домена
+type AppleApp struct {
+	AppID string   `json:"app_id"` // TEAMID.bundle.id
+	Paths []string `json:"paths"`  // Шаблоны путей, пустой список - все пути
+}
+
+// AndroidApp - приложение Android и отпечатки сертификатов его подписи
+type AndroidApp struct {
+	PackageName  string   `json:"package_name"`
+	Fingerprints []string `json:"sha256_cert_fingerprints"`
+}
+
+// HostConfig - приложения, привязанные к одному домену
+type HostConfig struct {
+	Apple   []AppleApp   `json:"apple"`
+	Android []AndroidApp `json:"android"`
+}
+
+// Config сопоставляет имя хоста его приложениям
+type Config struct {
+	hosts map[string]HostConfig
+}
+
+// Load читает настройки из JSON файла вида {"go.acme.com": {...}, "*": {...}}.
+// Пустой путь дает пустые настройки.
+func Load(path string) (*Config, error) {
+	c := &Config{hosts: make(map[string]HostConfig)}
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read app links config: %w", err)
+	}
+
+	var hosts map[string]HostConfig
+	if err := json.Unmarshal(data, &hosts); err != nil {
+		return nil, fmt.Errorf("failed to parse app links config: %w", err)
+	}
+
+	for host, cfg := range hosts {
+		c.hosts[strings.ToLower(host)] = cfg
+	}
+
+	return c, nil
+}
+
+// Len возвращает число доменов с настройками
+func (c *Config) Len() int {
+	return len(c.hosts)
+}
+
+// lookup возвращает настройки хоста или настройки по умолчанию
+func (c *Config) lookup(host string) (HostConfig, bool) {
+	if cfg, ok := c.hosts[host]; ok {
+		return cfg, true
+	}
+	cfg, ok := c.hosts[DefaultHost]
+	return cfg, ok
+}
+
+// AppleAppSiteAssociation возвращает документ apple-app-site-association для хоста.
+// Второе значение равно false, если для хоста не настроено ни одного приложения iOS.
+func (c *Config) AppleAppSiteAssociation(host string) ([]byte, bool) {
+	cfg, ok := c.lookup(host)
+	if !ok || len(cfg.Apple) == 0 {
+		return nil, false
+	}
+
+	type detail struct {
+		AppID string   `json:"appID"`
+		Paths []string `json:"paths"`
+	}
+
+	details := make([]detail, 0, len(cfg.Apple))
+	for _, app := range cfg.Apple {
+		paths := app.Paths
+		if len(paths) == 0 {
+			paths = []string{"*"}
+		}
+		details = append(details, detail{AppID: app.AppID, Paths: paths})
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"applinks": map[string]interface{}{
+			"apps":    []string{},
+			"details": details,
+		},
+	})
+	return data, true
+}
+
+// AssetLinks возвращает документ assetlinks.json для хоста.
+// Второе значение равно false, если для хоста не настроено ни одного приложения Android.
+func (c *Config) AssetLinks(host string) ([]byte, bool) {
+	cfg, ok := c.lookup(host)
+	if !ok || len(cfg.Android) == 0 {
+		return nil, false
+	}
+
+	type target struct {
+		Namespace    string   `json:"namespace"`
+		PackageName  string   `json:"package_name"`
+		Fingerprints []string `json:"sha256_cert_fingerprints"`
+	}
+	type statement struct {
+		Relation []string `json:"relation"`
+		Target   target   `json:"target"`
+	}
+
+	statements := make([]statement, 0, len(cfg.Android))
+	for _, app := range cfg.Android {
+		statements = append(statements, statement{
+			Relation: []string{"delegate_permission/common.handle_all_urls"},
+			Target: target{
+				Namespace:    "android_app",
+				PackageName:  app.PackageName,
+				Fingerprints: app.Fingerprints,
+			},
+		})
+	}
+
+	data, _ := json.Marshal(statements)
+	return data, true
+}
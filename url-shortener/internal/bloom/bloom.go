@@ -0,0 +1,66 @@
+// Package bloom реализует фильтр Блума, безопасный для одновременного чтения и записи
+package bloom
+
+import (
+	"hash/maphash"
+	"math"
+	"sync/atomic"
+)
+
+// Filter отвечает "точно нет" или "возможно есть". Удаление не поддерживается.
+type Filter struct {
+	seed maphash.Seed
+	bits []atomic.Uint64
+	m    uint64 // Число бит
+	k    uint64 // Число хеш-функций
+}
+
+// New создает фильтр на capacity элементов с долей ложных срабатываний fpRate
+func New(capacity int, fpRate float64) *Filter {
+	n := float64(max(capacity, 1))
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+
+	m := uint64(math.Ceil(-n * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	m = max((m+63)/64*64, 64)
+	k := uint64(math.Round(float64(m) / n * math.Ln2))
+	k = min(max(k, 1), 30)
+
+	return &Filter{
+		seed: maphash.MakeSeed(),
+		bits: make([]atomic.Uint64, m/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// positions строит k позиций из одного 64-битного хеша (двойное хеширование Кирша-Митценмахера)
+func (f *Filter) positions(key string, fn func(pos uint64) bool) {
+	h := maphash.String(f.seed, key)
+	h1, h2 := h&0xffffffff, h>>32|1
+	for i := uint64(0); i < f.k; i++ {
+		if !fn((h1 + i*h2) % f.m) {
+			return
+		}
+	}
+}
+
+func (f *Filter) Add(key string) {
+	f.positions(key, func(pos uint64) bool {
+		f.bits[pos/64].Or(1 << (pos % 64))
+		return true
+	})
+}
+
+// MayContain возвращает false, только если key точно не добавлялся
+func (f *Filter) MayContain(key string) bool {
+	found := true
+	f.positions(key, func(pos uint64) bool {
+		if f.bits[pos/64].Load()&(1<<(pos%64)) == 0 {
+			found = false
+		}
+		return found
+	})
+	return found
+}
@@ -4,6 +4,8 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -16,7 +18,72 @@ type Config struct {
 	DBName      string
 	RedisAddr   string
 	ServerPort  string
+	MetricsPort string // Внутренний порт /metrics, не публикуется наружу
 	TokenLength int
+	QRLogoFile  string
+
+	OwnerTokenSecret string // Ключ подписи токенов владельцев
+	TrustOwnerHeader bool   // Принимать X-Owner-ID от доверенного прокси
+
+	DefaultDomain         string
+	ShortURLScheme        string
+	DomainRefreshInterval time.Duration
+	FallbackTemplateDir   string
+	AppLinksFile          string
+
+	ExpiryCheckInterval time.Duration
+
+	AnomalyInterval        time.Duration
+	AnomalyWindow          time.Duration
+	AnomalyBaselineWindows int
+	AnomalyZThreshold      float64
+	AnomalyMinClicks       int
+	AnomalyMinBaseline     float64
+	AnomalyAbuseThreshold  int
+
+	LogLevel string
+
+	MigrateOnStart bool
+
+	DBReplicaHosts        []string // Реплики для чтения: host или host:port, учетные данные как у основной базы
+	ReplicaHealthInterval time.Duration
+	ReplicaHealthTimeout  time.Duration
+	ReplicaMaxLag         time.Duration
+
+	RedisTimeout          time.Duration
+	CacheBreakerThreshold int
+	CacheBreakerCooldown  time.Duration
+	LocalCacheSize        int
+	LocalCacheTTL         time.Duration
+	CacheNotFoundTTL      time.Duration
+	CacheEarlyRefreshBeta float64
+
+	CodeFilterEnabled         bool
+	CodeFilterFPRate          float64
+	CodeFilterSyncInterval    time.Duration
+	CodeFilterRebuildInterval time.Duration
+
+	ReadinessTimeout   time.Duration
+	ShutdownDrainDelay time.Duration
+
+	TracingExporter    string
+	TracingServiceName string
+	TracingSampleRatio float64
+
+	StripTrackingParams bool
+
+	SafetyDenylistFile    string
+	SafetyAllowlistFile   string
+	SafetyRecheckInterval time.Duration
+
+	HealthCheckInterval    time.Duration
+	HealthCheckConcurrency int
+	HealthCheckHostDelay   time.Duration
+	HealthCheckTimeout     time.Duration
+
+	WebhookPollInterval time.Duration
+	WebhookTimeout      time.Duration
+	WebhookMaxAttempts  int
 }
 
 func LoadConfig() *Config {
@@ -33,7 +100,72 @@ func LoadConfig() *Config {
 		DBName:      getEnv("DB_NAME", "url_shortener"),
 		RedisAddr:   getEnv("REDIS_ADDR", "localhost:6379"),
 		ServerPort:  getEnv("SERVER_PORT", "8080"),
+		MetricsPort: getEnv("METRICS_PORT", "9090"),
 		TokenLength: getEnvAsInt("TOKEN_LENGTH", 6),
+		QRLogoFile:  getEnv("QR_LOGO_FILE", ""),
+
+		OwnerTokenSecret: getEnv("OWNER_TOKEN_SECRET", ""),
+		TrustOwnerHeader: getEnvAsBool("TRUST_OWNER_HEADER", false),
+
+		DefaultDomain:         getEnv("DEFAULT_DOMAIN", "localhost:8080"),
+		ShortURLScheme:        getEnv("SHORT_URL_SCHEME", "http"),
+		DomainRefreshInterval: getEnvAsDuration("DOMAIN_REFRESH_INTERVAL", time.Minute),
+		FallbackTemplateDir:   getEnv("FALLBACK_TEMPLATE_DIR", ""),
+		AppLinksFile:          getEnv("APP_LINKS_FILE", ""),
+
+		ExpiryCheckInterval: getEnvAsDuration("EXPIRY_CHECK_INTERVAL", time.Minute),
+
+		AnomalyInterval:        getEnvAsDuration("ANOMALY_INTERVAL", 15*time.Minute),
+		AnomalyWindow:          getEnvAsDuration("ANOMALY_WINDOW", time.Hour),
+		AnomalyBaselineWindows: getEnvAsInt("ANOMALY_BASELINE_WINDOWS", 24),
+		AnomalyZThreshold:      getEnvAsFloat("ANOMALY_Z_THRESHOLD", 4),
+		AnomalyMinClicks:       getEnvAsInt("ANOMALY_MIN_CLICKS", 50),
+		AnomalyMinBaseline:     getEnvAsFloat("ANOMALY_MIN_BASELINE", 10),
+		AnomalyAbuseThreshold:  getEnvAsInt("ANOMALY_ABUSE_THRESHOLD", 0),
+
+		LogLevel: getEnv("LOG_LEVEL", "info"),
+
+		MigrateOnStart: getEnvAsBool("MIGRATE_ON_START", true),
+
+		DBReplicaHosts:        getEnvAsList("DB_REPLICA_HOSTS"),
+		ReplicaHealthInterval: getEnvAsDuration("REPLICA_HEALTH_INTERVAL", 5*time.Second),
+		ReplicaHealthTimeout:  getEnvAsDuration("REPLICA_HEALTH_TIMEOUT", time.Second),
+		ReplicaMaxLag:         getEnvAsOptionalDuration("REPLICA_MAX_LAG", 5*time.Second),
+
+		RedisTimeout:          getEnvAsDuration("REDIS_TIMEOUT", 250*time.Millisecond),
+		CacheBreakerThreshold: getEnvAsInt("CACHE_BREAKER_THRESHOLD", 5),
+		CacheBreakerCooldown:  getEnvAsDuration("CACHE_BREAKER_COOLDOWN", 10*time.Second),
+		LocalCacheSize:        getEnvAsInt("LOCAL_CACHE_SIZE", 10000),
+		LocalCacheTTL:         getEnvAsDuration("LOCAL_CACHE_TTL", 5*time.Second),
+		CacheNotFoundTTL:      getEnvAsOptionalDuration("CACHE_NOT_FOUND_TTL", 30*time.Second),
+		CacheEarlyRefreshBeta: getEnvAsFloat("CACHE_EARLY_REFRESH_BETA", 0),
+
+		CodeFilterEnabled:         getEnvAsBool("CODE_FILTER_ENABLED", true),
+		CodeFilterFPRate:          getEnvAsFloat("CODE_FILTER_FP_RATE", 0.01),
+		CodeFilterSyncInterval:    getEnvAsDuration("CODE_FILTER_SYNC_INTERVAL", 2*time.Second),
+		CodeFilterRebuildInterval: getEnvAsDuration("CODE_FILTER_REBUILD_INTERVAL", time.Hour),
+
+		ReadinessTimeout:   getEnvAsDuration("READINESS_TIMEOUT", 2*time.Second),
+		ShutdownDrainDelay: getEnvAsOptionalDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second),
+
+		TracingExporter:    getEnv("TRACING_EXPORTER", "none"),
+		TracingServiceName: getEnv("TRACING_SERVICE_NAME", "url-shortener"),
+		TracingSampleRatio: getEnvAsFloat("TRACING_SAMPLE_RATIO", 1),
+
+		StripTrackingParams: getEnvAsBool("STRIP_TRACKING_PARAMS", false),
+
+		SafetyDenylistFile:    getEnv("SAFETY_DENYLIST_FILE", ""),
+		SafetyAllowlistFile:   getEnv("SAFETY_ALLOWLIST_FILE", ""),
+		SafetyRecheckInterval: getEnvAsDuration("SAFETY_RECHECK_INTERVAL", 6*time.Hour),
+
+		HealthCheckInterval:    getEnvAsDuration("HEALTH_CHECK_INTERVAL", time.Hour),
+		HealthCheckConcurrency: getEnvAsInt("HEALTH_CHECK_CONCURRENCY", 10),
+		HealthCheckHostDelay:   getEnvAsOptionalDuration("HEALTH_CHECK_HOST_DELAY", time.Second),
+		HealthCheckTimeout:     getEnvAsDuration("HEALTH_CHECK_TIMEOUT", 10*time.Second),
+
+		WebhookPollInterval: getEnvAsDuration("WEBHOOK_POLL_INTERVAL", 5*time.Second),
+		WebhookTimeout:      getEnvAsDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookMaxAttempts:  getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 10),
 	}
 }
 
@@ -44,6 +176,17 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvAsList разбирает список через запятую, пустые элементы пропускаются
+func getEnvAsList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func getEnvAsInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
@@ -52,3 +195,48 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsDuration читает интервал или таймаут. Нулевое и отрицательное значения
+// заменяются значением по умолчанию: time.NewTicker с ними паникует.
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			if duration > 0 {
+				return duration
+			}
+			log.Printf("%s must be positive, using default %s", key, defaultValue)
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsOptionalDuration читает длительность, у которой 0 означает "выключено"
+func getEnvAsOptionalDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			if duration >= 0 {
+				return duration
+			}
+			log.Printf("%s must not be negative, using default %s", key, defaultValue)
+		}
+	}
+	return defaultValue
+}
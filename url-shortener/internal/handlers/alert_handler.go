@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"url-shortener/internal/models"
+	"url-shortener/internal/service"
+)
+
+type AlertHandler struct {
+	anomalyDetector *service.AnomalyDetector
+}
+
+func NewAlertHandler(anomalyDetector *service.AnomalyDetector) *AlertHandler {
+	return &AlertHandler{
+		anomalyDetector: anomalyDetector,
+	}
+}
+
+func (h *AlertHandler) ListAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts, err := h.anomalyDetector.ListAlerts(r.Context(), getOwnerID(r))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to list alerts"})
+		return
+	}
+
+	if alerts == nil {
+		alerts = []models.Alert{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"alerts": alerts,
+	})
+}
@@ -34,7 +34,7 @@ func (h *AnalyticsHandler) GetAnalytics(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	analytics, err := h.analyticsService.GetAnalyticsByShortCode(r.Context(), shortCode)
+	analytics, err := h.analyticsService.GetAnalyticsByShortCode(r.Context(), getOwnerID(r), getDomain(r), shortCode)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to get analytics"})
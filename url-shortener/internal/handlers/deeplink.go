@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strings"
+	"url-shortener/internal/applinks"
+	"url-shortener/internal/models"
+	"url-shortener/internal/service"
+)
+
+// androidPackagePattern - имя пакета Android: сегменты через точку, не меньше двух.
+// Значение вставляется в intent:// без экранирования, поэтому ";" и "#" в нем недопустимы.
+var androidPackagePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*(\.[A-Za-z][A-Za-z0-9_]*)+$`)
+
+// Мобильные платформы, для которых поддерживаются переходы в приложение
+const (
+	platformOther = iota
+	platformIOS
+	platformAndroid
+)
+
+// detectPlatform определяет мобильную платформу по User-Agent
+func detectPlatform(userAgent string) int {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(ua, "android"):
+		return platformAndroid
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return platformIOS
+	default:
+		return platformOther
+	}
+}
+
+// appLaunchTemplate пытается открыть приложение по собственной схеме и, если оно
+// не открылось, через короткую паузу уводит на магазин или веб-версию
+var appLaunchTemplate = template.Must(template.New("app").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Opening app…</title>
+</head>
+<body>
+<p><a href="{{.DeepLink}}">Open in app</a> or <a href="{{.Fallback}}">continue</a>.</p>
+<script>
+(function () {
+  var fallback = {{.Fallback}};
+  var timer = setTimeout(function () { window.location.replace(fallback); }, 1500);
+  document.addEventListener("visibilitychange", function () {
+    if (document.hidden) { clearTimeout(timer); }
+  });
+  window.location.href = {{.DeepLink}};
+})();
+</script>
+</body>
+</html>
+`))
+
+// appLaunch описывает переход в приложение для текущего запроса
+type appLaunch struct {
+	DeepLink string
+	Fallback string
+}
+
+// chooseAppLaunch выбирает переход в приложение для платформы посетителя.
+// destination - веб-адрес на случай, если магазин для платформы не задан.
+func chooseAppLaunch(url *models.URL, userAgent, destination string) *appLaunch {
+	switch detectPlatform(userAgent) {
+	case platformIOS:
+		if url.IOSDeepLink == "" {
+			return nil
+		}
+		return &appLaunch{DeepLink: url.IOSDeepLink, Fallback: orDefault(url.IOSStoreURL, destination)}
+	case platformAndroid:
+		if url.AndroidDeepLink == "" {
+			return nil
+		}
+		return &appLaunch{DeepLink: url.AndroidDeepLink, Fallback: orDefault(url.AndroidStoreURL, destination)}
+	}
+	return nil
+}
+
+// writeAppLaunch отправляет посетителя в приложение. https ссылки (Universal Links,
+// App Links) открываются системой сами, на Android собственная схема оборачивается в
+// intent:// с browser_fallback_url, на iOS отдается страница с переходом по таймеру.
+func writeAppLaunch(w http.ResponseWriter, r *http.Request, url *models.URL, launch *appLaunch) {
+	deepLink, err := neturl.Parse(launch.DeepLink)
+	if err != nil || strings.EqualFold(deepLink.Scheme, "https") {
+		http.Redirect(w, r, launch.DeepLink, http.StatusFound)
+		return
+	}
+
+	if detectPlatform(r.UserAgent()) == platformAndroid {
+		http.Redirect(w, r, androidIntent(deepLink, url.AndroidStoreURL, launch.Fallback), http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// Схема приложения проверена при сохранении ссылки, иначе html/template заменил бы ее на #ZgotmplZ
+	appLaunchTemplate.Execute(w, struct {
+		DeepLink template.URL
+		Fallback string
+	}{
+		DeepLink: template.URL(launch.DeepLink),
+		Fallback: launch.Fallback,
+	})
+}
+
+// androidIntent строит intent:// адрес Chrome. Пакет приложения берется из параметра id
+// адреса Google Play, чтобы при отсутствии приложения Chrome мог сам предложить магазин.
+func androidIntent(deepLink *neturl.URL, storeURL, fallback string) string {
+	// Фрагмент подставил бы свои параметры интента перед нашими
+	link := *deepLink
+	link.Fragment, link.RawFragment = "", ""
+	deepLink = &link
+
+	var b strings.Builder
+	b.WriteString("intent://")
+	rest := strings.TrimPrefix(deepLink.String(), deepLink.Scheme+":")
+	b.WriteString(strings.TrimPrefix(rest, "//"))
+	b.WriteString("#Intent;scheme=")
+	b.WriteString(deepLink.Scheme)
+	b.WriteString(";")
+
+	if store, err := neturl.Parse(storeURL); err == nil {
+		if pkg := store.Query().Get("id"); androidPackagePattern.MatchString(pkg) {
+			b.WriteString("package=" + pkg + ";")
+		}
+	}
+
+	b.WriteString("S.browser_fallback_url=" + neturl.QueryEscape(fallback) + ";end")
+	return b.String()
+}
+
+func orDefault(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
+
+// AppLinksHandler отдает файлы ассоциации домена с мобильными приложениями
+type AppLinksHandler struct {
+	config *applinks.Config
+}
+
+func NewAppLinksHandler(config *applinks.Config) *AppLinksHandler {
+	return &AppLinksHandler{config: config}
+}
+
+func (h *AppLinksHandler) AppleAppSiteAssociation(w http.ResponseWriter, r *http.Request) {
+	data, ok := h.config.AppleAppSiteAssociation(service.NormalizeHost(r.Host))
+	h.write(w, r, data, ok)
+}
+
+func (h *AppLinksHandler) AssetLinks(w http.ResponseWriter, r *http.Request) {
+	data, ok := h.config.AssetLinks(service.NormalizeHost(r.Host))
+	h.write(w, r, data, ok)
+}
+
+func (h *AppLinksHandler) write(w http.ResponseWriter, r *http.Request, data []byte, ok bool) {
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Apple и Google не следуют редиректам и требуют application/json
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(data)
+}
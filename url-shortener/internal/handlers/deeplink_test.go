@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strings"
+	"testing"
+	"url-shortener/internal/models"
+)
+
+const (
+	iphoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15"
+	androidUA = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36"
+	desktopUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0"
+)
+
+func TestAndroidIntent(t *testing.T) {
+	const fallback = "https://example.com/page?a=1&b=2"
+
+	tests := []struct {
+		name     string
+		deepLink string
+		store    string
+		want     string
+	}{
+		{
+			name:     "package from store url",
+			deepLink: "myapp://product/42?ref=sms",
+			store:    "https://play.google.com/store/apps/details?id=com.example.app",
+			want:     "intent://product/42?ref=sms#Intent;scheme=myapp;package=com.example.app;S.browser_fallback_url=https%3A%2F%2Fexample.com%2Fpage%3Fa%3D1%26b%3D2;end",
+		},
+		{
+			name:     "no store url",
+			deepLink: "myapp://open",
+			want:     "intent://open#Intent;scheme=myapp;S.browser_fallback_url=https%3A%2F%2Fexample.com%2Fpage%3Fa%3D1%26b%3D2;end",
+		},
+		{
+			name:     "invalid package is skipped",
+			deepLink: "myapp://open",
+			store:    "https://play.google.com/store/apps/details?id=com.example;component=evil",
+			want:     "intent://open#Intent;scheme=myapp;S.browser_fallback_url=https%3A%2F%2Fexample.com%2Fpage%3Fa%3D1%26b%3D2;end",
+		},
+		{
+			name:     "fragment cannot inject intent parameters",
+			deepLink: "myapp://x#Intent;component=evil/.Main;S.foo=bar;end",
+			want:     "intent://x#Intent;scheme=myapp;S.browser_fallback_url=https%3A%2F%2Fexample.com%2Fpage%3Fa%3D1%26b%3D2;end",
+		},
+		{
+			name:     "opaque uri",
+			deepLink: "myapp:open",
+			want:     "intent://open#Intent;scheme=myapp;S.browser_fallback_url=https%3A%2F%2Fexample.com%2Fpage%3Fa%3D1%26b%3D2;end",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deepLink, err := neturl.Parse(tt.deepLink)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := androidIntent(deepLink, tt.store, fallback); got != tt.want {
+				t.Errorf("androidIntent() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChooseAppLaunch(t *testing.T) {
+	url := &models.URL{
+		IOSDeepLink:     "myapp://ios",
+		IOSStoreURL:     "https://apps.apple.com/app/id123",
+		AndroidDeepLink: "myapp://android",
+	}
+
+	tests := []struct {
+		name      string
+		userAgent string
+		want      *appLaunch
+	}{
+		{name: "iphone", userAgent: iphoneUA, want: &appLaunch{DeepLink: "myapp://ios", Fallback: "https://apps.apple.com/app/id123"}},
+		{name: "android falls back to the destination", userAgent: androidUA, want: &appLaunch{DeepLink: "myapp://android", Fallback: "https://example.com/"}},
+		{name: "desktop", userAgent: desktopUA},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chooseAppLaunch(url, tt.userAgent, "https://example.com/")
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("chooseAppLaunch() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if got := chooseAppLaunch(&models.URL{}, iphoneUA, "https://example.com/"); got != nil {
+		t.Errorf("link without deep links: chooseAppLaunch() = %+v", got)
+	}
+}
+
+func TestWriteAppLaunch(t *testing.T) {
+	url := &models.URL{AndroidStoreURL: "https://play.google.com/store/apps/details?id=com.example.app"}
+
+	t.Run("ios page", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+		r.Header.Set("User-Agent", iphoneUA)
+		w := httptest.NewRecorder()
+
+		writeAppLaunch(w, r, url, &appLaunch{DeepLink: "myapp://product/42", Fallback: `https://example.com/?q="</script>`})
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d", w.Code)
+		}
+		if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+			t.Errorf("Cache-Control = %q", cc)
+		}
+		body := w.Body.String()
+		for _, want := range []string{
+			`<a href="myapp://product/42">Open in app</a>`,
+			`window.location.href = "myapp://product/42";`,
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("page does not contain %q:\n%s", want, body)
+			}
+		}
+		if strings.Contains(body, `"</script>`) {
+			t.Errorf("fallback is not escaped in the script:\n%s", body)
+		}
+	})
+
+	t.Run("android intent", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+		r.Header.Set("User-Agent", androidUA)
+		w := httptest.NewRecorder()
+
+		writeAppLaunch(w, r, url, &appLaunch{DeepLink: "myapp://product/42", Fallback: "https://example.com/"})
+
+		if w.Code != http.StatusFound {
+			t.Fatalf("status = %d", w.Code)
+		}
+		if loc := w.Header().Get("Location"); !strings.HasPrefix(loc, "intent://product/42#Intent;scheme=myapp;package=com.example.app;") {
+			t.Errorf("Location = %q", loc)
+		}
+	})
+
+	t.Run("universal link", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+		r.Header.Set("User-Agent", iphoneUA)
+		w := httptest.NewRecorder()
+
+		writeAppLaunch(w, r, url, &appLaunch{DeepLink: "https://app.example.com/product/42", Fallback: "https://example.com/"})
+
+		if w.Code != http.StatusFound || w.Header().Get("Location") != "https://app.example.com/product/42" {
+			t.Errorf("got %d %q", w.Code, w.Header().Get("Location"))
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"url-shortener/internal/models"
+	"url-shortener/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+type DomainHandler struct {
+	domainService *service.DomainService
+	pages         *FallbackPages
+}
+
+func NewDomainHandler(domainService *service.DomainService, pages *FallbackPages) *DomainHandler {
+	return &DomainHandler{
+		domainService: domainService,
+		pages:         pages,
+	}
+}
+
+func (h *DomainHandler) CreateDomain(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Hostname string `json:"hostname"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	claim, err := h.domainService.Register(r.Context(), getOwnerID(r), request.Hostname)
+	if err != nil {
+		if errors.Is(err, service.ErrDomainTaken) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(claimResponse(claim))
+}
+
+// claimResponse описывает заявку на домен и запись, которую нужно опубликовать для подтверждения
+func claimResponse(claim *models.DomainClaim) map[string]interface{} {
+	return map[string]interface{}{
+		"hostname":   claim.Hostname,
+		"status":     "pending",
+		"created_at": claim.CreatedAt,
+		"verification": map[string]string{
+			"type":  "TXT",
+			"name":  service.VerificationRecord(claim.Hostname),
+			"value": claim.Token,
+		},
+	}
+}
+
+func (h *DomainHandler) VerifyDomain(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	hostname := vars["hostname"]
+
+	domain, err := h.domainService.Verify(r.Context(), getOwnerID(r), hostname)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Domain claim not found"})
+		case errors.Is(err, service.ErrDomainTaken):
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		case errors.Is(err, service.ErrDomainNotVerified):
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to verify domain"})
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(domain)
+}
+
+func (h *DomainHandler) ListDomains(w http.ResponseWriter, r *http.Request) {
+	domains, claims, err := h.domainService.List(r.Context(), getOwnerID(r))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to list domains"})
+		return
+	}
+
+	if domains == nil {
+		domains = []models.Domain{}
+	}
+	pending := make([]map[string]interface{}, 0, len(claims))
+	for i := range claims {
+		pending = append(pending, claimResponse(&claims[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"domains": domains,
+		"pending": pending,
+	})
+}
+
+func (h *DomainHandler) SetFallback(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	hostname := vars["hostname"]
+
+	var request struct {
+		Mode     string `json:"mode"`
+		URL      string `json:"url"`
+		Template string `json:"template"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	if request.Mode == models.FallbackModeTemplate && !h.pages.Has(request.Template) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Template not found"})
+		return
+	}
+
+	domain, err := h.domainService.SetFallback(r.Context(), getOwnerID(r), hostname, service.Fallback{
+		Mode:     request.Mode,
+		URL:      request.URL,
+		Template: request.Template,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Domain not found"})
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(domain)
+}
+
+func (h *DomainHandler) DeleteDomain(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	hostname := vars["hostname"]
+
+	if err := h.domainService.Delete(r.Context(), getOwnerID(r), hostname); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Domain not found"})
+		case errors.Is(err, service.ErrDomainInUse):
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete domain"})
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"url-shortener/internal/models"
+)
+
+// fallbackReason - почему вместо редиректа показывается заглушка
+type fallbackReason struct {
+	Status  int
+	Code    string // Машинный код для JSON ответа и шаблонов
+	Title   string
+	Message string
+}
+
+var (
+	reasonNotFound = fallbackReason{http.StatusNotFound, "not_found", "Link not found", "This short link does not exist."}
+	reasonDeleted  = fallbackReason{http.StatusGone, "deleted", "Link removed", "This short link has been removed and is no longer available."}
+	reasonDisabled = fallbackReason{http.StatusGone, "disabled", "Link disabled", "This short link has been disabled."}
+	reasonExpired  = fallbackReason{http.StatusGone, "expired", "Link expired", "This short link has expired."}
+	reasonPending  = fallbackReason{http.StatusNotFound, "coming_soon", "Coming soon", "This link is not active yet."}
+)
+
+// fallbackPage - данные, доступные встроенной странице и брендированным шаблонам
+type fallbackPage struct {
+	Status     int
+	Code       string
+	Title      string
+	Message    string
+	Reason     string // Причина отключения, указанная владельцем
+	Host       string
+	ShortCode  string
+	ActiveFrom *time.Time // Время активации для страницы "скоро"
+}
+
+var defaultFallbackTemplate = template.Must(template.New("fallback").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+<style>
+body{font-family:-apple-system,BlinkMacSystemFont,"Segoe UI",Roboto,sans-serif;background:#f6f7f9;color:#1f2328;display:flex;align-items:center;justify-content:center;min-height:100vh;margin:0}
+main{max-width:28rem;padding:2rem;text-align:center}
+h1{font-size:1.5rem;margin:0 0 .75rem}
+p{color:#59636e;line-height:1.5;margin:0 0 .5rem}
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Title}}</h1>
+<p>{{.Message}}</p>
+{{- if .ActiveFrom}}
+<p>Available from {{.ActiveFrom.UTC.Format "2006-01-02 15:04 MST"}}.</p>
+{{- end}}
+{{- if .Reason}}
+<p>{{.Reason}}</p>
+{{- end}}
+</main>
+</body>
+</html>
+`))
+
+// FallbackPages отдает заглушки для ненайденных, удаленных и отключенных ссылок.
+// Брендированные шаблоны читаются из каталога dir по имени <name>.html и кэшируются.
+type FallbackPages struct {
+	dir string
+
+	mu        sync.RWMutex
+	templates map[string]*template.Template
+}
+
+// NewFallbackPages создает набор заглушек. dir может быть пустым, тогда доступна только встроенная страница.
+func NewFallbackPages(dir string) *FallbackPages {
+	return &FallbackPages{
+		dir:       dir,
+		templates: make(map[string]*template.Template),
+	}
+}
+
+// Has сообщает, что брендированный шаблон с таким именем есть на диске и корректен
+func (p *FallbackPages) Has(name string) bool {
+	_, err := p.load(name)
+	return err == nil
+}
+
+func (p *FallbackPages) load(name string) (*template.Template, error) {
+	p.mu.RLock()
+	tmpl, ok := p.templates[name]
+	p.mu.RUnlock()
+	if ok {
+		return tmpl, nil
+	}
+
+	if p.dir == "" {
+		return nil, os.ErrNotExist
+	}
+
+	// Имя проверяется при сохранении настроек домена, Base - дополнительная защита от выхода из каталога
+	tmpl, err := template.ParseFiles(filepath.Join(p.dir, filepath.Base(name)+".html"))
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.templates[name] = tmpl
+	p.mu.Unlock()
+
+	return tmpl, nil
+}
+
+// Write отвечает клиенту заглушкой. API клиенты получают JSON, браузеры - HTML
+// в соответствии с настройками домена.
+func (p *FallbackPages) Write(w http.ResponseWriter, r *http.Request, domain *models.Domain, reason fallbackReason, page fallbackPage) {
+	if !wantsHTML(r) {
+		body := map[string]string{"error": reason.Title, "code": reason.Code}
+		if page.Reason != "" {
+			body["reason"] = page.Reason
+		}
+		if page.ActiveFrom != nil {
+			body["active_from"] = page.ActiveFrom.UTC().Format(time.RFC3339)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(reason.Status)
+		json.NewEncoder(w).Encode(body)
+		return
+	}
+
+	page.Status = reason.Status
+	page.Code = reason.Code
+	page.Title = reason.Title
+	page.Message = reason.Message
+
+	tmpl := defaultFallbackTemplate
+	if domain != nil {
+		switch domain.FallbackMode {
+		case models.FallbackModeRedirect:
+			http.Redirect(w, r, domain.FallbackURL, http.StatusFound)
+			return
+		case models.FallbackModeTemplate:
+			branded, err := p.load(domain.FallbackTemplate)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to load fallback template", "template", domain.FallbackTemplate, "domain", domain.Hostname, "error", err)
+			} else {
+				tmpl = branded
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(reason.Status)
+	if err := tmpl.Execute(w, page); err != nil {
+		slog.ErrorContext(r.Context(), "failed to render fallback page", "error", err)
+	}
+}
+
+// wantsHTML сообщает, что клиент предпочитает HTML, а не JSON. Без явного text/html
+// в Accept (например, curl с */*) клиент считается API клиентом.
+func wantsHTML(r *http.Request) bool {
+	var htmlQ, jsonQ float64
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && key == "q" {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "text/html", "application/xhtml+xml":
+			htmlQ = max(htmlQ, q)
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		}
+	}
+
+	return htmlQ > 0 && htmlQ >= jsonQ
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/internal/models"
+)
+
+func TestWantsHTML(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   bool
+	}{
+		{name: "no accept header", accept: "", want: false},
+		{name: "curl", accept: "*/*", want: false},
+		{name: "api client", accept: "application/json", want: false},
+		{name: "browser", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", want: true},
+		{name: "xhtml only", accept: "application/xhtml+xml", want: true},
+		{name: "json preferred", accept: "text/html;q=0.5, application/json", want: false},
+		{name: "html preferred", accept: "application/json;q=0.4, text/html", want: true},
+		{name: "equal weights pick html", accept: "application/json;q=0.8, text/html;q=0.8", want: true},
+		{name: "html refused", accept: "text/html;q=0, */*", want: false},
+		{name: "case and spaces", accept: " Text/HTML ; q=1 ", want: true},
+		{name: "malformed q is ignored", accept: "text/html;q=abc", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			if got := wantsHTML(r); got != tt.want {
+				t.Errorf("wantsHTML(%q) = %v, want %v", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFallbackStatus(t *testing.T) {
+	tests := []struct {
+		reason fallbackReason
+		status int
+	}{
+		{reasonNotFound, http.StatusNotFound},
+		{reasonPending, http.StatusNotFound},
+		{reasonDeleted, http.StatusGone},
+		{reasonDisabled, http.StatusGone},
+		{reasonExpired, http.StatusGone},
+	}
+
+	pages := NewFallbackPages("")
+	for _, tt := range tests {
+		t.Run(tt.reason.Code, func(t *testing.T) {
+			for _, accept := range []string{"application/json", "text/html"} {
+				r := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+				r.Header.Set("Accept", accept)
+				w := httptest.NewRecorder()
+
+				pages.Write(w, r, nil, tt.reason, fallbackPage{ShortCode: "abc123"})
+
+				if w.Code != tt.status {
+					t.Errorf("%s: status = %d, want %d", accept, w.Code, tt.status)
+				}
+			}
+		})
+	}
+}
+
+func TestFallbackJSON(t *testing.T) {
+	activeFrom := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	r := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+	w := httptest.NewRecorder()
+
+	// Настройки домена не влияют на ответ API клиенту
+	domain := &models.Domain{FallbackMode: models.FallbackModeRedirect, FallbackURL: "https://acme.com"}
+	NewFallbackPages("").Write(w, r, domain, reasonPending, fallbackPage{ShortCode: "abc123", ActiveFrom: &activeFrom, Reason: "launch"})
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"error":       reasonPending.Title,
+		"code":        "coming_soon",
+		"reason":      "launch",
+		"active_from": "2030-01-02T03:04:05Z",
+	}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("body[%q] = %q, want %q", key, body[key], value)
+		}
+	}
+}
+
+func TestFallbackModes(t *testing.T) {
+	dir := t.TempDir()
+	brand := `<h1>Acme: {{.Title}}</h1><p>{{.Code}} {{.Status}} {{.Host}}/{{.ShortCode}}</p>`
+	if err := os.WriteFile(filepath.Join(dir, "acme.html"), []byte(brand), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pages := NewFallbackPages(dir)
+
+	tests := []struct {
+		name         string
+		domain       *models.Domain
+		wantStatus   int
+		wantLocation string
+		wantBody     []string
+	}{
+		{
+			name:       "default domain gets the built-in page",
+			wantStatus: http.StatusGone,
+			wantBody:   []string{"<title>Link disabled</title>", "This short link has been disabled.", "<p>policy violation</p>"},
+		},
+		{
+			name:       "page mode",
+			domain:     &models.Domain{FallbackMode: models.FallbackModePage},
+			wantStatus: http.StatusGone,
+			wantBody:   []string{"<title>Link disabled</title>"},
+		},
+		{
+			name:         "redirect mode",
+			domain:       &models.Domain{FallbackMode: models.FallbackModeRedirect, FallbackURL: "https://acme.com/"},
+			wantStatus:   http.StatusFound,
+			wantLocation: "https://acme.com/",
+		},
+		{
+			name:       "template mode",
+			domain:     &models.Domain{FallbackMode: models.FallbackModeTemplate, FallbackTemplate: "acme"},
+			wantStatus: http.StatusGone,
+			wantBody:   []string{"<h1>Acme: Link disabled</h1>", "disabled 410 go.acme.com/abc123"},
+		},
+		{
+			name:       "missing template falls back to the built-in page",
+			domain:     &models.Domain{FallbackMode: models.FallbackModeTemplate, FallbackTemplate: "missing"},
+			wantStatus: http.StatusGone,
+			wantBody:   []string{"<title>Link disabled</title>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+			r.Header.Set("Accept", "text/html")
+			w := httptest.NewRecorder()
+
+			pages.Write(w, r, tt.domain, reasonDisabled, fallbackPage{Host: "go.acme.com", ShortCode: "abc123", Reason: "policy violation"})
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantLocation != "" {
+				if got := w.Header().Get("Location"); got != tt.wantLocation {
+					t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+				}
+				return
+			}
+			if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", cc)
+			}
+			body := w.Body.String()
+			for _, want := range tt.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("body does not contain %q:\n%s", want, body)
+				}
+			}
+		})
+	}
+}
+
+func TestFallbackPagesHas(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "ok.html"), []byte(`{{.Title}}`), 0o644)
+	os.WriteFile(filepath.Join(dir, "broken.html"), []byte(`{{.Title`), 0o644)
+	pages := NewFallbackPages(dir)
+
+	for name, want := range map[string]bool{"ok": true, "broken": false, "missing": false, "../ok": true} {
+		if got := pages.Has(name); got != want {
+			t.Errorf("Has(%q) = %v, want %v", name, got, want)
+		}
+	}
+	if NewFallbackPages("").Has("ok") {
+		t.Error("Has without a template directory returned true")
+	}
+}
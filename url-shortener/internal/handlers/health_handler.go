@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"url-shortener/internal/models"
+	"url-shortener/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+type HealthHandler struct {
+	urlService    *service.URLService
+	healthChecker *service.HealthChecker
+}
+
+func NewHealthHandler(urlService *service.URLService, healthChecker *service.HealthChecker) *HealthHandler {
+	return &HealthHandler{
+		urlService:    urlService,
+		healthChecker: healthChecker,
+	}
+}
+
+func (h *HealthHandler) GetURLHealth(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	shortCode := vars["shortCode"]
+
+	url, err := h.urlService.GetOwnedURL(r.Context(), getOwnerID(r), getDomain(r), shortCode)
+	if err != nil {
+		writeURLError(w, err)
+		return
+	}
+
+	health, err := h.healthChecker.GetHealth(r.Context(), url.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to get health"})
+		return
+	}
+
+	if health == nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "URL has not been checked yet"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(health)
+}
+
+func (h *HealthHandler) ListBrokenLinks(w http.ResponseWriter, r *http.Request) {
+	broken, err := h.healthChecker.ListBroken(r.Context(), getOwnerID(r))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to list broken links"})
+		return
+	}
+
+	if broken == nil {
+		broken = []models.URLHealth{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"broken_links": broken,
+	})
+}
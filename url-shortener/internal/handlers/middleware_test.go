@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return recorder
+}
+
+func attrValue(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	tests := []struct {
+		name        string
+		path        string
+		traceparent string
+		status      int
+		wantStatus  codes.Code
+	}{
+		{name: "new trace", path: "/abc123", status: http.StatusFound, wantStatus: codes.Unset},
+		{name: "continues trace", path: "/abc123", traceparent: traceparent, status: http.StatusOK, wantStatus: codes.Unset},
+		{name: "server error", path: "/abc123", status: http.StatusInternalServerError, wantStatus: codes.Error},
+		{name: "client error is not a span error", path: "/abc123", status: http.StatusNotFound, wantStatus: codes.Unset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := newSpanRecorder(t)
+
+			var handlerSpan trace.SpanContext
+			router := mux.NewRouter()
+			router.Use(TracingMiddleware)
+			router.HandleFunc("/{shortCode}", func(w http.ResponseWriter, r *http.Request) {
+				handlerSpan = trace.SpanContextFromContext(r.Context())
+				w.WriteHeader(tt.status)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+
+			if span.Name() != "GET /{shortCode}" {
+				t.Errorf("name = %q, want route template", span.Name())
+			}
+			if span.SpanKind() != trace.SpanKindServer {
+				t.Errorf("kind = %v, want server", span.SpanKind())
+			}
+			if span.SpanContext().SpanID() != handlerSpan.SpanID() {
+				t.Error("handler context does not carry the request span")
+			}
+			if v, _ := attrValue(span, "http.response.status_code"); v.AsInt64() != int64(tt.status) {
+				t.Errorf("status_code attribute = %d, want %d", v.AsInt64(), tt.status)
+			}
+			if span.Status().Code != tt.wantStatus {
+				t.Errorf("span status = %v, want %v", span.Status().Code, tt.wantStatus)
+			}
+
+			parent := span.Parent()
+			if tt.traceparent == "" {
+				if parent.IsValid() {
+					t.Error("span without traceparent has a parent")
+				}
+				return
+			}
+			if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+				t.Errorf("trace id = %s, want the one from traceparent", got)
+			}
+			if !parent.IsRemote() || parent.SpanID().String() != "00f067aa0ba902b7" {
+				t.Errorf("parent = %v, want remote span from traceparent", parent)
+			}
+		})
+	}
+}
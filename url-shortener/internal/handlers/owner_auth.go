@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const maxOwnerIDLength = 128
+
+type ownerKey struct{}
+
+// SignOwnerToken выпускает токен владельца: base64url(ownerID) + "." + HMAC-SHA256(secret, ownerID).
+// Токен передается в заголовке Authorization: Bearer <token>.
+func SignOwnerToken(secret, ownerID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(ownerID)) + "." + ownerSignature(secret, ownerID)
+}
+
+func ownerSignature(secret, ownerID string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ownerID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyOwnerToken возвращает владельца из токена, если подпись верна
+func verifyOwnerToken(secret, token string) (string, bool) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || secret == "" {
+		return "", false
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	ownerID := string(raw)
+	if ownerID == "" || len(ownerID) > maxOwnerIDLength {
+		return "", false
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(ownerSignature(secret, ownerID))) {
+		return "", false
+	}
+	return ownerID, true
+}
+
+// OwnerAuthMiddleware определяет владельца запроса по подписанному токену в Authorization.
+// Запрос без учетных данных анонимный. Заголовок X-Owner-ID принимается, только если
+// trustHeader включен: тогда сервис должен стоять за прокси, который сам выставляет
+// этот заголовок после аутентификации и удаляет пришедший от клиента.
+func OwnerAuthMiddleware(secret string, trustHeader bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ownerID := ""
+
+			if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+				var valid bool
+				ownerID, valid = verifyOwnerToken(secret, strings.TrimSpace(token))
+				if !valid {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusUnauthorized)
+					json.NewEncoder(w).Encode(map[string]string{"error": "Invalid owner token"})
+					return
+				}
+			} else if header := strings.TrimSpace(r.Header.Get(ownerHeader)); header != "" {
+				if !trustHeader {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusUnauthorized)
+					json.NewEncoder(w).Encode(map[string]string{"error": ownerHeader + " is not accepted, use a signed owner token"})
+					return
+				}
+				ownerID = header
+			}
+
+			if len(ownerID) > maxOwnerIDLength {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "Owner ID is too long"})
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ownerKey{}, ownerID)))
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+	"url-shortener/internal/models"
+)
+
+// unfurlerAgents - подстроки User-Agent ботов, которые строят превью ссылок в мессенджерах и соцсетях
+var unfurlerAgents = []string{
+	"facebookexternalhit",
+	"facebot",
+	"twitterbot",
+	"slackbot-linkexpanding",
+	"slack-imgproxy",
+	"discordbot",
+	"telegrambot",
+	"linkedinbot",
+	"skypeuripreview",
+	"vkshare",
+	"redditbot",
+	"pinterestbot",
+	"embedly",
+	"iframely",
+	"mastodon",
+	"mattermost",
+	"bitrix link preview",
+}
+
+// appFetcherAgents - подстроки, общие для бота превью и встроенного браузера приложения.
+// Встроенный браузер присылает полный User-Agent движка (Mozilla/5.0 ...), бот превью - только
+// свой, поэтому эти подстроки считаются ботом лишь без признаков браузера.
+var appFetcherAgents = []string{
+	"whatsapp/",
+	"viber",
+}
+
+// browserEngines - признаки User-Agent настоящего браузера
+var browserEngines = []string{
+	"mozilla/",
+	"applewebkit",
+	"gecko/",
+}
+
+// isUnfurler сообщает, что запрос пришел от бота, строящего превью ссылки
+func isUnfurler(r *http.Request) bool {
+	ua := strings.ToLower(r.UserAgent())
+	if ua == "" {
+		return false
+	}
+	for _, agent := range unfurlerAgents {
+		if strings.Contains(ua, agent) {
+			return true
+		}
+	}
+
+	for _, engine := range browserEngines {
+		if strings.Contains(ua, engine) {
+			return false
+		}
+	}
+	for _, agent := range appFetcherAgents {
+		if strings.Contains(ua, agent) {
+			return true
+		}
+	}
+	return false
+}
+
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<meta property="og:url" content="{{.URL}}">
+{{- if .Title}}
+<meta property="og:title" content="{{.Title}}">
+<meta name="twitter:title" content="{{.Title}}">
+{{- end}}
+{{- if .Description}}
+<meta property="og:description" content="{{.Description}}">
+<meta name="description" content="{{.Description}}">
+<meta name="twitter:description" content="{{.Description}}">
+{{- end}}
+{{- if .Image}}
+<meta property="og:image" content="{{.Image}}">
+<meta name="twitter:card" content="summary_large_image">
+<meta name="twitter:image" content="{{.Image}}">
+{{- end}}
+<meta http-equiv="refresh" content="0; url={{.URL}}">
+</head>
+<body><a href="{{.URL}}">{{.URL}}</a></body>
+</html>
+`))
+
+// writePreview отдает страницу с Open Graph тегами ссылки вместо редиректа
+func writePreview(w http.ResponseWriter, url *models.URL, destination string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	previewTemplate.Execute(w, struct {
+		URL         string
+		Title       string
+		Description string
+		Image       string
+	}{
+		URL:         destination,
+		Title:       url.OGTitle,
+		Description: url.OGDescription,
+		Image:       url.OGImage,
+	})
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"url-shortener/internal/service"
+)
+
+// ProbeHandler отвечает на проверки живости и готовности от оркестратора и балансировщика
+type ProbeHandler struct {
+	readiness *service.Readiness
+}
+
+func NewProbeHandler(readiness *service.Readiness) *ProbeHandler {
+	return &ProbeHandler{readiness: readiness}
+}
+
+// Livez сообщает, что процесс жив и обслуживает HTTP. Зависимости не проверяются,
+// чтобы сбой базы не приводил к перезапуску всех экземпляров.
+func (h *ProbeHandler) Livez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"status": service.ReadinessOK})
+}
+
+// Readyz проверяет Postgres, Redis и заполненность очереди кликов. Недоступный Redis
+// только переводит отчет в degraded: редиректы обслуживаются из базы.
+func (h *ProbeHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := h.readiness.Check(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !report.Ready() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/internal/service"
+)
+
+func readyz(t *testing.T, h *ProbeHandler) (int, service.ReadinessReport) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if cc := w.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control = %q", cc)
+	}
+	var report service.ReadinessReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	return w.Code, report
+}
+
+func TestReadyzDraining(t *testing.T) {
+	readiness := service.NewReadiness(time.Second)
+	readiness.AddCheck("postgres", func(ctx context.Context) error { return nil })
+	h := NewProbeHandler(readiness)
+
+	if code, report := readyz(t, h); code != http.StatusOK || report.Status != service.ReadinessOK {
+		t.Fatalf("before drain: %d %+v", code, report)
+	}
+
+	readiness.SetDraining()
+	if code, report := readyz(t, h); code != http.StatusServiceUnavailable || report.Status != service.ReadinessDraining {
+		t.Errorf("after drain: %d %+v", code, report)
+	}
+}
+
+func TestReadyzReportsEachDependency(t *testing.T) {
+	hang := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	fail := func(ctx context.Context) error { return errors.New("connection refused") }
+	ok := func(ctx context.Context) error { return nil }
+
+	tests := []struct {
+		name       string
+		postgres   func(ctx context.Context) error
+		redis      func(ctx context.Context) error
+		wantCode   int
+		wantStatus string
+		wantFailed string
+		wantError  string
+	}{
+		{
+			name:       "postgres times out",
+			postgres:   hang,
+			redis:      ok,
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: service.ReadinessUnavailable,
+			wantFailed: "postgres",
+			wantError:  context.DeadlineExceeded.Error(),
+		},
+		{
+			name:       "redis times out",
+			postgres:   ok,
+			redis:      hang,
+			wantCode:   http.StatusOK,
+			wantStatus: service.ReadinessDegraded,
+			wantFailed: "redis",
+			wantError:  context.DeadlineExceeded.Error(),
+		},
+		{
+			name:       "postgres refuses",
+			postgres:   fail,
+			redis:      ok,
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: service.ReadinessUnavailable,
+			wantFailed: "postgres",
+			wantError:  "connection refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readiness := service.NewReadiness(20 * time.Millisecond)
+			readiness.AddCheck("postgres", tt.postgres)
+			readiness.AddOptionalCheck("redis", tt.redis)
+
+			code, report := readyz(t, NewProbeHandler(readiness))
+			if code != tt.wantCode || report.Status != tt.wantStatus {
+				t.Fatalf("got %d %q, want %d %q", code, report.Status, tt.wantCode, tt.wantStatus)
+			}
+			for name, result := range report.Checks {
+				if name == tt.wantFailed {
+					if result.Status != service.ReadinessFailed || !strings.Contains(result.Error, tt.wantError) {
+						t.Errorf("%s = %+v, want failed with %q", name, result, tt.wantError)
+					}
+				} else if result.Status != service.ReadinessOK || result.Error != "" {
+					t.Errorf("%s = %+v, want ok", name, result)
+				}
+			}
+			if len(report.Checks) != 2 {
+				t.Errorf("Checks = %v, want postgres and redis", report.Checks)
+			}
+		})
+	}
+}
+
+func TestLivezIgnoresDraining(t *testing.T) {
+	readiness := service.NewReadiness(time.Second)
+	readiness.SetDraining()
+
+	w := httptest.NewRecorder()
+	NewProbeHandler(readiness).Livez(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Livez status = %d while draining", w.Code)
+	}
+}
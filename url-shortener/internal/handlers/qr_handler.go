@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"image"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/qr"
+	"url-shortener/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+type QRHandler struct {
+	urlService    *service.URLService
+	domainService *service.DomainService
+	logo          image.Image
+}
+
+// NewQRHandler создает хендлер QR-кодов. logo может быть nil, тогда параметр ?logo игнорируется.
+func NewQRHandler(urlService *service.URLService, domainService *service.DomainService, logo image.Image) *QRHandler {
+	return &QRHandler{
+		urlService:    urlService,
+		domainService: domainService,
+		logo:          logo,
+	}
+}
+
+func (h *QRHandler) GetQRCode(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	shortCode := vars["shortCode"]
+
+	if shortCode == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Short code is required"})
+		return
+	}
+
+	opts, err := h.parseOptions(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	url, err := h.urlService.GetURL(r.Context(), getDomain(r), shortCode)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "URL not found"})
+		return
+	}
+
+	// Код, ведущий на неработающую ссылку, не отдается: его напечатают и разошлют
+	if reason, ok := unavailableReason(url); ok {
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(reason.Status)
+		json.NewEncoder(w).Encode(map[string]string{"error": reason.Title, "code": reason.Code})
+		return
+	}
+
+	// Маркер src=qr позволяет отличить сканы QR-кода от прямых переходов в аналитике
+	content := h.domainService.ShortURL(url) + "?" + sourceParam + "=" + models.ClickSourceQR
+
+	data, err := qr.Render(content, opts)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to render QR code"})
+		return
+	}
+
+	w.Header().Set("Content-Type", opts.ContentType())
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(qrMaxAge(url, time.Now())))
+	w.Write(data)
+}
+
+func (h *QRHandler) parseOptions(r *http.Request) (qr.Options, error) {
+	query := r.URL.Query()
+	opts := qr.DefaultOptions()
+
+	if format := query.Get("format"); format != "" {
+		opts.Format = strings.ToLower(format)
+	}
+
+	if ecc := query.Get("ecc"); ecc != "" {
+		opts.ECC = strings.ToUpper(ecc)
+	}
+
+	if size := query.Get("size"); size != "" {
+		value, err := strconv.Atoi(size)
+		if err != nil {
+			return opts, errInvalidParam("size")
+		}
+		opts.Size = value
+	}
+
+	if margin := query.Get("margin"); margin != "" {
+		value, err := strconv.Atoi(margin)
+		if err != nil {
+			return opts, errInvalidParam("margin")
+		}
+		opts.Margin = value
+	}
+
+	if fg := query.Get("fg"); fg != "" {
+		c, err := qr.ParseColor(fg)
+		if err != nil {
+			return opts, errInvalidParam("fg")
+		}
+		opts.Foreground = c
+	}
+
+	if bg := query.Get("bg"); bg != "" {
+		c, err := qr.ParseColor(bg)
+		if err != nil {
+			return opts, errInvalidParam("bg")
+		}
+		opts.Background = c
+	}
+
+	if logo, _ := strconv.ParseBool(query.Get("logo")); logo && h.logo != nil {
+		opts.Logo = h.logo
+	}
+
+	return opts, opts.Validate()
+}
+
+// qrMaxAgeLimit - сколько кэши могут отдавать код после отключения или удаления ссылки
+const qrMaxAgeLimit = 5 * time.Minute
+
+// qrMaxAge возвращает время жизни кода в кэшах в секундах: не дольше qrMaxAgeLimit
+// и не дольше ближайшего перехода ссылки по расписанию
+func qrMaxAge(url *models.URL, now time.Time) int {
+	maxAge := qrMaxAgeLimit
+	if next := url.NextTransition(now); !next.IsZero() {
+		maxAge = min(maxAge, next.Sub(now))
+	}
+	return int(maxAge.Seconds())
+}
+
+type errInvalidParam string
+
+func (e errInvalidParam) Error() string {
+	return "invalid " + string(e) + " parameter"
+}
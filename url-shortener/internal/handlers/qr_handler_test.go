@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+	"url-shortener/internal/models"
+)
+
+func TestUnavailableReason(t *testing.T) {
+	deletedAt := time.Now()
+
+	tests := []struct {
+		name string
+		url  models.URL
+		want fallbackReason
+		ok   bool
+	}{
+		{name: "active", url: models.URL{Phase: models.PhaseActive}},
+		{name: "deleted", url: models.URL{DeletedAt: &deletedAt}, want: reasonDeleted, ok: true},
+		{name: "disabled", url: models.URL{Disabled: true, Phase: models.PhaseActive}, want: reasonDisabled, ok: true},
+		{name: "expired", url: models.URL{Phase: models.PhaseExpired}, want: reasonExpired, ok: true},
+		{name: "pending looks missing", url: models.URL{Phase: models.PhasePending, PendingBehavior: models.PendingNotFound}, want: reasonNotFound, ok: true},
+		{name: "pending coming soon", url: models.URL{Phase: models.PhasePending, PendingBehavior: models.PendingComingSoon}, want: reasonPending, ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := unavailableReason(&tt.url)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("unavailableReason() = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestQRMaxAge(t *testing.T) {
+	now := time.Now()
+	soon := now.Add(90 * time.Second)
+	later := now.Add(24 * time.Hour)
+
+	tests := []struct {
+		name string
+		url  models.URL
+		want int
+	}{
+		{name: "no schedule", url: models.URL{}, want: int(qrMaxAgeLimit.Seconds())},
+		{name: "expires soon", url: models.URL{ActiveUntil: &soon}, want: 90},
+		{name: "expires later", url: models.URL{ActiveUntil: &later}, want: int(qrMaxAgeLimit.Seconds())},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := qrMaxAge(&tt.url, now); got != tt.want {
+				t.Errorf("qrMaxAge() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,23 +2,45 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+	"url-shortener/internal/models"
 	"url-shortener/internal/service"
 
 	"github.com/gorilla/mux"
 )
 
+const (
+	visitorCookieName   = "visitor_id"
+	visitorCookieMaxAge = 365 * 24 * 60 * 60
+	variantCookiePrefix = "variant_"
+
+	ownerHeader = "X-Owner-ID"
+	sourceParam = "src"
+	domainParam = "domain"
+)
+
 type URLHandler struct {
 	urlService    *service.URLService
 	workerService *service.WorkerService
+	domainService *service.DomainService
+	pages         *FallbackPages
 }
 
-func NewURLHandler(urlService *service.URLService, workerService *service.WorkerService) *URLHandler {
+func NewURLHandler(urlService *service.URLService, workerService *service.WorkerService, domainService *service.DomainService, pages *FallbackPages) *URLHandler {
 	return &URLHandler{
 		urlService:    urlService,
 		workerService: workerService,
+		domainService: domainService,
+		pages:         pages,
 	}
 }
 
@@ -37,7 +59,9 @@ func (h *URLHandler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var request struct {
-		URL string `json:"url"`
+		URL           string `json:"url"`
+		Domain        string `json:"domain"`
+		ReuseExisting bool   `json:"reuse_existing"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -52,22 +76,45 @@ func (h *URLHandler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	url, err := h.urlService.CreateShortURL(r.Context(), request.URL)
+	url, created, err := h.urlService.CreateShortURL(r.Context(), service.CreateURLParams{
+		OwnerID:       getOwnerID(r),
+		OriginalURL:   request.URL,
+		Domain:        service.NormalizeHost(request.Domain),
+		ReuseExisting: request.ReuseExisting,
+	})
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
+	// 201 - создана новая ссылка, 200 - возвращена существующая
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(map[string]string{
-		"short_url":    "http://localhost:8080/" + url.ShortCode,
+		"short_url":    h.domainService.ShortURL(url),
 		"original_url": url.OriginalURL,
 		"short_code":   url.ShortCode,
+		"domain":       url.Domain,
 	})
 }
 
+// buildDestination подставляет параметры запроса в адрес назначения. Если подстановка
+// не удалась, посетитель уходит на адрес без нее: ответ с ошибкой ему ничем не поможет
+func buildDestination(r *http.Request, destination string, url *models.URL) string {
+	built, err := service.BuildDestination(destination, url, passthroughRequest(r))
+	if err != nil {
+		slog.WarnContext(r.Context(), "failed to build destination, redirecting without passthrough", "short_code", url.ShortCode, "error", err)
+		return destination
+	}
+	return built
+}
+
 func (h *URLHandler) Redirect(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	shortCode := vars["shortCode"]
@@ -78,23 +125,436 @@ func (h *URLHandler) Redirect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	url, err := h.urlService.GetURL(r.Context(), shortCode)
+	domain := h.domainService.Resolve(r.Host)
+	url, err := h.urlService.GetURL(r.Context(), domain, shortCode)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"error": "URL not found"})
+		h.writeFallback(w, r, domain, reasonNotFound, fallbackPage{ShortCode: shortCode})
+		return
+	}
+
+	if reason, ok := unavailableReason(url); ok {
+		page := fallbackPage{ShortCode: shortCode}
+		switch reason {
+		case reasonDisabled:
+			page.Reason = url.DisabledReason
+		case reasonPending:
+			page.ActiveFrom = url.ActiveFrom
+		}
+		h.writeFallback(w, r, domain, reason, page)
+		return
+	}
+
+	// Боты превью не считаются кликами и не участвуют в A/B тесте
+	if isUnfurler(r) {
+		destination := buildDestination(r, url.Destination, url)
+		if url.HasPreview() {
+			writePreview(w, url, destination)
+			return
+		}
+		http.Redirect(w, r, destination, http.StatusFound)
 		return
 	}
 
+	destination := url.Destination
+	var variantID *int
+	if len(url.Variants) > 0 {
+		assigned := assignedVariant(r, url)
+		variant := service.ChooseVariant(url, visitorKey(w, r), assigned)
+		if variant != nil {
+			if variant.ID != assigned {
+				rememberVariant(w, url, variant.ID)
+			}
+			destination = variant.DestinationURL
+			variantID = &variant.ID
+		}
+	}
+
+	destination = buildDestination(r, destination, url)
+
 	// Асинхронная обработка клика через воркер
 	clickData := &service.ClickData{
 		URLID:     url.ID,
 		IPAddress: getIPAddress(r),
 		UserAgent: r.UserAgent(),
 		Referer:   r.Referer(),
+		VariantID: variantID,
+		Source:    clickSource(r),
+	}
+	h.workerService.ProcessClickAsync(r.Context(), clickData)
+
+	if launch := chooseAppLaunch(url, r.UserAgent(), destination); launch != nil {
+		writeAppLaunch(w, r, url, launch)
+		return
+	}
+
+	http.Redirect(w, r, destination, http.StatusFound)
+}
+
+// unavailableReason возвращает причину, по которой по ссылке сейчас нельзя перейти.
+// До активации ссылка по умолчанию неотличима от несуществующей, чтобы не раскрыть анонс.
+func unavailableReason(url *models.URL) (fallbackReason, bool) {
+	switch {
+	case url.IsDeleted():
+		return reasonDeleted, true
+	case url.Disabled:
+		return reasonDisabled, true
+	}
+
+	switch url.Phase {
+	case models.PhasePending:
+		if url.PendingBehavior == models.PendingComingSoon {
+			return reasonPending, true
+		}
+		return reasonNotFound, true
+	case models.PhaseExpired:
+		return reasonExpired, true
+	}
+	return fallbackReason{}, false
+}
+
+// writeFallback отдает заглушку с учетом настроек домена, на который пришел запрос
+func (h *URLHandler) writeFallback(w http.ResponseWriter, r *http.Request, domain string, reason fallbackReason, page fallbackPage) {
+	var settings *models.Domain
+	if d, ok := h.domainService.Lookup(domain); ok {
+		settings = &d
+	}
+
+	page.Host = r.Host
+	h.pages.Write(w, r, settings, reason, page)
+}
+
+func (h *URLHandler) UpdateURL(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	shortCode := vars["shortCode"]
+
+	if shortCode == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Short code is required"})
+		return
+	}
+
+	var request struct {
+		URL string `json:"url"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
+		return
 	}
-	h.workerService.ProcessClickAsync(clickData)
 
-	http.Redirect(w, r, url.OriginalURL, http.StatusFound)
+	url, err := h.urlService.UpdateURL(r.Context(), getOwnerID(r), getDomain(r), shortCode, request.URL)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "URL not found"})
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"short_code":   url.ShortCode,
+		"original_url": url.OriginalURL,
+	})
+}
+
+func (h *URLHandler) SetPreview(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	shortCode := vars["shortCode"]
+
+	var request struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Image       string `json:"image"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	url, err := h.urlService.SetPreview(r.Context(), getOwnerID(r), getDomain(r), shortCode, service.Preview{
+		Title:       request.Title,
+		Description: request.Description,
+		Image:       request.Image,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "URL not found"})
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"short_code": url.ShortCode,
+		"preview": map[string]string{
+			"title":       url.OGTitle,
+			"description": url.OGDescription,
+			"image":       url.OGImage,
+		},
+	})
+}
+
+func (h *URLHandler) SetDeepLinks(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	shortCode := vars["shortCode"]
+
+	var request struct {
+		IOS             string `json:"ios"`
+		IOSStoreURL     string `json:"ios_store_url"`
+		Android         string `json:"android"`
+		AndroidStoreURL string `json:"android_store_url"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	url, err := h.urlService.SetDeepLinks(r.Context(), getOwnerID(r), getDomain(r), shortCode, service.DeepLinks{
+		IOS:             request.IOS,
+		IOSStoreURL:     request.IOSStoreURL,
+		Android:         request.Android,
+		AndroidStoreURL: request.AndroidStoreURL,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "URL not found"})
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"short_code": url.ShortCode,
+		"deep_links": deepLinksResponse(url),
+	})
+}
+
+func (h *URLHandler) SetPassthrough(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	shortCode := vars["shortCode"]
+
+	var request struct {
+		Query string `json:"query"`
+		Path  bool   `json:"path"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	url, err := h.urlService.SetPassthrough(r.Context(), getOwnerID(r), getDomain(r), shortCode, request.Query, request.Path)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "URL not found"})
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"short_code":        url.ShortCode,
+		"query_passthrough": url.QueryPassthrough,
+		"path_passthrough":  url.PathPassthrough,
+	})
+}
+
+func (h *URLHandler) SetSchedule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	shortCode := vars["shortCode"]
+
+	var request struct {
+		ActiveFrom      *time.Time `json:"active_from"`
+		ActiveUntil     *time.Time `json:"active_until"`
+		PendingBehavior string     `json:"pending_behavior"`
+		Entries         []struct {
+			StartsAt time.Time `json:"starts_at"`
+			URL      string    `json:"url"`
+		} `json:"entries"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	entries := make([]models.URLScheduleEntry, 0, len(request.Entries))
+	for _, e := range request.Entries {
+		entries = append(entries, models.URLScheduleEntry{StartsAt: e.StartsAt, DestinationURL: e.URL})
+	}
+
+	url, err := h.urlService.SetSchedule(r.Context(), getOwnerID(r), getDomain(r), shortCode, service.Schedule{
+		ActiveFrom:      request.ActiveFrom,
+		ActiveUntil:     request.ActiveUntil,
+		PendingBehavior: request.PendingBehavior,
+		Entries:         entries,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "URL not found"})
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"short_code":  url.ShortCode,
+		"phase":       url.Phase,
+		"destination": url.Destination,
+		"schedule":    scheduleResponse(url),
+	})
+}
+
+func (h *URLHandler) DisableURL(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	shortCode := vars["shortCode"]
+
+	var request struct {
+		Reason string `json:"reason"`
+	}
+
+	// Тело запроса необязательно: причину можно не указывать
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
+			return
+		}
+	}
+
+	url, err := h.urlService.DisableURL(r.Context(), getOwnerID(r), getDomain(r), shortCode, request.Reason)
+	if err != nil {
+		writeURLError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"short_code": url.ShortCode,
+		"disabled":   url.Disabled,
+		"reason":     url.DisabledReason,
+	})
+}
+
+func (h *URLHandler) EnableURL(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	shortCode := vars["shortCode"]
+
+	url, err := h.urlService.EnableURL(r.Context(), getOwnerID(r), getDomain(r), shortCode)
+	if err != nil {
+		writeURLError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"short_code": url.ShortCode,
+		"disabled":   url.Disabled,
+	})
+}
+
+func (h *URLHandler) DeleteURL(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	shortCode := vars["shortCode"]
+
+	if err := h.urlService.DeleteURL(r.Context(), getOwnerID(r), getDomain(r), shortCode); err != nil {
+		writeURLError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *URLHandler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	shortCode := vars["shortCode"]
+
+	entries, err := h.urlService.GetAuditLog(r.Context(), getOwnerID(r), getDomain(r), shortCode)
+	if err != nil {
+		writeURLError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"short_code": shortCode,
+		"entries":    entries,
+	})
+}
+
+func (h *URLHandler) SetVariants(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	shortCode := vars["shortCode"]
+
+	if shortCode == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Short code is required"})
+		return
+	}
+
+	var request struct {
+		Variants []struct {
+			ID     int    `json:"id"` // Изменяемый вариант; без ID вариант сопоставляется по адресу
+			URL    string `json:"url"`
+			Weight int    `json:"weight"`
+		} `json:"variants"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	variants := make([]models.URLVariant, 0, len(request.Variants))
+	for _, v := range request.Variants {
+		variants = append(variants, models.URLVariant{ID: v.ID, DestinationURL: v.URL, Weight: v.Weight})
+	}
+
+	url, err := h.urlService.SetVariants(r.Context(), getOwnerID(r), getDomain(r), shortCode, variants)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "URL not found"})
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"short_code": url.ShortCode,
+		"variants":   url.Variants,
+	})
 }
 
 func (h *URLHandler) GetURLInfo(w http.ResponseWriter, r *http.Request) {
@@ -107,7 +567,7 @@ func (h *URLHandler) GetURLInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	url, err := h.urlService.GetURL(r.Context(), shortCode)
+	url, err := h.urlService.GetOwnedURL(r.Context(), getOwnerID(r), getDomain(r), shortCode)
 	if err != nil {
 		w.WriteHeader(http.StatusNotFound)
 		json.NewEncoder(w).Encode(map[string]string{"error": "URL not found"})
@@ -116,13 +576,144 @@ func (h *URLHandler) GetURLInfo(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
+		"short_url":    h.domainService.ShortURL(url),
 		"short_code":   url.ShortCode,
+		"domain":       url.Domain,
 		"original_url": url.OriginalURL,
 		"created_at":   url.CreatedAt,
 		"click_count":  url.ClickCount,
+		"disabled":     url.Disabled,
+		"reason":       url.DisabledReason,
+		"variants":     url.Variants,
+		"preview": map[string]string{
+			"title":       url.OGTitle,
+			"description": url.OGDescription,
+			"image":       url.OGImage,
+		},
+		"deep_links":  deepLinksResponse(url),
+		"phase":       url.Phase,
+		"destination": url.Destination,
+		"schedule":    scheduleResponse(url),
 	})
 }
 
+func deepLinksResponse(url *models.URL) map[string]string {
+	return map[string]string{
+		"ios":               url.IOSDeepLink,
+		"ios_store_url":     url.IOSStoreURL,
+		"android":           url.AndroidDeepLink,
+		"android_store_url": url.AndroidStoreURL,
+	}
+}
+
+func scheduleResponse(url *models.URL) map[string]interface{} {
+	return map[string]interface{}{
+		"active_from":      url.ActiveFrom,
+		"active_until":     url.ActiveUntil,
+		"pending_behavior": url.PendingBehavior,
+		"entries":          url.Schedule,
+	}
+}
+
+// writeURLError отвечает 404 для несуществующих или чужих ссылок и 500 для остальных ошибок
+func writeURLError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "URL not found"})
+		return
+	}
+
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]string{"error": "Internal server error"})
+}
+
+// visitorKey возвращает стабильный идентификатор посетителя для A/B теста.
+// Если cookie еще нет, используется отпечаток IP и User-Agent, который сохраняется в cookie.
+func visitorKey(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(visitorCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	sum := sha256.Sum256([]byte(getIPAddress(r) + "|" + r.UserAgent()))
+	key := hex.EncodeToString(sum[:8])
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     visitorCookieName,
+		Value:    key,
+		Path:     "/",
+		MaxAge:   visitorCookieMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return key
+}
+
+// variantCookieName - cookie с вариантом A/B теста, выданным посетителю на этой ссылке
+func variantCookieName(url *models.URL) string {
+	return variantCookiePrefix + strconv.Itoa(url.ID)
+}
+
+// assignedVariant возвращает ID варианта, выданного посетителю раньше, или 0
+func assignedVariant(r *http.Request, url *models.URL) int {
+	cookie, err := r.Cookie(variantCookieName(url))
+	if err != nil {
+		return 0
+	}
+	id, err := strconv.Atoi(cookie.Value)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// rememberVariant сохраняет выданный вариант, чтобы изменение весов не перевело посетителя
+// на другой. Cookie отправляется только на путь этой ссылки.
+func rememberVariant(w http.ResponseWriter, url *models.URL, variantID int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     variantCookieName(url),
+		Value:    strconv.Itoa(variantID),
+		Path:     "/" + url.ShortCode,
+		MaxAge:   visitorCookieMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clickSource определяет источник перехода по маркеру ?src=, который
+// добавляется, например, в ссылки внутри QR-кодов. Неизвестные значения игнорируются.
+func clickSource(r *http.Request) string {
+	if r.URL.Query().Get(sourceParam) == models.ClickSourceQR {
+		return models.ClickSourceQR
+	}
+	return models.ClickSourceDirect
+}
+
+// passthroughRequest собирает параметры и хвост пути запроса для передачи в адрес назначения.
+// Служебный маркер источника ?src= не передается.
+func passthroughRequest(r *http.Request) service.PassthroughRequest {
+	query := r.URL.Query()
+	query.Del(sourceParam)
+
+	return service.PassthroughRequest{
+		Query: query,
+		Path:  mux.Vars(r)["rest"],
+	}
+}
+
+// getOwnerID возвращает идентификатор владельца (арендатора), установленный OwnerAuthMiddleware.
+// Пустая строка соответствует анонимным ссылкам.
+func getOwnerID(r *http.Request) string {
+	ownerID, _ := r.Context().Value(ownerKey{}).(string)
+	return ownerID
+}
+
+// getDomain возвращает домен ссылки из параметра ?domain= для API управления.
+// Пустая строка соответствует домену по умолчанию.
+func getDomain(r *http.Request) string {
+	return service.NormalizeHost(r.URL.Query().Get(domainParam))
+}
+
 func getIPAddress(r *http.Request) string {
 	forwarded := r.Header.Get("X-Forwarded-For")
 	if forwarded != "" {
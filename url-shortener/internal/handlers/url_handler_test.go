@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"url-shortener/internal/models"
+)
+
+func TestBuildDestination(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		destination string
+		url         *models.URL
+		want        string
+	}{
+		{
+			name:        "passthrough applied",
+			target:      "/abc123?utm_source=sms",
+			destination: "https://example.com/page",
+			url:         &models.URL{ShortCode: "abc123", QueryPassthrough: models.QueryPassthroughMerge},
+			want:        "https://example.com/page?utm_source=sms",
+		},
+		{
+			name:        "failed substitution keeps the destination",
+			target:      "/abc123?sub=evil.example%2F",
+			destination: "https://{sub}example.com/page",
+			url:         &models.URL{ShortCode: "abc123", QueryPassthrough: models.QueryPassthroughMerge},
+			want:        "https://{sub}example.com/page",
+		},
+		{
+			name:        "no passthrough",
+			target:      "/abc123?utm_source=sms",
+			destination: "https://example.com/page",
+			url:         &models.URL{ShortCode: "abc123", QueryPassthrough: models.QueryPassthroughIgnore},
+			want:        "https://example.com/page",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if got := buildDestination(r, tt.destination, tt.url); got != tt.want {
+				t.Errorf("buildDestination() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"url-shortener/internal/models"
+	"url-shortener/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+type WebhookHandler struct {
+	webhookService *service.WebhookService
+}
+
+func NewWebhookHandler(webhookService *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		URL             string   `json:"url"`
+		Events          []string `json:"events"`
+		ClickThresholds []int    `json:"click_thresholds"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid JSON"})
+		return
+	}
+
+	webhook, err := h.webhookService.Register(r.Context(), getOwnerID(r), request.URL, request.Events, request.ClickThresholds)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Ключ подписи возвращается только при создании
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":               webhook.ID,
+		"url":              webhook.URL,
+		"events":           webhook.Events,
+		"click_thresholds": webhook.ClickThresholds,
+		"secret":           webhook.Secret,
+	})
+}
+
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.webhookService.List(r.Context(), getOwnerID(r))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to list webhooks"})
+		return
+	}
+
+	if webhooks == nil {
+		webhooks = []models.Webhook{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"webhooks": webhooks,
+	})
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.Delete(r.Context(), getOwnerID(r), webhookID); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhookID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	deliveries, err := h.webhookService.ListDeliveries(r.Context(), getOwnerID(r), webhookID)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deliveries": deliveries,
+	})
+}
+
+func (h *WebhookHandler) ListAttempts(w http.ResponseWriter, r *http.Request) {
+	webhookID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := pathID(w, r, "deliveryID")
+	if !ok {
+		return
+	}
+
+	attempts, err := h.webhookService.ListAttempts(r.Context(), getOwnerID(r), webhookID, deliveryID)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	if attempts == nil {
+		attempts = []models.WebhookAttempt{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"attempts": attempts,
+	})
+}
+
+func (h *WebhookHandler) ReplayDelivery(w http.ResponseWriter, r *http.Request) {
+	webhookID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := pathID(w, r, "deliveryID")
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.Replay(r.Context(), getOwnerID(r), webhookID, deliveryID); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// pathID читает числовой параметр пути и отвечает 400, если он некорректен
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)[name])
+	if err != nil || id <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid " + name})
+		return 0, false
+	}
+	return id, true
+}
+
+func writeWebhookError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Webhook not found"})
+		return
+	}
+
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]string{"error": "Internal server error"})
+}
@@ -0,0 +1,151 @@
+// Package metrics содержит метрики Prometheus сервиса и обработчик /metrics
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "url_shortener"
+
+// Registry - реестр метрик сервиса. Отдельный реестр вместо глобального, чтобы в /metrics
+// попадали только явно зарегистрированные метрики.
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template and method.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"route", "method"})
+
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache operations by operation and result (hit, miss, error, ok).",
+	}, []string{"op", "result"})
+
+	CacheCircuitOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_circuit_open",
+		Help:      "1 while the Redis circuit breaker is open and the cache is bypassed.",
+	})
+
+	LocalCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "local_cache_requests_total",
+		Help:      "In-process cache lookups by result (hit, miss).",
+	}, []string{"result"})
+
+	LocalCacheEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "local_cache_evictions_total",
+		Help:      "Entries evicted from the in-process cache to stay within its size.",
+	})
+
+	CodeFilterRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "code_filter_rejected_total",
+		Help:      "Lookups rejected by the short code Bloom filter without touching Redis or Postgres.",
+	})
+
+	ReplicaHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "db_replica_healthy",
+		Help:      "1 while the Postgres read replica passes health and lag checks and receives reads.",
+	}, []string{"replica"})
+
+	ReplicaLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "db_replica_lag_seconds",
+		Help:      "Replication lag of the Postgres read replica at the last health check.",
+	}, []string{"replica"})
+
+	ClicksDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "clicks_dropped_total",
+		Help:      "Clicks dropped because the click queue was full.",
+	})
+
+	ClickSaveDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "click_save_duration_seconds",
+		Help:      "Time a worker spends saving one click, by result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"})
+)
+
+// Результаты операций кэша
+const (
+	CacheHit = "hit"
+	// CacheNegativeHit - в кэше записано, что ссылки нет
+	CacheNegativeHit = "negative_hit"
+	CacheMiss        = "miss"
+	CacheError       = "error"
+	CacheOK          = "ok"
+	// CacheSkipped - запрос не выполнялся, потому что выключатель Redis разомкнут
+	CacheSkipped = "skipped"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		CacheRequests,
+		CacheCircuitOpen,
+		LocalCacheRequests,
+		LocalCacheEvictions,
+		CodeFilterRejected,
+		ReplicaHealthy,
+		ReplicaLag,
+		ClicksDropped,
+		ClickSaveDuration,
+	)
+}
+
+// RegisterDB публикует статистику пула соединений sql.DB
+func RegisterDB(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterQueue публикует текущую глубину и емкость очереди кликов
+func RegisterQueue(depth, capacity func() int) {
+	Registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "click_queue_depth",
+			Help:      "Clicks waiting in the worker queue.",
+		}, func() float64 { return float64(depth()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "click_queue_capacity",
+			Help:      "Capacity of the worker click queue.",
+		}, func() float64 { return float64(capacity()) }),
+	)
+}
+
+// RegisterLocalCache публикует число записей локального кэша
+func RegisterLocalCache(entries func() int) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "local_cache_entries",
+		Help:      "Entries currently held in the in-process cache.",
+	}, func() float64 { return float64(entries()) }))
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -0,0 +1,319 @@
+// Package migrate применяет SQL миграции схемы к Postgres. Файлы размечены в формате goose,
+// примененные версии хранятся в таблице schema_migrations.
+package migrate
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockKey - ключ advisory lock, который сериализует миграции между репликами приложения
+const lockKey = 7318964502214377
+
+const createVersionTable = `CREATE TABLE IF NOT EXISTS schema_migrations(
+    version BIGINT PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at TIMESTAMP NOT NULL DEFAULT now()
+)`
+
+var ErrNoMigrations = errors.New("no applied migrations to roll back")
+
+// Migration - одна миграция схемы
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// UpFunc - миграция данных на Go, выполняется вместо Up в той же транзакции.
+	// Нужна там, где преобразование нельзя выразить на SQL.
+	UpFunc func(ctx context.Context, tx *sql.Tx) error
+}
+
+// Status - состояние миграции в базе
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New читает миграции из fsys, добавляет к ним миграции на Go и возвращает мигратор для db
+func New(db *sql.DB, fsys fs.FS, goMigrations ...Migration) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, migration := range goMigrations {
+		for _, other := range migrations {
+			if other.Version == migration.Version {
+				return nil, fmt.Errorf("migrations %d_%s and %d_%s share version %d",
+					other.Version, other.Name, migration.Version, migration.Name, migration.Version)
+			}
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Load читает файлы <version>_<name>.sql из корня fsys, упорядочивая их по версии
+func Load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := make(map[int64]string)
+	for _, name := range names {
+		versionPart, rest, ok := strings.Cut(strings.TrimSuffix(path.Base(name), ".sql"), "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: file name must be <version>_<name>.sql", name)
+		}
+		version, err := strconv.ParseInt(versionPart, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", name, err)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, name, version)
+		}
+		seen[version] = name
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		up, down, err := parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", name, err)
+		}
+
+		migrations = append(migrations, Migration{Version: version, Name: rest, Up: up, Down: down})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// parse делит файл на разделы "-- +goose Up" и "-- +goose Down".
+// Маркеры StatementBegin/StatementEnd не нужны: раздел выполняется одним запросом.
+func parse(data string) (up, down string, err error) {
+	var upBuf, downBuf strings.Builder
+	var current *strings.Builder
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if directive, ok := strings.CutPrefix(strings.TrimSpace(line), "-- +goose "); ok {
+			switch strings.TrimSpace(directive) {
+			case "Up":
+				current = &upBuf
+			case "Down":
+				current = &downBuf
+			case "StatementBegin", "StatementEnd":
+			default:
+				return "", "", fmt.Errorf("unsupported directive %q", directive)
+			}
+			continue
+		}
+		if current != nil {
+			current.WriteString(line)
+			current.WriteByte('\n')
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+
+	up = strings.TrimSpace(upBuf.String())
+	if up == "" {
+		return "", "", errors.New("missing -- +goose Up section")
+	}
+	return up, strings.TrimSpace(downBuf.String()), nil
+}
+
+// withLock выполняет fn на отдельном соединении под advisory lock, чтобы реплики,
+// стартующие одновременно, не применяли одну миграцию дважды
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		// Блокировка сессионная: если ее не удалось снять, соединение закрывается, а не возвращается в пул
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey); err != nil {
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, createVersionTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func applied(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	versions := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+
+	return versions, rows.Err()
+}
+
+// apply выполняет script (или fn для миграции на Go) и меняет запись в schema_migrations в одной транзакции
+func apply(ctx context.Context, conn *sql.Conn, script string, fn func(context.Context, *sql.Tx) error, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if fn != nil {
+		if err := fn(ctx, tx); err != nil {
+			return err
+		}
+	} else if script != "" {
+		if _, err := tx.ExecContext(ctx, script); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Up применяет все непримененные миграции и возвращает их
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+			if err := apply(ctx, conn, migration.Up, migration.UpFunc,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name); err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+
+	return done, err
+}
+
+// Down откатывает последнюю примененную миграцию
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	var rolledBack *Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := versions[migration.Version]; !ok {
+				continue
+			}
+			if err := apply(ctx, conn, migration.Down, nil,
+				`DELETE FROM schema_migrations WHERE version = $1`, migration.Version); err != nil {
+				return fmt.Errorf("rollback of %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			rolledBack = &migration
+			return nil
+		}
+		return ErrNoMigrations
+	})
+
+	return rolledBack, err
+}
+
+// Baseline отмечает миграции до version включительно как примененные, не выполняя их.
+// Нужен для баз, схема которых была создана до появления schema_migrations.
+func (m *Migrator) Baseline(ctx context.Context, version int64) (int, error) {
+	marked := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			result, err := conn.ExecContext(ctx,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2) ON CONFLICT (version) DO NOTHING`,
+				migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("failed to mark %d_%s as applied: %w", migration.Version, migration.Name, err)
+			}
+			if n, err := result.RowsAffected(); err == nil {
+				marked += int(n)
+			}
+		}
+		return nil
+	})
+
+	return marked, err
+}
+
+// Status возвращает все известные миграции с временем применения
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := Status{Version: migration.Version, Name: migration.Name}
+			if appliedAt, ok := versions[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+
+	return statuses, err
+}
@@ -0,0 +1,537 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		up      string
+		down    string
+		wantErr string
+	}{
+		{
+			name: "up and down",
+			data: "-- +goose Up\nCREATE TABLE t(id INT);\n\n-- +goose Down\nDROP TABLE t;\n",
+			up:   "CREATE TABLE t(id INT);",
+			down: "DROP TABLE t;",
+		},
+		{
+			name: "up only",
+			data: "-- +goose Up\nALTER TABLE t ADD COLUMN x INT;\n",
+			up:   "ALTER TABLE t ADD COLUMN x INT;",
+		},
+		{
+			name: "text before up is ignored",
+			data: "-- комментарий к файлу\n-- +goose Up\nSELECT 1;\n",
+			up:   "SELECT 1;",
+		},
+		{
+			name: "statement markers are dropped",
+			data: "-- +goose Up\n-- +goose StatementBegin\nCREATE FUNCTION f() RETURNS INT AS $$ SELECT 1; $$ LANGUAGE sql;\n-- +goose StatementEnd\n-- +goose Down\nDROP FUNCTION f;\n",
+			up:   "CREATE FUNCTION f() RETURNS INT AS $$ SELECT 1; $$ LANGUAGE sql;",
+			down: "DROP FUNCTION f;",
+		},
+		{
+			name: "indented directives and CRLF",
+			data: "  -- +goose Up\r\nSELECT 1;\r\n  -- +goose Down\r\nSELECT 2;\r\n",
+			up:   "SELECT 1;",
+			down: "SELECT 2;",
+		},
+		{
+			name:    "missing up",
+			data:    "-- +goose Down\nDROP TABLE t;\n",
+			wantErr: "missing -- +goose Up section",
+		},
+		{
+			name:    "empty up",
+			data:    "-- +goose Up\n\n-- +goose Down\nDROP TABLE t;\n",
+			wantErr: "missing -- +goose Up section",
+		},
+		{
+			name:    "unsupported directive",
+			data:    "-- +goose NO TRANSACTION\n-- +goose Up\nSELECT 1;\n",
+			wantErr: "unsupported directive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			up, down, err := parse(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if up != tt.up {
+				t.Errorf("up = %q, want %q", up, tt.up)
+			}
+			if down != tt.down {
+				t.Errorf("down = %q, want %q", down, tt.down)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	const body = "-- +goose Up\nSELECT 1;\n"
+
+	tests := []struct {
+		name     string
+		files    fstest.MapFS
+		versions []int64
+		wantErr  string
+	}{
+		{
+			name: "sorted by version",
+			files: fstest.MapFS{
+				"20251102120000_second.sql": {Data: []byte(body)},
+				"20251101120000_first.sql":  {Data: []byte(body)},
+				"README.md":                 {Data: []byte("not a migration")},
+			},
+			versions: []int64{20251101120000, 20251102120000},
+		},
+		{
+			name:    "name without version",
+			files:   fstest.MapFS{"create.sql": {Data: []byte(body)}},
+			wantErr: "file name must be",
+		},
+		{
+			name:    "version is not a number",
+			files:   fstest.MapFS{"v1_create.sql": {Data: []byte(body)}},
+			wantErr: "invalid version",
+		},
+		{
+			name: "duplicate version",
+			files: fstest.MapFS{
+				"1_a.sql":  {Data: []byte(body)},
+				"01_b.sql": {Data: []byte(body)},
+			},
+			wantErr: "share version 1",
+		},
+		{
+			name:    "parse error names the file",
+			files:   fstest.MapFS{"1_broken.sql": {Data: []byte("SELECT 1;")}},
+			wantErr: "migration 1_broken.sql",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := Load(tt.files)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var versions []int64
+			for _, m := range migrations {
+				versions = append(versions, m.Version)
+			}
+			if !equalVersions(versions, tt.versions) {
+				t.Errorf("versions = %v, want %v", versions, tt.versions)
+			}
+		})
+	}
+}
+
+func TestNewRejectsDuplicateGoMigration(t *testing.T) {
+	files := fstest.MapFS{"1_create.sql": {Data: []byte("-- +goose Up\nSELECT 1;\n")}}
+
+	_, err := New(nil, files, Migration{Version: 1, Name: "backfill"})
+	if err == nil || !strings.Contains(err.Error(), "share version 1") {
+		t.Fatalf("err = %v, want duplicate version error", err)
+	}
+
+	m, err := New(nil, files, Migration{Version: 0, Name: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.migrations[0].Name != "first" {
+		t.Errorf("Go migration is not sorted by version: %v", m.migrations)
+	}
+}
+
+func TestUpConcurrentMigratorsApplyOnce(t *testing.T) {
+	db, state := openFakeDB()
+	defer db.Close()
+
+	files := fstest.MapFS{
+		"1_a.sql": {Data: []byte("-- +goose Up\nSCRIPT a\n-- +goose Down\nSCRIPT undo a\n")},
+		"2_b.sql": {Data: []byte("-- +goose Up\nSCRIPT b\n")},
+		"3_c.sql": {Data: []byte("-- +goose Up\nSCRIPT c\n")},
+	}
+
+	const instances = 4
+	var wg sync.WaitGroup
+	applied := make([]int, instances)
+	errs := make([]error, instances)
+	for i := 0; i < instances; i++ {
+		m, err := New(db, files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			done, err := m.Up(context.Background())
+			applied[i], errs[i] = len(done), err
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for i := range applied {
+		if errs[i] != nil {
+			t.Fatalf("instance %d: %v", i, errs[i])
+		}
+		total += applied[i]
+	}
+	if total != 3 {
+		t.Errorf("instances applied %d migrations in total, want 3", total)
+	}
+	if got := strings.Join(state.scripts, ","); got != "SCRIPT a,SCRIPT b,SCRIPT c" {
+		t.Errorf("scripts = %q, want each migration once in order", got)
+	}
+	if state.maxHolders != 1 {
+		t.Errorf("%d sessions held the migration lock at once", state.maxHolders)
+	}
+}
+
+func TestUpFailedMigrationIsNotRecorded(t *testing.T) {
+	db, state := openFakeDB()
+	defer db.Close()
+
+	files := fstest.MapFS{
+		"1_a.sql": {Data: []byte("-- +goose Up\nSCRIPT a\n")},
+		"2_b.sql": {Data: []byte("-- +goose Up\nFAIL b\n")},
+	}
+	m, err := New(db, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := m.Up(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "migration 2_b failed") {
+		t.Fatalf("err = %v, want failure of 2_b", err)
+	}
+	if len(done) != 1 {
+		t.Errorf("applied %d migrations, want 1", len(done))
+	}
+	if _, ok := state.versions[2]; ok {
+		t.Error("failed migration recorded in schema_migrations")
+	}
+	if state.holder != nil {
+		t.Error("migration lock is still held")
+	}
+}
+
+func TestLockReleasedWhenUnlockFails(t *testing.T) {
+	db, state := openFakeDB()
+	defer db.Close()
+	state.failUnlock = true
+
+	files := fstest.MapFS{"1_a.sql": {Data: []byte("-- +goose Up\nSCRIPT a\n")}}
+	m, err := New(db, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Соединение с неснятой блокировкой не должно вернуться в пул: закрытие сессии снимает ее
+	if state.closed != 1 {
+		t.Errorf("closed %d connections, want the locked one discarded", state.closed)
+	}
+
+	state.failUnlock = false
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := m.Status(ctx); err != nil {
+		t.Fatalf("lock is stuck after failed unlock: %v", err)
+	}
+}
+
+func TestLockWaitRespectsContext(t *testing.T) {
+	db, state := openFakeDB()
+	defer db.Close()
+
+	m, err := New(db, fstest.MapFS{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Блокировку держит другой экземпляр
+	state.holder = &fakeConn{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = m.Up(ctx)
+	if err == nil || !strings.Contains(err.Error(), "failed to acquire migration lock") {
+		t.Fatalf("err = %v, want lock acquisition error", err)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	db, state := openFakeDB()
+	defer db.Close()
+
+	files := fstest.MapFS{
+		"1_a.sql": {Data: []byte("-- +goose Up\nSCRIPT a\n")},
+		"2_b.sql": {Data: []byte("-- +goose Up\nSCRIPT b\n")},
+		"3_c.sql": {Data: []byte("-- +goose Up\nSCRIPT c\n")},
+	}
+	m, err := New(db, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marked, err := m.Baseline(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marked != 2 {
+		t.Errorf("marked %d migrations, want 2", marked)
+	}
+
+	done, err := m.Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 1 || done[0].Version != 3 {
+		t.Errorf("Up after baseline applied %v, want only version 3", done)
+	}
+	if got := strings.Join(state.scripts, ","); got != "SCRIPT c" {
+		t.Errorf("scripts = %q, want only SCRIPT c", got)
+	}
+}
+
+func equalVersions(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fakeState - база, которую видят все соединения фейкового драйвера. Она понимает
+// только запросы мигратора: advisory lock, schema_migrations и скрипты "SCRIPT"/"FAIL".
+type fakeState struct {
+	mu         sync.Mutex
+	released   *sync.Cond
+	holder     *fakeConn
+	holders    int
+	maxHolders int
+	versions   map[int64]time.Time
+	scripts    []string
+	failUnlock bool
+	closed     int
+}
+
+func openFakeDB() (*sql.DB, *fakeState) {
+	state := &fakeState{versions: make(map[int64]time.Time)}
+	state.released = sync.NewCond(&state.mu)
+	return sql.OpenDB(fakeConnector{state: state}), state
+}
+
+type fakeConnector struct{ state *fakeState }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{state: c.state}, nil
+}
+
+func (c fakeConnector) Driver() driver.Driver { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return nil, errors.New("use the connector") }
+
+type fakeConn struct {
+	state *fakeState
+	tx    *fakeTx
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	c.tx = &fakeTx{conn: c}
+	return c.tx, nil
+}
+
+// Close завершает сессию: как и в Postgres, сессионная блокировка при этом снимается
+func (c *fakeConn) Close() error {
+	s := c.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed++
+	if s.holder == c {
+		s.release()
+	}
+	return nil
+}
+
+func (s *fakeState) release() {
+	s.holder = nil
+	s.holders--
+	s.released.Broadcast()
+}
+
+func (c *fakeConn) lock(ctx context.Context) error {
+	s := c.state
+	stop := context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		s.released.Broadcast()
+		s.mu.Unlock()
+	})
+	defer stop()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.holder != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s.released.Wait()
+	}
+	s.holder = c
+	s.holders++
+	s.maxHolders = max(s.maxHolders, s.holders)
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	s := c.state
+	switch {
+	case strings.HasPrefix(query, "SELECT pg_advisory_lock"):
+		return driver.ResultNoRows, c.lock(ctx)
+	case strings.HasPrefix(query, "SELECT pg_advisory_unlock"):
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.failUnlock {
+			return nil, errors.New("connection reset")
+		}
+		if s.holder == c {
+			s.release()
+		}
+		return driver.ResultNoRows, nil
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS schema_migrations"):
+		return driver.ResultNoRows, nil
+	case strings.HasPrefix(query, "INSERT INTO schema_migrations"):
+		version := args[0].Value.(int64)
+		s.mu.Lock()
+		_, exists := s.versions[version]
+		s.mu.Unlock()
+		if exists {
+			if strings.Contains(query, "ON CONFLICT") {
+				return driver.RowsAffected(0), nil
+			}
+			return nil, errors.New("duplicate key value violates unique constraint")
+		}
+		c.do(func() { s.versions[version] = time.Now() })
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(query, "DELETE FROM schema_migrations"):
+		version := args[0].Value.(int64)
+		c.do(func() { delete(s.versions, version) })
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(query, "SCRIPT"):
+		c.do(func() { s.scripts = append(s.scripts, query) })
+		return driver.ResultNoRows, nil
+	default:
+		return nil, errors.New("syntax error: " + query)
+	}
+}
+
+// do выполняет изменение сразу или при фиксации открытой транзакции
+func (c *fakeConn) do(fn func()) {
+	if c.tx != nil {
+		c.tx.ops = append(c.tx.ops, fn)
+		return
+	}
+	c.state.mu.Lock()
+	fn()
+	c.state.mu.Unlock()
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if !strings.HasPrefix(query, "SELECT version, applied_at FROM schema_migrations") {
+		return nil, errors.New("unexpected query: " + query)
+	}
+
+	s := c.state
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := &fakeRows{}
+	for version, appliedAt := range s.versions {
+		rows.values = append(rows.values, []driver.Value{version, appliedAt})
+	}
+	return rows, nil
+}
+
+type fakeTx struct {
+	conn *fakeConn
+	ops  []func()
+}
+
+func (tx *fakeTx) Commit() error {
+	s := tx.conn.state
+	s.mu.Lock()
+	for _, op := range tx.ops {
+		op()
+	}
+	s.mu.Unlock()
+	tx.conn.tx = nil
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.conn.tx = nil
+	return nil
+}
+
+type fakeRows struct {
+	values [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return []string{"version", "applied_at"} }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
@@ -1,17 +1,179 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
 // URL представляет основную сущность - сокращенную ссылку
 type URL struct {
-	ID          int       `json:"id" db:"id"`
-	OriginalURL string    `json:"original_url" db:"original_url"`
-	ShortCode   string    `json:"short_code" db:"short_code"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
-	ClickCount  int       `json:"click_count" db:"click_count"`
+	ID             int          `json:"id" db:"id"`
+	OwnerID        string       `json:"owner_id" db:"owner_id"` // Владелец ссылки (арендатор)
+	Domain         string       `json:"domain" db:"domain"`     // Брендированный домен, пустой - домен по умолчанию
+	OriginalURL    string       `json:"original_url" db:"original_url"`
+	CanonicalURL   string       `json:"canonical_url" db:"canonical_url"` // Каноническая форма адреса для дедупликации
+	CanonicalHash  string       `json:"-" db:"canonical_hash"`            // SHA-256 канонической формы
+	ShortCode      string       `json:"short_code" db:"short_code"`
+	CreatedAt      time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at" db:"updated_at"`
+	ClickCount     int          `json:"click_count" db:"click_count"`
+	Disabled       bool         `json:"disabled" db:"disabled"`                         // Ссылка отключена и не выполняет редирект
+	DisabledReason string       `json:"disabled_reason,omitempty" db:"disabled_reason"` // Причина отключения
+	DeletedAt      *time.Time   `json:"deleted_at,omitempty" db:"deleted_at"`           // Время мягкого удаления
+	OGTitle        string       `json:"og_title,omitempty" db:"og_title"`               // Заголовок превью для мессенджеров
+	OGDescription  string       `json:"og_description,omitempty" db:"og_description"`   // Описание превью
+	OGImage        string       `json:"og_image,omitempty" db:"og_image"`               // Адрес картинки превью
+	Variants       []URLVariant `json:"variants,omitempty"`                             // Варианты назначения для A/B теста
+
+	IOSDeepLink     string `json:"ios_deep_link,omitempty" db:"ios_deep_link"`         // URI, открывающий приложение на iOS
+	IOSStoreURL     string `json:"ios_store_url,omitempty" db:"ios_store_url"`         // App Store, если приложение не установлено
+	AndroidDeepLink string `json:"android_deep_link,omitempty" db:"android_deep_link"` // URI, открывающий приложение на Android
+	AndroidStoreURL string `json:"android_store_url,omitempty" db:"android_store_url"` // Google Play, если приложение не установлено
+
+	QueryPassthrough string `json:"query_passthrough" db:"query_passthrough"` // Как передавать параметры запроса в адрес назначения
+	PathPassthrough  bool   `json:"path_passthrough" db:"path_passthrough"`   // Добавлять путь после кода к адресу назначения
+
+	ActiveFrom      *time.Time         `json:"active_from,omitempty" db:"active_from"`   // До этого момента ссылка не выполняет редирект
+	ActiveUntil     *time.Time         `json:"active_until,omitempty" db:"active_until"` // После этого момента ссылка считается истекшей
+	PendingBehavior string             `json:"pending_behavior" db:"pending_behavior"`   // Ответ до активации: not_found или coming_soon
+	Schedule        []URLScheduleEntry `json:"schedule,omitempty"`                       // Смена адреса назначения по расписанию
+	Phase           string             `json:"phase,omitempty"`                          // Состояние по расписанию на момент загрузки
+	Destination     string             `json:"destination,omitempty"`                    // Адрес назначения по расписанию на момент загрузки, в базе не хранится
+}
+
+// URLScheduleEntry - адрес назначения, который действует начиная с StartsAt
+type URLScheduleEntry struct {
+	ID             int       `json:"id" db:"id"`
+	URLID          int       `json:"url_id" db:"url_id"`
+	StartsAt       time.Time `json:"starts_at" db:"starts_at"`
+	DestinationURL string    `json:"destination_url" db:"destination_url"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// ShortCodeRef - выданный короткий код без остальных полей ссылки
+type ShortCodeRef struct {
+	ID        int    `json:"id" db:"id"`
+	Domain    string `json:"domain" db:"domain"`
+	ShortCode string `json:"short_code" db:"short_code"`
+}
+
+// Поведение ссылки до активации
+const (
+	PendingNotFound   = "not_found"   // Ссылка неотличима от несуществующей
+	PendingComingSoon = "coming_soon" // Показывается страница "скоро"
+)
+
+// Состояния ссылки по расписанию
+const (
+	PhaseActive  = ""
+	PhasePending = "pending"
+	PhaseExpired = "expired"
+)
+
+// Режимы передачи параметров запроса короткой ссылки в адрес назначения
+const (
+	QueryPassthroughIgnore   = "ignore"   // Параметры запроса отбрасываются
+	QueryPassthroughMerge    = "merge"    // Добавляются параметры, которых нет в адресе назначения
+	QueryPassthroughOverride = "override" // Параметры запроса заменяют одноименные параметры назначения
+)
+
+// Domain - брендированный домен коротких ссылок (например, go.acme.com), принадлежащий арендатору
+type Domain struct {
+	ID               int       `json:"id" db:"id"`
+	Hostname         string    `json:"hostname" db:"hostname"`
+	OwnerID          string    `json:"owner_id" db:"owner_id"`
+	FallbackMode     string    `json:"fallback_mode" db:"fallback_mode"`                   // Что показывать браузеру для ненайденных и отключенных ссылок
+	FallbackURL      string    `json:"fallback_url,omitempty" db:"fallback_url"`           // Адрес для режима redirect
+	FallbackTemplate string    `json:"fallback_template,omitempty" db:"fallback_template"` // Имя шаблона для режима template
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+}
+
+// DomainClaim - заявка на домен, которая ждет подтверждения владения записью TXT
+type DomainClaim struct {
+	ID        int       `json:"id" db:"id"`
+	Hostname  string    `json:"hostname" db:"hostname"`
+	OwnerID   string    `json:"owner_id" db:"owner_id"`
+	Token     string    `json:"verification_token" db:"token"` // Значение, которое владелец публикует в TXT
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Режимы страницы-заглушки домена
+const (
+	FallbackModePage     = "page"     // Встроенная страница
+	FallbackModeRedirect = "redirect" // Редирект на домашнюю страницу
+	FallbackModeTemplate = "template" // Брендированный шаблон с диска
+)
+
+// URLVariant представляет один из вариантов назначения короткой ссылки с весом для A/B теста
+type URLVariant struct {
+	ID             int       `json:"id" db:"id"`
+	URLID          int       `json:"url_id" db:"url_id"`
+	DestinationURL string    `json:"destination_url" db:"destination_url"`
+	Weight         int       `json:"weight" db:"weight"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// IsDeleted сообщает, была ли ссылка удалена. Код удаленной ссылки повторно не выдается.
+func (u *URL) IsDeleted() bool {
+	return u.DeletedAt != nil
+}
+
+// HasPreview сообщает, задано ли для ссылки собственное превью Open Graph
+func (u *URL) HasPreview() bool {
+	return u.OGTitle != "" || u.OGDescription != "" || u.OGImage != ""
+}
+
+// HasPassthrough сообщает, что ссылка передает в адрес назначения параметры или путь запроса
+func (u *URL) HasPassthrough() bool {
+	return u.PathPassthrough || (u.QueryPassthrough != "" && u.QueryPassthrough != QueryPassthroughIgnore)
+}
+
+// PhaseAt возвращает состояние ссылки по расписанию в момент t
+func (u *URL) PhaseAt(t time.Time) string {
+	if u.ActiveFrom != nil && t.Before(*u.ActiveFrom) {
+		return PhasePending
+	}
+	if u.ActiveUntil != nil && !t.Before(*u.ActiveUntil) {
+		return PhaseExpired
+	}
+	return PhaseActive
+}
+
+// DestinationAt возвращает адрес назначения, действующий в момент t: последний наступивший
+// пункт расписания или OriginalURL, если расписания нет или оно еще не началось
+func (u *URL) DestinationAt(t time.Time) string {
+	destination := u.OriginalURL
+	var latest time.Time
+	for _, entry := range u.Schedule {
+		if !entry.StartsAt.After(t) && !entry.StartsAt.Before(latest) {
+			destination = entry.DestinationURL
+			latest = entry.StartsAt
+		}
+	}
+	return destination
+}
+
+// NextTransition возвращает ближайший после t момент, когда меняется состояние или
+// адрес назначения ссылки. Нулевое время означает, что переходов больше нет.
+func (u *URL) NextTransition(t time.Time) time.Time {
+	var next time.Time
+	consider := func(at time.Time) {
+		if at.After(t) && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+
+	if u.ActiveFrom != nil {
+		consider(*u.ActiveFrom)
+	}
+	if u.ActiveUntil != nil {
+		consider(*u.ActiveUntil)
+	}
+	for _, entry := range u.Schedule {
+		consider(entry.StartsAt)
+	}
+
+	return next
 }
 
 // Click представляет запись о каждом переходе по короткой ссылке
@@ -21,6 +183,8 @@ type Click struct {
 	IPAddress string    `json:"ip_address" db:"ip_address"`
 	UserAgent string    `json:"user_agent" db:"user_agent"`
 	Referer   string    `json:"referer" db:"referer"`
+	VariantID *int      `json:"variant_id,omitempty" db:"variant_id"` // Выбранный вариант A/B теста, если есть
+	Source    string    `json:"source" db:"source"`                   // Источник перехода (qr для сканов QR-кода)
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
@@ -30,6 +194,8 @@ type Analytics struct {
 	DailyClicks []DailyClick   `json:"daily_clicks"` // Статистика по дням
 	Referrers   []ReferrerStat `json:"referrers"`    // Статистика по источникам переходов
 	Browsers    []BrowserStat  `json:"browsers"`     // Статистика по браузерам
+	Variants    []VariantStat  `json:"variants"`     // Статистика по вариантам A/B теста
+	Sources     []SourceStat   `json:"sources"`      // Статистика по источникам (прямой переход, QR-код)
 }
 
 // DailyClick представляет количество кликов за конкретный день
@@ -51,3 +217,145 @@ type BrowserStat struct {
 	Version string `json:"version"` // Версия браузера ("91.0", "89.0")
 	Count   int    `json:"count"`   // Количество переходов с этого браузера
 }
+
+// Источники перехода, которые сохраняются в Click.Source
+const (
+	ClickSourceDirect = ""
+	ClickSourceQR     = "qr"
+)
+
+// SourceStat представляет количество переходов из конкретного источника
+type SourceStat struct {
+	Source string `json:"source"` // direct или qr
+	Count  int    `json:"count"`  // Количество переходов из этого источника
+}
+
+// VariantStat представляет количество переходов на конкретный вариант A/B теста
+type VariantStat struct {
+	VariantID      int    `json:"variant_id"`      // ID варианта
+	DestinationURL string `json:"destination_url"` // Адрес назначения варианта
+	Weight         int    `json:"weight"`          // Вес варианта
+	Count          int    `json:"count"`           // Количество переходов на этот вариант
+	Retired        bool   `json:"retired"`         // Вариант убран из теста, клики по нему сохранены
+}
+
+// Действия, которые записываются в журнал аудита
+const (
+	AuditActionCreate   = "create"
+	AuditActionUpdate   = "update"
+	AuditActionVariants = "set_variants"
+	AuditActionPreview  = "set_preview"
+	AuditActionDeepLink = "set_deep_links"
+	AuditActionPassthru = "set_passthrough"
+	AuditActionSchedule = "set_schedule"
+	AuditActionDisable  = "disable"
+	AuditActionEnable   = "enable"
+	AuditActionDelete   = "delete"
+)
+
+// AuditEntry представляет запись журнала аудита: кто, что и когда изменил в ссылке
+type AuditEntry struct {
+	ID        int                    `json:"id" db:"id"`
+	URLID     int                    `json:"url_id" db:"url_id"`
+	Actor     string                 `json:"actor" db:"actor"`     // Владелец или системный процесс, выполнивший изменение
+	Action    string                 `json:"action" db:"action"`   // Тип изменения (create, update, disable, ...)
+	Changes   map[string]interface{} `json:"changes" db:"changes"` // Измененные поля и их новые значения
+	CreatedAt time.Time              `json:"created_at" db:"created_at"`
+}
+
+// URLHealth содержит результат последней проверки доступности адреса назначения
+type URLHealth struct {
+	URLID               int       `json:"url_id" db:"url_id"`
+	ShortCode           string    `json:"short_code" db:"short_code"`
+	OriginalURL         string    `json:"original_url" db:"original_url"`
+	Healthy             bool      `json:"healthy" db:"healthy"`                           // Адрес отвечает статусом ниже 400
+	StatusCode          int       `json:"status_code,omitempty" db:"status_code"`         // HTTP статус последнего ответа
+	LatencyMS           int64     `json:"latency_ms" db:"latency_ms"`                     // Время ответа в миллисекундах
+	FinalURL            string    `json:"final_url,omitempty" db:"final_url"`             // Адрес после всех редиректов
+	Error               string    `json:"error,omitempty" db:"error"`                     // Ошибка соединения, если ответа не было
+	ConsecutiveFailures int       `json:"consecutive_failures" db:"consecutive_failures"` // Число неудачных проверок подряд
+	CheckedAt           time.Time `json:"checked_at" db:"checked_at"`
+}
+
+// Виды аномалий кликов
+const (
+	AlertKindSpike = "spike" // Резкий рост числа переходов
+	AlertKindDrop  = "drop"  // Переходы прекратились
+	AlertKindAbuse = "abuse" // Превышен порог злоупотребления, ссылка может быть отключена
+)
+
+// Alert - аномалия числа переходов по ссылке относительно ее обычного уровня
+type Alert struct {
+	ID             int       `json:"id" db:"id"`
+	URLID          int       `json:"url_id" db:"url_id"`
+	OwnerID        string    `json:"owner_id" db:"owner_id"`
+	ShortCode      string    `json:"short_code" db:"short_code"`
+	Domain         string    `json:"domain,omitempty" db:"domain"`
+	Kind           string    `json:"kind" db:"kind"`
+	Clicks         int       `json:"clicks" db:"clicks"`                   // Переходы за последнее окно
+	BaselineMean   float64   `json:"baseline_mean" db:"baseline_mean"`     // Среднее по предыдущим окнам
+	BaselineStdDev float64   `json:"baseline_stddev" db:"baseline_stddev"` // Стандартное отклонение по предыдущим окнам
+	ZScore         float64   `json:"z_score" db:"z_score"`
+	AutoDisabled   bool      `json:"auto_disabled" db:"auto_disabled"` // Ссылка была отключена автоматически
+	WindowStart    time.Time `json:"window_start" db:"window_start"`   // Начало окна, в котором поднято оповещение
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// События, на которые можно подписать вебхук
+const (
+	EventLinkCreated        = "link.created"
+	EventLinkUpdated        = "link.updated"
+	EventLinkDisabled       = "link.disabled"
+	EventLinkEnabled        = "link.enabled"
+	EventLinkDeleted        = "link.deleted"
+	EventLinkExpired        = "link.expired"
+	EventLinkClickThreshold = "link.click_threshold"
+)
+
+// Webhook - адрес владельца, на который отправляются события по его ссылкам
+type Webhook struct {
+	ID              int       `json:"id" db:"id"`
+	OwnerID         string    `json:"owner_id" db:"owner_id"`
+	URL             string    `json:"url" db:"url"`
+	Secret          string    `json:"-" db:"secret"`                          // Ключ подписи HMAC-SHA256
+	Events          []string  `json:"events" db:"events"`                     // Фильтр событий, пустой список - все события
+	ClickThresholds []int     `json:"click_thresholds" db:"click_thresholds"` // Число кликов, при достижении которого отправляется событие
+	Active          bool      `json:"active" db:"active"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+}
+
+// Статусы доставки вебхука
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusFailed    = "failed"
+)
+
+// WebhookDelivery - запись outbox с событием для отправки на вебхук
+type WebhookDelivery struct {
+	ID             int             `json:"id" db:"id"`
+	WebhookID      int             `json:"webhook_id" db:"webhook_id"`
+	Event          string          `json:"event" db:"event"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at" db:"next_attempt_at"`
+	LastStatusCode int             `json:"last_status_code,omitempty" db:"last_status_code"`
+	LastError      string          `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty" db:"delivered_at"`
+
+	WebhookURL string `json:"-"` // Адрес и ключ вебхука, заполняются при выборке на отправку
+	Secret     string `json:"-"`
+}
+
+// WebhookAttempt - журнал одной попытки доставки
+type WebhookAttempt struct {
+	ID         int       `json:"id" db:"id"`
+	DeliveryID int       `json:"delivery_id" db:"delivery_id"`
+	Attempt    int       `json:"attempt" db:"attempt"`
+	StatusCode int       `json:"status_code,omitempty" db:"status_code"`
+	Error      string    `json:"error,omitempty" db:"error"`
+	DurationMS int64     `json:"duration_ms" db:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
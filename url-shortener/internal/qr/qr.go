@@ -0,0 +1,246 @@
+package qr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+
+	DefaultSize   = 256
+	MinSize       = 64
+	MaxSize       = 2048
+	DefaultMargin = 4
+	MaxMargin     = 16
+
+	// logoRatio - доля ширины кода, которую занимает логотип. При уровне
+	// коррекции H код остается читаемым, даже если центр перекрыт.
+	logoRatio = 0.22
+)
+
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// Options задает параметры отрисовки QR-кода
+type Options struct {
+	Format     string      // png или svg
+	Size       int         // Ширина и высота изображения в пикселях
+	ECC        string      // Уровень коррекции ошибок: L, M, Q, H
+	Margin     int         // Размер пустой рамки в модулях
+	Foreground color.NRGBA // Цвет модулей
+	Background color.NRGBA // Цвет фона
+	Logo       image.Image // Логотип в центре кода, необязательный
+}
+
+// DefaultOptions возвращает черный PNG-код 256x256 с уровнем коррекции M
+func DefaultOptions() Options {
+	return Options{
+		Format:     FormatPNG,
+		Size:       DefaultSize,
+		ECC:        "M",
+		Margin:     DefaultMargin,
+		Foreground: color.NRGBA{A: 0xff},
+		Background: color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	}
+}
+
+func (o Options) Validate() error {
+	if o.Format != FormatPNG && o.Format != FormatSVG {
+		return errors.New("format must be png or svg")
+	}
+	if o.Size < MinSize || o.Size > MaxSize {
+		return fmt.Errorf("size must be between %d and %d", MinSize, MaxSize)
+	}
+	if _, ok := levels[o.ECC]; !ok {
+		return errors.New("ecc must be one of L, M, Q, H")
+	}
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return fmt.Errorf("margin must be between 0 and %d", MaxMargin)
+	}
+	return nil
+}
+
+// ContentType возвращает MIME-тип для формата
+func (o Options) ContentType() string {
+	if o.Format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// Render кодирует content в QR-код и отрисовывает его в выбранном формате
+func Render(content string, opts Options) ([]byte, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	level := levels[opts.ECC]
+	if opts.Logo != nil {
+		// Логотип закрывает часть модулей, поэтому нужен максимальный запас коррекции
+		level = qrcode.Highest
+	}
+
+	code, err := qrcode.New(content, level)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	code.DisableBorder = true
+
+	bitmap := code.Bitmap()
+
+	if opts.Format == FormatSVG {
+		return renderSVG(bitmap, opts)
+	}
+	return renderPNG(bitmap, opts)
+}
+
+func renderPNG(bitmap [][]bool, opts Options) ([]byte, error) {
+	modules := len(bitmap)
+	total := modules + 2*opts.Margin
+
+	size := opts.Size
+	if size < total {
+		size = total
+	}
+	scale := size / total
+	offset := (size - scale*total) / 2
+
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(opts.Background), image.Point{}, draw.Src)
+
+	fg := image.NewUniform(opts.Foreground)
+	for y, row := range bitmap {
+		for x, set := range row {
+			if !set {
+				continue
+			}
+			px := offset + (x+opts.Margin)*scale
+			py := offset + (y+opts.Margin)*scale
+			draw.Draw(img, image.Rect(px, py, px+scale, py+scale), fg, image.Point{}, draw.Src)
+		}
+	}
+
+	if opts.Logo != nil {
+		codeSize := modules * scale
+		logoSize := int(float64(codeSize) * logoRatio)
+		if logoSize > 0 {
+			pad := scale
+			x0 := (size - logoSize) / 2
+			y0 := (size - logoSize) / 2
+			draw.Draw(img, image.Rect(x0-pad, y0-pad, x0+logoSize+pad, y0+logoSize+pad),
+				image.NewUniform(opts.Background), image.Point{}, draw.Src)
+			draw.Draw(img, image.Rect(x0, y0, x0+logoSize, y0+logoSize),
+				resize(opts.Logo, logoSize), image.Point{}, draw.Over)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func renderSVG(bitmap [][]bool, opts Options) ([]byte, error) {
+	modules := len(bitmap)
+	total := modules + 2*opts.Margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, total, total)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="%s"%s/>`,
+		total, total, hexColor(opts.Background), opacityAttr("fill-opacity", opts.Background))
+
+	buf.WriteString(`<path d="`)
+	for y, row := range bitmap {
+		for x, set := range row {
+			if set {
+				fmt.Fprintf(&buf, "M%d,%dh1v1h-1z", x+opts.Margin, y+opts.Margin)
+			}
+		}
+	}
+	fmt.Fprintf(&buf, `" fill="%s"%s/>`, hexColor(opts.Foreground), opacityAttr("fill-opacity", opts.Foreground))
+
+	if opts.Logo != nil {
+		var logo bytes.Buffer
+		if err := png.Encode(&logo, opts.Logo); err != nil {
+			return nil, fmt.Errorf("failed to encode logo: %w", err)
+		}
+
+		logoSize := float64(modules) * logoRatio
+		pos := (float64(total) - logoSize) / 2
+		fmt.Fprintf(&buf, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`,
+			svgNum(pos-1), svgNum(pos-1), svgNum(logoSize+2), svgNum(logoSize+2), hexColor(opts.Background))
+		fmt.Fprintf(&buf, `<image x="%s" y="%s" width="%s" height="%s" href="data:image/png;base64,%s"/>`,
+			svgNum(pos), svgNum(pos), svgNum(logoSize), svgNum(logoSize), base64.StdEncoding.EncodeToString(logo.Bytes()))
+	}
+
+	buf.WriteString(`</svg>`)
+	return buf.Bytes(), nil
+}
+
+// resize масштабирует изображение методом ближайшего соседа в квадрат size x size
+func resize(src image.Image, size int) image.Image {
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	b := src.Bounds()
+	for y := 0; y < size; y++ {
+		sy := b.Min.Y + y*b.Dy()/size
+		for x := 0; x < size; x++ {
+			sx := b.Min.X + x*b.Dx()/size
+			dst.Set(x, y, src.At(sx, sy))
+		}
+	}
+	return dst
+}
+
+// ParseColor разбирает цвет в формате RGB, RRGGBB или RRGGBBAA, с # или без
+func ParseColor(s string) (color.NRGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	if len(s) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+func hexColor(c color.NRGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func opacityAttr(name string, c color.NRGBA) string {
+	if c.A == 0xff {
+		return ""
+	}
+	return fmt.Sprintf(` %s="%s"`, name, svgNum(float64(c.A)/0xff))
+}
+
+func svgNum(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
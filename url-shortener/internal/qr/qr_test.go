@@ -0,0 +1,147 @@
+package qr
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Options)
+		wantErr bool
+	}{
+		{name: "defaults", modify: func(o *Options) {}},
+		{name: "svg", modify: func(o *Options) { o.Format = FormatSVG }},
+		{name: "unknown format", modify: func(o *Options) { o.Format = "gif" }, wantErr: true},
+		{name: "min size", modify: func(o *Options) { o.Size = MinSize }},
+		{name: "too small", modify: func(o *Options) { o.Size = MinSize - 1 }, wantErr: true},
+		{name: "max size", modify: func(o *Options) { o.Size = MaxSize }},
+		{name: "too large", modify: func(o *Options) { o.Size = MaxSize + 1 }, wantErr: true},
+		{name: "highest ecc", modify: func(o *Options) { o.ECC = "H" }},
+		{name: "unknown ecc", modify: func(o *Options) { o.ECC = "X" }, wantErr: true},
+		{name: "no margin", modify: func(o *Options) { o.Margin = 0 }},
+		{name: "negative margin", modify: func(o *Options) { o.Margin = -1 }, wantErr: true},
+		{name: "margin too large", modify: func(o *Options) { o.Margin = MaxMargin + 1 }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			tt.modify(&opts)
+			if err := opts.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    color.NRGBA
+		wantErr bool
+	}{
+		{in: "000", want: color.NRGBA{A: 0xff}},
+		{in: "#fff", want: color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}},
+		{in: "1a2b3c", want: color.NRGBA{R: 0x1a, G: 0x2b, B: 0x3c, A: 0xff}},
+		{in: "#1A2B3C80", want: color.NRGBA{R: 0x1a, G: 0x2b, B: 0x3c, A: 0x80}},
+		{in: "", wantErr: true},
+		{in: "12345", wantErr: true},
+		{in: "ggg", wantErr: true},
+		{in: "#12345678ab", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseColor(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderPNG(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Size = 300
+	opts.Foreground = color.NRGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff}
+
+	data, err := Render("https://sho.rt/abc123?src=qr", opts)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("output is not a PNG: %v", err)
+	}
+
+	if b := img.Bounds(); b.Dx() != opts.Size || b.Dy() != opts.Size {
+		t.Errorf("image is %dx%d, want %dx%d", b.Dx(), b.Dy(), opts.Size, opts.Size)
+	}
+	// Угол лежит в пустой рамке и закрашен фоном
+	if got := color.NRGBAModel.Convert(img.At(0, 0)); got != opts.Background {
+		t.Errorf("corner = %v, want background %v", got, opts.Background)
+	}
+
+	foreground := false
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y && !foreground; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if color.NRGBAModel.Convert(img.At(x, y)) == opts.Foreground {
+				foreground = true
+				break
+			}
+		}
+	}
+	if !foreground {
+		t.Error("no module is drawn in the foreground color")
+	}
+}
+
+func TestRenderSVG(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Format = FormatSVG
+	opts.Size = 512
+	opts.Background = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0x80}
+
+	data, err := Render("https://sho.rt/abc123?src=qr", opts)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+
+	svg := string(data)
+	for _, want := range []string{
+		`<svg xmlns="http://www.w3.org/2000/svg" width="512" height="512"`,
+		`fill="#ffffff" fill-opacity="0.50"`,
+		`fill="#000000"/>`,
+		`</svg>`,
+	} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("SVG does not contain %q", want)
+		}
+	}
+	if !strings.Contains(svg, "h1v1h-1z") {
+		t.Error("SVG has no modules")
+	}
+}
+
+func TestRenderRejectsInvalidOptions(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Format = "gif"
+	if _, err := Render("https://sho.rt/abc123", opts); err == nil {
+		t.Error("expected error for invalid options")
+	}
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+// Breaker - автоматический выключатель вокруг Redis. После threshold ошибок подряд
+// запросы к Redis не выполняются в течение cooldown, затем один пробный запрос
+// проверяет, восстановился ли Redis.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+
+	onChange func(open bool)
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow сообщает, можно ли выполнить запрос. В полуоткрытом состоянии проходит только один пробный запрос.
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case stateOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = stateHalfOpen
+		return true
+	case stateHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+// tripped сообщает, что выключатель разомкнут или ждет результата пробного запроса
+func (b *Breaker) tripped() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != stateClosed
+}
+
+// record учитывает результат запроса, пропущенного allow
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+
+	changed, open := false, false
+	switch {
+	case err == nil:
+		changed = b.state != stateClosed
+		b.state = stateClosed
+		b.failures = 0
+	case errors.Is(err, context.Canceled):
+		// Запрос отменил клиент, о Redis это ничего не говорит: пробу можно повторить сразу
+		if b.state == stateHalfOpen {
+			b.state = stateOpen
+		}
+	default:
+		b.failures++
+		if b.state == stateHalfOpen || (b.state == stateClosed && b.failures >= b.threshold) {
+			changed = b.state == stateClosed
+			b.state = stateOpen
+			b.openedAt = time.Now()
+			open = true
+		}
+	}
+
+	onChange := b.onChange
+	b.mu.Unlock()
+
+	if changed && onChange != nil {
+		onChange(open)
+	}
+}
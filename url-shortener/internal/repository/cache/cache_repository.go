@@ -5,60 +5,342 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
 	"time"
+	"url-shortener/internal/metrics"
 	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/tracing"
 
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// domainChannel - канал Redis, через который экземпляры сообщают друг другу об измененных доменах
+const domainChannel = "domains:changed"
+
+// urlKeyPattern совпадает со всеми ключами ссылок, см. urlKey
+const urlKeyPattern = "url:*"
+
+// notFoundValue - значение ключа для ссылки, которой нет. JSON ссылки никогда не бывает пустым.
+const notFoundValue = ""
+
 type CacheRepository struct {
-	client *redis.Client
+	client  *redis.Client
+	breaker *Breaker
+
+	// stale выставляется, когда не удалось удалить ключ: в Redis могут остаться
+	// устаревшие ссылки, и следующий успешный запрос запускает полный сброс
+	stale atomic.Bool
+
+	onRecover []func()
+}
+
+func NewCacheRepository(client *redis.Client, breaker *Breaker) *CacheRepository {
+	r := &CacheRepository{client: client, breaker: breaker}
+	breaker.onChange = r.onBreakerChange
+	return r
+}
+
+func (r *CacheRepository) onBreakerChange(open bool) {
+	if open {
+		metrics.CacheCircuitOpen.Set(1)
+		slog.Warn("cache circuit breaker opened, serving without Redis")
+		return
+	}
+
+	metrics.CacheCircuitOpen.Set(0)
+	slog.Info("cache circuit breaker closed, Redis is available again")
+	for _, fn := range r.onRecover {
+		fn()
+	}
+}
+
+// OnRecover регистрирует действие после восстановления Redis. Вызывается до начала работы.
+func (r *CacheRepository) OnRecover(fn func()) {
+	r.onRecover = append(r.onRecover, fn)
+}
+
+// publishInvalidation сообщает подписанным экземплярам, что ключ нужно удалить из локального кэша
+func (r *CacheRepository) publishInvalidation(ctx context.Context, key string) error {
+	return r.do("publish", func() error {
+		return r.client.Publish(ctx, invalidationChannel, key).Err()
+	})
+}
+
+// PublishCode сообщает остальным экземплярам о выданном коде. Сообщение уходит в канал сбросов:
+// заодно локальные кэши удаляют запомненное отсутствие этой ссылки.
+func (r *CacheRepository) PublishCode(ctx context.Context, domain, shortCode string) error {
+	return r.publishInvalidation(ctx, urlKey(domain, shortCode))
+}
+
+// SubscribeCodes вызывает fn для каждой ссылки, сброс которой пришел по каналу, пока не отменен ctx.
+// Сброс приходит при создании, изменении и удалении, то есть только для выданных кодов.
+func (r *CacheRepository) SubscribeCodes(ctx context.Context, fn func(domain, shortCode string)) {
+	r.subscribe(ctx, invalidationChannel, func(payload string) {
+		if domain, shortCode, ok := parseURLKey(payload); ok {
+			fn(domain, shortCode)
+		}
+	})
+}
+
+// Available сообщает, что Redis доступен и рассылка кодов доходит до остальных экземпляров
+func (r *CacheRepository) Available() bool {
+	return !r.breaker.tripped()
+}
+
+// PublishDomain сообщает остальным экземплярам, что домен подтвержден, изменен или удален
+func (r *CacheRepository) PublishDomain(ctx context.Context, hostname string) error {
+	return r.do("publish", func() error {
+		return r.client.Publish(ctx, domainChannel, hostname).Err()
+	})
+}
+
+// SubscribeDomains вызывает fn для каждого измененного домена, пока не отменен ctx
+func (r *CacheRepository) SubscribeDomains(ctx context.Context, fn func(hostname string)) {
+	r.subscribe(ctx, domainChannel, fn)
+}
+
+// subscribe передает fn сообщения канала, пока не отменен ctx
+func (r *CacheRepository) subscribe(ctx context.Context, channel string, fn func(payload string)) {
+	// Клиент сам переподключает подписку, если соединение с Redis оборвалось
+	pubsub := r.client.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			fn(msg.Payload)
+		}
+	}
+}
+
+// flushURLs удаляет все закэшированные ссылки. Вызывается после первого успешного запроса,
+// если до него не удалось сбросить кэш измененной ссылки.
+func (r *CacheRepository) flushURLs() {
+	ctx := context.Background()
+	removed, err := r.unlinkMatching(ctx, urlKeyPattern)
+	if err != nil {
+		r.stale.Store(true)
+		slog.ErrorContext(ctx, "failed to flush stale cached URLs", "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "flushed cached URLs after Redis outage", "keys", removed)
+}
+
+func (r *CacheRepository) unlinkMatching(ctx context.Context, pattern string) (int, error) {
+	const batchSize = 1000
+
+	removed := 0
+	batch := make([]string, 0, batchSize)
+	iter := r.client.Scan(ctx, 0, pattern, batchSize).Iterator()
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) < batchSize {
+			continue
+		}
+		if err := r.client.Unlink(ctx, batch...).Err(); err != nil {
+			return removed, err
+		}
+		removed += len(batch)
+		batch = batch[:0]
+	}
+	if err := iter.Err(); err != nil {
+		return removed, err
+	}
+
+	if len(batch) > 0 {
+		if err := r.client.Unlink(ctx, batch...).Err(); err != nil {
+			return removed, err
+		}
+		removed += len(batch)
+	}
+	return removed, nil
+}
+
+// do выполняет запрос к Redis через выключатель. redis.Nil - успешный ответ.
+func (r *CacheRepository) do(op string, fn func() error) error {
+	if !r.breaker.allow() {
+		metrics.CacheRequests.WithLabelValues(op, metrics.CacheSkipped).Inc()
+		return repository.ErrCacheUnavailable
+	}
+
+	err := fn()
+	if errors.Is(err, redis.Nil) {
+		r.breaker.record(nil)
+	} else {
+		r.breaker.record(err)
+	}
+
+	// Удаление могло не пройти и без размыкания выключателя: сброс запускается
+	// при первом успешном запросе после неудачи
+	if (err == nil || errors.Is(err, redis.Nil)) && r.stale.Swap(false) {
+		go r.flushURLs()
+	}
+	return err
+}
+
+// urlKey строит ключ кэша ссылки. Ссылки домена по умолчанию сохраняют прежний формат ключа.
+func urlKey(domain, shortCode string) string {
+	if domain == "" {
+		return fmt.Sprintf("url:%s", shortCode)
+	}
+	return fmt.Sprintf("url:%s/%s", domain, shortCode)
 }
 
-func NewCacheRepository(client *redis.Client) *CacheRepository {
-	return &CacheRepository{client: client}
+// parseURLKey разбирает ключ, построенный urlKey
+func parseURLKey(key string) (domain, shortCode string, ok bool) {
+	rest, ok := strings.CutPrefix(key, "url:")
+	if !ok || rest == "" {
+		return "", "", false
+	}
+	if domain, shortCode, found := strings.Cut(rest, "/"); found {
+		return domain, shortCode, true
+	}
+	return "", rest, true
 }
 
-func (r *CacheRepository) GetURL(ctx context.Context, shortCode string) (*models.URL, error) {
-	key := fmt.Sprintf("url:%s", shortCode)
+// startSpan начинает клиентский спан операции с Redis
+func startSpan(ctx context.Context, op, domain, shortCode string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "cache."+op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system.name", "redis"),
+		tracing.AttrShortCode.String(shortCode),
+		tracing.AttrDomain.String(domain),
+	))
+}
 
-	data, err := r.client.Get(ctx, key).Result()
+func (r *CacheRepository) GetURL(ctx context.Context, domain, shortCode string) (_ *models.URL, _ time.Duration, err error) {
+	ctx, span := startSpan(ctx, "GetURL", domain, shortCode)
+	defer func() { tracing.End(span, err) }()
+
+	key := urlKey(domain, shortCode)
+
+	// Значение и оставшееся время жизни читаются за один проход до Redis
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	err = r.do("get", func() error {
+		pipe := r.client.Pipeline()
+		get = pipe.Get(ctx, key)
+		pttl = pipe.PTTL(ctx, key)
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+	if errors.Is(err, repository.ErrCacheUnavailable) {
+		span.SetAttributes(tracing.AttrCacheResult.String(metrics.CacheSkipped))
+		return nil, 0, err
+	}
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
-			return nil, nil
+			metrics.CacheRequests.WithLabelValues("get", metrics.CacheMiss).Inc()
+			span.SetAttributes(tracing.AttrCacheResult.String(metrics.CacheMiss))
+			return nil, 0, nil
 		}
-		return nil, fmt.Errorf("failed to get from cache: %w", err)
+		metrics.CacheRequests.WithLabelValues("get", metrics.CacheError).Inc()
+		span.SetAttributes(tracing.AttrCacheResult.String(metrics.CacheError))
+		return nil, 0, fmt.Errorf("failed to get from cache: %w", err)
+	}
+
+	// PTTL отрицателен, если у ключа нет срока жизни
+	ttl := max(pttl.Val(), 0)
+
+	data := get.Val()
+	if data == notFoundValue {
+		metrics.CacheRequests.WithLabelValues("get", metrics.CacheNegativeHit).Inc()
+		span.SetAttributes(tracing.AttrCacheResult.String(metrics.CacheNegativeHit))
+		return nil, ttl, repository.ErrCachedNotFound
 	}
 
+	// Поврежденная запись считается ошибкой, а не попаданием: ссылку придется читать из базы
 	var url models.URL
 	if err := json.Unmarshal([]byte(data), &url); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal url: %w", err)
+		metrics.CacheRequests.WithLabelValues("get", metrics.CacheError).Inc()
+		span.SetAttributes(tracing.AttrCacheResult.String(metrics.CacheError))
+		return nil, 0, fmt.Errorf("failed to unmarshal url: %w", err)
 	}
+	metrics.CacheRequests.WithLabelValues("get", metrics.CacheHit).Inc()
+	span.SetAttributes(tracing.AttrCacheResult.String(metrics.CacheHit))
+
+	return &url, ttl, nil
+}
 
-	return &url, nil
+// SetNotFound записывает отсутствие ссылки на ttl. Существующая запись не перезаписывается:
+// ссылка могла быть создана и закэширована, пока длилась загрузка, заметившая ее отсутствие.
+func (r *CacheRepository) SetNotFound(ctx context.Context, domain, shortCode string, ttl time.Duration) error {
+	_, err := r.setNotFound(ctx, domain, shortCode, ttl)
+	return err
 }
 
-func (r *CacheRepository) SetURL(ctx context.Context, url *models.URL) error {
-	key := fmt.Sprintf("url:%s", url.ShortCode)
+// setNotFound возвращает false, если запись с этим ключом уже есть
+func (r *CacheRepository) setNotFound(ctx context.Context, domain, shortCode string, ttl time.Duration) (stored bool, err error) {
+	ctx, span := startSpan(ctx, "SetNotFound", domain, shortCode)
+	defer func() { tracing.End(span, err) }()
+
+	key := urlKey(domain, shortCode)
+	err = r.do("set", func() error {
+		var err error
+		stored, err = r.client.SetNX(ctx, key, notFoundValue, ttl).Result()
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrCacheUnavailable) {
+			return false, err
+		}
+		metrics.CacheRequests.WithLabelValues("set", metrics.CacheError).Inc()
+		return false, fmt.Errorf("failed to set cache: %w", err)
+	}
+	metrics.CacheRequests.WithLabelValues("set", metrics.CacheOK).Inc()
+
+	return stored, nil
+}
+
+// SetURL кэширует ссылку на ttl. Сервис укорачивает ttl до ближайшего перехода по расписанию.
+func (r *CacheRepository) SetURL(ctx context.Context, url *models.URL, ttl time.Duration) (err error) {
+	ctx, span := startSpan(ctx, "SetURL", url.Domain, url.ShortCode)
+	defer func() { tracing.End(span, err) }()
+
+	key := urlKey(url.Domain, url.ShortCode)
 
 	data, err := json.Marshal(url)
 	if err != nil {
 		return fmt.Errorf("failed to marshal url: %w", err)
 	}
 
-	if err := r.client.Set(ctx, key, data, time.Hour).Err(); err != nil {
+	if err := r.do("set", func() error { return r.client.Set(ctx, key, data, ttl).Err() }); err != nil {
+		if errors.Is(err, repository.ErrCacheUnavailable) {
+			return err
+		}
+		metrics.CacheRequests.WithLabelValues("set", metrics.CacheError).Inc()
 		return fmt.Errorf("failed to set cache: %w", err)
 	}
+	metrics.CacheRequests.WithLabelValues("set", metrics.CacheOK).Inc()
 
 	return nil
 }
 
-func (r *CacheRepository) DeleteURL(ctx context.Context, shortCode string) error {
-	key := fmt.Sprintf("url:%s", shortCode)
+func (r *CacheRepository) DeleteURL(ctx context.Context, domain, shortCode string) (err error) {
+	ctx, span := startSpan(ctx, "DeleteURL", domain, shortCode)
+	defer func() { tracing.End(span, err) }()
 
-	if err := r.client.Del(ctx, key).Err(); err != nil {
+	key := urlKey(domain, shortCode)
+
+	if err := r.do("delete", func() error { return r.client.Del(ctx, key).Err() }); err != nil {
+		r.stale.Store(true)
+		if errors.Is(err, repository.ErrCacheUnavailable) {
+			return err
+		}
+		metrics.CacheRequests.WithLabelValues("delete", metrics.CacheError).Inc()
 		return fmt.Errorf("failed to delete from cache: %w", err)
 	}
+	metrics.CacheRequests.WithLabelValues("delete", metrics.CacheOK).Inc()
 
 	return nil
 }
@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+	"url-shortener/internal/repository"
+)
+
+// DelayedInvalidation повторяет удаление из кэша через заданное время. Пока реплика не
+// получила изменение, промах кэша может снова загрузить в него старую строку; второе
+// удаление после отставания реплики убирает ее.
+type DelayedInvalidation struct {
+	repository.CacheRepository
+	delay   time.Duration
+	pending sync.WaitGroup
+}
+
+func NewDelayedInvalidation(next repository.CacheRepository, delay time.Duration) *DelayedInvalidation {
+	return &DelayedInvalidation{CacheRepository: next, delay: delay}
+}
+
+func (c *DelayedInvalidation) DeleteURL(ctx context.Context, domain, shortCode string) error {
+	err := c.CacheRepository.DeleteURL(ctx, domain, shortCode)
+
+	ctx = context.WithoutCancel(ctx)
+	c.pending.Add(1)
+	time.AfterFunc(c.delay, func() {
+		defer c.pending.Done()
+		if err := c.CacheRepository.DeleteURL(ctx, domain, shortCode); err != nil && !errors.Is(err, repository.ErrCacheUnavailable) {
+			slog.WarnContext(ctx, "delayed cache invalidation failed", "domain", domain, "short_code", shortCode, "error", err)
+		}
+	})
+
+	return err
+}
+
+// Shutdown дожидается отложенных удалений, чтобы они не потерялись при остановке
+func (c *DelayedInvalidation) Shutdown() {
+	c.pending.Wait()
+}
@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"container/list"
+	"hash/maphash"
+	"sync"
+	"time"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/models"
+)
+
+// localShards - число независимых сегментов локального кэша. Каждый сегмент
+// со своей блокировкой, чтобы горячие ссылки не выстраивали запросы в очередь на одном мьютексе.
+const localShards = 16
+
+// localEntry - запись локального кэша. url равен nil для закэшированного отсутствия ссылки.
+type localEntry struct {
+	key               string
+	url               *models.URL
+	expiresAt         time.Time
+	upstreamExpiresAt time.Time // Когда истекает та же запись в Redis
+}
+
+type localShard struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List // Начало списка - последние использованные записи
+}
+
+// LocalCache - ограниченный по размеру LRU кэш ссылок в памяти процесса с TTL на запись
+type LocalCache struct {
+	seed   maphash.Seed
+	shards [localShards]*localShard
+}
+
+// NewLocalCache создает кэш, вмещающий примерно size ссылок
+func NewLocalCache(size int) *LocalCache {
+	perShard := max(size/localShards, 1)
+
+	c := &LocalCache{seed: maphash.MakeSeed()}
+	for i := range c.shards {
+		c.shards[i] = &localShard{
+			capacity: perShard,
+			items:    make(map[string]*list.Element, perShard),
+			order:    list.New(),
+		}
+	}
+	return c
+}
+
+func (c *LocalCache) shard(key string) *localShard {
+	return c.shards[maphash.String(c.seed, key)%localShards]
+}
+
+// Get возвращает копию ссылки, чтобы вызывающий код не менял общий экземпляр, и время,
+// оставшееся до истечения записи в Redis. Для закэшированного отсутствия ссылки url равен nil.
+func (c *LocalCache) Get(key string) (*models.URL, time.Duration, bool) {
+	s := c.shard(key)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.items[key]
+	if !ok {
+		return nil, 0, false
+	}
+	entry := elem.Value.(*localEntry)
+	if !now.Before(entry.expiresAt) {
+		s.remove(elem)
+		return nil, 0, false
+	}
+
+	s.order.MoveToFront(elem)
+	upstreamTTL := max(entry.upstreamExpiresAt.Sub(now), 0)
+	if entry.url == nil {
+		return nil, upstreamTTL, true
+	}
+	url := *entry.url
+	return &url, upstreamTTL, true
+}
+
+// Set сохраняет копию ссылки на ttl, вытесняя давно не использованные записи.
+// url равен nil, чтобы запомнить отсутствие ссылки. upstreamTTL - время жизни записи в Redis.
+func (c *LocalCache) Set(key string, url *models.URL, ttl, upstreamTTL time.Duration) {
+	c.set(key, url, ttl, upstreamTTL, true)
+}
+
+// Add сохраняет запись, только если действующей записи с этим ключом нет
+func (c *LocalCache) Add(key string, url *models.URL, ttl, upstreamTTL time.Duration) bool {
+	return c.set(key, url, ttl, upstreamTTL, false)
+}
+
+func (c *LocalCache) set(key string, url *models.URL, ttl, upstreamTTL time.Duration, replace bool) bool {
+	if ttl <= 0 {
+		return false
+	}
+
+	s := c.shard(key)
+	now := time.Now()
+	entry := &localEntry{key: key, expiresAt: now.Add(ttl), upstreamExpiresAt: now.Add(upstreamTTL)}
+	if url != nil {
+		stored := *url
+		entry.url = &stored
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.items[key]; ok {
+		if !replace && now.Before(elem.Value.(*localEntry).expiresAt) {
+			return false
+		}
+		elem.Value = entry
+		s.order.MoveToFront(elem)
+		return true
+	}
+
+	s.items[key] = s.order.PushFront(entry)
+	for s.order.Len() > s.capacity {
+		s.remove(s.order.Back())
+		metrics.LocalCacheEvictions.Inc()
+	}
+	return true
+}
+
+func (c *LocalCache) Delete(key string) {
+	s := c.shard(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.items[key]; ok {
+		s.remove(elem)
+	}
+}
+
+// Clear очищает кэш целиком
+func (c *LocalCache) Clear() {
+	for _, s := range c.shards {
+		s.mu.Lock()
+		s.items = make(map[string]*list.Element, s.capacity)
+		s.order.Init()
+		s.mu.Unlock()
+	}
+}
+
+// Len возвращает текущее число записей, включая еще не удаленные истекшие
+func (c *LocalCache) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		n += s.order.Len()
+		s.mu.Unlock()
+	}
+	return n
+}
+
+func (s *localShard) remove(elem *list.Element) {
+	s.order.Remove(elem)
+	delete(s.items, elem.Value.(*localEntry).key)
+}
@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+	"url-shortener/internal/models"
+)
+
+func TestLocalCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLocalCache(localShards)
+
+	// Ключи одного сегмента: в сегменте помещается одна запись
+	var keys []string
+	target := c.shard("a")
+	for i := 0; len(keys) < 2; i++ {
+		if key := "k" + strconv.Itoa(i); c.shard(key) == target {
+			keys = append(keys, key)
+		}
+	}
+
+	c.Set(keys[0], &models.URL{ShortCode: keys[0]}, time.Minute, time.Minute)
+	c.Set(keys[1], &models.URL{ShortCode: keys[1]}, time.Minute, time.Minute)
+
+	if _, _, ok := c.Get(keys[0]); ok {
+		t.Errorf("%s should have been evicted", keys[0])
+	}
+	if url, _, ok := c.Get(keys[1]); !ok || url.ShortCode != keys[1] {
+		t.Errorf("Get(%s) = %v, %v", keys[1], url, ok)
+	}
+}
+
+func TestLocalCacheExpires(t *testing.T) {
+	c := NewLocalCache(100)
+	c.Set("a", &models.URL{ShortCode: "a"}, 20*time.Millisecond, time.Minute)
+
+	if _, _, ok := c.Get("a"); !ok {
+		t.Fatal("fresh entry is missing")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, _, ok := c.Get("a"); ok {
+		t.Error("expired entry is returned")
+	}
+}
+
+func TestLocalCacheAddKeepsLiveEntry(t *testing.T) {
+	c := NewLocalCache(100)
+	c.Set("a", &models.URL{ShortCode: "a"}, time.Minute, time.Minute)
+
+	if c.Add("a", nil, time.Minute, time.Minute) {
+		t.Error("Add replaced a live entry")
+	}
+	if url, _, ok := c.Get("a"); !ok || url == nil {
+		t.Fatalf("Get(a) = %v, %v, want the cached URL", url, ok)
+	}
+
+	c.Set("b", &models.URL{ShortCode: "b"}, 10*time.Millisecond, time.Minute)
+	time.Sleep(20 * time.Millisecond)
+	if !c.Add("b", nil, time.Minute, time.Minute) {
+		t.Error("Add did not replace an expired entry")
+	}
+	if url, _, ok := c.Get("b"); !ok || url != nil {
+		t.Errorf("Get(b) = %v, %v, want cached absence", url, ok)
+	}
+}
+
+func TestLocalCacheConcurrentAccess(t *testing.T) {
+	const size = 256
+	c := NewLocalCache(size)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(int64(g)))
+			for i := 0; i < 5000; i++ {
+				key := "k" + strconv.Itoa(rnd.Intn(4*size))
+				switch rnd.Intn(10) {
+				case 0:
+					c.Delete(key)
+				case 1, 2:
+					c.Set(key, &models.URL{ShortCode: key}, time.Minute, time.Minute)
+				default:
+					if url, _, ok := c.Get(key); ok && url != nil && url.ShortCode != key {
+						t.Errorf("Get(%s) returned %s", key, url.ShortCode)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := c.Len(); n > size {
+		t.Errorf("cache holds %d entries, capacity is %d", n, size)
+	}
+}
+
+func benchKeys(n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "example.com/" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+// BenchmarkLocalCacheGetParallel - чтение из многих горутин: одна горячая ссылка
+// упирается в мьютекс своего сегмента, разные ссылки расходятся по сегментам
+func BenchmarkLocalCacheGetParallel(b *testing.B) {
+	for _, n := range []int{1, 16, 10000} {
+		b.Run("keys="+strconv.Itoa(n), func(b *testing.B) {
+			c := NewLocalCache(10000)
+			keys := benchKeys(n)
+			for _, key := range keys {
+				c.Set(key, &models.URL{ShortCode: key, OriginalURL: "https://example.com/" + key}, time.Hour, time.Hour)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.Int()
+				for pb.Next() {
+					c.Get(keys[i%n])
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkLocalCacheMixedParallel - 90% чтений и 10% записей по набору ключей
+// больше емкости кэша, так что записи постоянно вытесняют старые
+func BenchmarkLocalCacheMixedParallel(b *testing.B) {
+	const size = 1000
+	c := NewLocalCache(size)
+	keys := benchKeys(4 * size)
+	url := &models.URL{ShortCode: "bench", OriginalURL: "https://example.com/bench"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		rnd := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			key := keys[rnd.Intn(len(keys))]
+			if rnd.Intn(10) == 0 {
+				c.Set(key, url, time.Hour, time.Hour)
+			} else {
+				c.Get(key)
+			}
+		}
+	})
+}
+
+// BenchmarkLocalCacheSetParallel - только записи, каждая вытесняет запись сегмента
+func BenchmarkLocalCacheSetParallel(b *testing.B) {
+	c := NewLocalCache(1000)
+	keys := benchKeys(100000)
+	url := &models.URL{ShortCode: "bench", OriginalURL: "https://example.com/bench"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := rand.Int()
+		for pb.Next() {
+			c.Set(keys[i%len(keys)], url, time.Hour, time.Hour)
+			i++
+		}
+	})
+}
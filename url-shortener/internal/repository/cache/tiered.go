@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+)
+
+// invalidationChannel - канал Redis, через который экземпляры сервиса сообщают друг другу
+// об измененных и удаленных ссылках
+const invalidationChannel = "cache:invalidate"
+
+// TieredCache - локальный кэш процесса перед Redis. Локальные записи живут недолго:
+// сброс по pub/sub может потеряться при переподключении, и TTL ограничивает устаревание.
+type TieredCache struct {
+	redis *CacheRepository
+	local *LocalCache
+	ttl   time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewTieredCache(redis *CacheRepository, local *LocalCache, ttl time.Duration) *TieredCache {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &TieredCache{
+		redis:  redis,
+		local:  local,
+		ttl:    ttl,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	// Пока Redis был недоступен, сбросы от других экземпляров не доходили
+	redis.OnRecover(local.Clear)
+	return c
+}
+
+// Start подписывается на сбросы от других экземпляров
+func (c *TieredCache) Start() {
+	go c.run()
+}
+
+func (c *TieredCache) run() {
+	defer close(c.done)
+
+	// Клиент сам переподключает подписку, если соединение с Redis оборвалось
+	pubsub := c.redis.client.Subscribe(c.ctx, invalidationChannel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			c.local.Delete(msg.Payload)
+		}
+	}
+}
+
+// localTTL ограничивает время жизни локальной записи ближайшим переходом по расписанию ссылки
+func (c *TieredCache) localTTL(url *models.URL, ttl time.Duration) time.Duration {
+	ttl = min(ttl, c.ttl)
+
+	now := time.Now()
+	if next := url.NextTransition(now); !next.IsZero() {
+		ttl = min(ttl, next.Sub(now))
+	}
+	return ttl
+}
+
+func (c *TieredCache) GetURL(ctx context.Context, domain, shortCode string) (*models.URL, time.Duration, error) {
+	key := urlKey(domain, shortCode)
+	if url, ttl, ok := c.local.Get(key); ok {
+		if url == nil {
+			metrics.LocalCacheRequests.WithLabelValues(metrics.CacheNegativeHit).Inc()
+			return nil, ttl, repository.ErrCachedNotFound
+		}
+		metrics.LocalCacheRequests.WithLabelValues(metrics.CacheHit).Inc()
+		return url, ttl, nil
+	}
+	metrics.LocalCacheRequests.WithLabelValues(metrics.CacheMiss).Inc()
+
+	url, ttl, err := c.redis.GetURL(ctx, domain, shortCode)
+	switch {
+	case errors.Is(err, repository.ErrCachedNotFound):
+		c.local.Set(key, nil, min(ttl, c.ttl), ttl)
+	case err == nil && url != nil:
+		c.local.Set(key, url, c.localTTL(url, ttl), ttl)
+	}
+	return url, ttl, err
+}
+
+// SetURL сохраняет ссылку в оба уровня. Локальный уровень заполняется, даже если Redis недоступен.
+func (c *TieredCache) SetURL(ctx context.Context, url *models.URL, ttl time.Duration) error {
+	c.local.Set(urlKey(url.Domain, url.ShortCode), url, c.localTTL(url, ttl), ttl)
+	return c.redis.SetURL(ctx, url, ttl)
+}
+
+func (c *TieredCache) SetNotFound(ctx context.Context, domain, shortCode string, ttl time.Duration) error {
+	stored, err := c.redis.setNotFound(ctx, domain, shortCode, ttl)
+	if err == nil && !stored {
+		// В Redis уже лежит ссылка, записанная после начала загрузки
+		return nil
+	}
+	c.local.Add(urlKey(domain, shortCode), nil, min(ttl, c.ttl), ttl)
+	return err
+}
+
+// DeleteURL удаляет ссылку из обоих уровней и рассылает сброс остальным экземплярам
+func (c *TieredCache) DeleteURL(ctx context.Context, domain, shortCode string) error {
+	key := urlKey(domain, shortCode)
+	c.local.Delete(key)
+
+	err := c.redis.DeleteURL(ctx, domain, shortCode)
+	if pubErr := c.redis.publishInvalidation(ctx, key); pubErr != nil && err == nil {
+		slog.WarnContext(ctx, "failed to publish cache invalidation", "key", key, "error", pubErr)
+	}
+	return err
+}
+
+// Len возвращает число записей локального уровня
+func (c *TieredCache) Len() int {
+	return c.local.Len()
+}
+
+func (c *TieredCache) Shutdown() {
+	c.cancel()
+	<-c.done
+}
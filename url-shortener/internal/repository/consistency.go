@@ -0,0 +1,17 @@
+package repository
+
+import "context"
+
+type primaryKey struct{}
+
+// WithPrimary помечает контекст: чтения в нем должны идти в основную базу, а не на реплики.
+// Нужно там, где прочитанная строка сразу изменяется и отставание реплики привело бы к потере записи.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// UsePrimary сообщает, требует ли контекст чтения из основной базы
+func UsePrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryKey{}).(bool)
+	return v
+}
@@ -2,26 +2,127 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"time"
 	"url-shortener/internal/models"
 )
 
+// ErrCacheUnavailable возвращается кэшем, пока Redis недоступен и запросы к нему не выполняются
+var ErrCacheUnavailable = errors.New("cache unavailable")
+
+// ErrCachedNotFound возвращается кэшем, если в нем записано отсутствие ссылки
+var ErrCachedNotFound = errors.New("cached as not found")
+
+// ErrDomainExists возвращается, если домен уже закреплен за владельцем
+var ErrDomainExists = errors.New("domain already exists")
+
+// ErrShortCodeTaken возвращается, если короткий код в домене уже занят другой ссылкой
+var ErrShortCodeTaken = errors.New("short code already taken")
+
+// ErrUnknownVariant возвращается, если изменяемого варианта нет среди действующих вариантов ссылки
+var ErrUnknownVariant = errors.New("unknown variant")
+
+// Transactor выполняет fn в одной транзакции базы. Репозитории, вызванные с контекстом fn,
+// работают в этой транзакции, и изменения фиксируются, только если fn не вернула ошибку.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
 type URLRepository interface {
 	Create(ctx context.Context, url *models.URL) error
 	GetByID(ctx context.Context, ID int) (*models.URL, error)
-	FindByShortCode(ctx context.Context, shortCode string) (*models.URL, error)
-	FindByOriginalURL(ctx context.Context, originalURL string) (*models.URL, error)
+	FindByShortCode(ctx context.Context, domain, shortCode string) (*models.URL, error)
+	FindByCanonicalHash(ctx context.Context, ownerID, domain, hash string) (*models.URL, error)
 	Update(ctx context.Context, url *models.URL) error
+	// Delete выполняет мягкое удаление: строка и история кликов сохраняются
 	Delete(ctx context.Context, ID int) error
+	ListActive(ctx context.Context, afterID, limit int) ([]models.URL, error)
+	// ListShortCodes возвращает коды всех ссылок, включая удаленные и отключенные, с id больше afterID
+	ListShortCodes(ctx context.Context, afterID, limit int) ([]models.ShortCodeRef, error)
+	// ClaimExpired помечает истекшие ссылки обработанными. Вызывается в транзакции вместе
+	// с публикацией события, чтобы при ошибке ссылка была обработана повторно.
+	ClaimExpired(ctx context.Context, now time.Time, limit int) ([]models.URL, error)
+	SetDisabled(ctx context.Context, ID int, disabled bool, reason string) error
 }
 
 type AnalyticsRepository interface {
-	SaveClick(ctx context.Context, click *models.Click) error
+	SaveClick(ctx context.Context, click *models.Click) (int, error)
 	GetAnalyticsByID(ctx context.Context, ID int) (*models.Analytics, error)
-	GetAnalyticsByShortCode(ctx context.Context, shortCode string) (*models.Analytics, error)
+	GetAnalyticsByShortCode(ctx context.Context, domain, shortCode string) (*models.Analytics, error)
+	ClickCountsByWindow(ctx context.Context, now time.Time, window time.Duration, windows int) (map[int][]int, error)
+}
+
+type VariantRepository interface {
+	GetByURLID(ctx context.Context, urlID int) ([]models.URLVariant, error)
+	ReplaceForURL(ctx context.Context, urlID int, variants []models.URLVariant) error
+}
+
+type AuditRepository interface {
+	Record(ctx context.Context, entry *models.AuditEntry) error
+	ListByURLID(ctx context.Context, urlID int) ([]models.AuditEntry, error)
+}
+
+type HealthRepository interface {
+	Save(ctx context.Context, health *models.URLHealth) error
+	GetByURLID(ctx context.Context, urlID int) (*models.URLHealth, error)
+	ListBroken(ctx context.Context, ownerID string) ([]models.URLHealth, error)
+}
+
+type WebhookRepository interface {
+	Create(ctx context.Context, webhook *models.Webhook) error
+	GetByID(ctx context.Context, ID int) (*models.Webhook, error)
+	ListByOwner(ctx context.Context, ownerID string) ([]models.Webhook, error)
+	ListSubscribed(ctx context.Context, ownerID, event string) ([]models.Webhook, error)
+	ListForClickThreshold(ctx context.Context, urlID, clickCount int) ([]models.Webhook, error)
+	ListClickThresholds(ctx context.Context) ([]int, error)
+	Delete(ctx context.Context, ID int) error
+
+	EnqueueDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	SaveAttempt(ctx context.Context, delivery *models.WebhookDelivery, attempt *models.WebhookAttempt) error
+	GetDelivery(ctx context.Context, ID int) (*models.WebhookDelivery, error)
+	ListDeliveries(ctx context.Context, webhookID, limit int) ([]models.WebhookDelivery, error)
+	ListAttempts(ctx context.Context, deliveryID int) ([]models.WebhookAttempt, error)
+	Replay(ctx context.Context, ID int) error
+}
+
+type ScheduleRepository interface {
+	GetByURLID(ctx context.Context, urlID int) ([]models.URLScheduleEntry, error)
+	ReplaceForURL(ctx context.Context, urlID int, entries []models.URLScheduleEntry) error
+}
+
+type AlertRepository interface {
+	// Create записывает оповещение и возвращает false, если такое же уже есть в этом окне
+	Create(ctx context.Context, alert *models.Alert) (bool, error)
+	ListByOwner(ctx context.Context, ownerID string, limit int) ([]models.Alert, error)
+}
+
+type DomainRepository interface {
+	Create(ctx context.Context, domain *models.Domain) error
+	GetByHostname(ctx context.Context, hostname string) (*models.Domain, error)
+	ListByOwner(ctx context.Context, ownerID string) ([]models.Domain, error)
+	ListAll(ctx context.Context) ([]models.Domain, error)
+	UpdateFallback(ctx context.Context, domain *models.Domain) error
+	CountURLs(ctx context.Context, hostname string) (int, error)
+	Delete(ctx context.Context, hostname string) error
+
+	CreateClaim(ctx context.Context, claim *models.DomainClaim) error
+	GetClaim(ctx context.Context, ownerID, hostname string) (*models.DomainClaim, error)
+	ListClaimsByOwner(ctx context.Context, ownerID string) ([]models.DomainClaim, error)
+	DeleteClaim(ctx context.Context, ownerID, hostname string) error
+	// ConfirmClaim переносит подтвержденную заявку в домены и удаляет все заявки на этот хост.
+	// Если домен уже закреплен за другим владельцем, возвращает ErrDomainExists.
+	ConfirmClaim(ctx context.Context, claim *models.DomainClaim) (*models.Domain, error)
 }
 
+// CacheRepository - необязательный кэш: ошибки его методов не должны ломать запрос,
+// сервис в этом случае обращается к базе
 type CacheRepository interface {
-	GetURL(ctx context.Context, shortCode string) (*models.URL, error)
-	SetURL(ctx context.Context, url *models.URL) error
-	DeleteURL(ctx context.Context, shortCode string) error
+	// GetURL возвращает ссылку и оставшееся время жизни записи. Промах - (nil, 0, nil).
+	GetURL(ctx context.Context, domain, shortCode string) (*models.URL, time.Duration, error)
+	SetURL(ctx context.Context, url *models.URL, ttl time.Duration) error
+	// SetNotFound запоминает отсутствие ссылки, чтобы перебор случайных кодов не доходил до базы.
+	// Уже закэшированная ссылка не перезаписывается.
+	SetNotFound(ctx context.Context, domain, shortCode string, ttl time.Duration) error
+	DeleteURL(ctx context.Context, domain, shortCode string) error
 }
@@ -0,0 +1,99 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"url-shortener/internal/models"
+)
+
+type PostgresAlertRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresAlertRepo(db *sql.DB) *PostgresAlertRepo {
+	return &PostgresAlertRepo{db: db}
+}
+
+// Create записывает оповещение. Оповещение того же вида по ссылке в том же окне уже
+// могло быть записано другим экземпляром детектора: тогда возвращается false.
+func (p *PostgresAlertRepo) Create(ctx context.Context, alert *models.Alert) (bool, error) {
+	if alert.CreatedAt.IsZero() {
+		alert.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO alerts (url_id, owner_id, kind, clicks, baseline_mean, baseline_stddev, z_score, auto_disabled, window_start, created_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+              ON CONFLICT (url_id, kind, window_start) DO NOTHING
+              RETURNING id`
+
+	err := conn(ctx, p.db).QueryRowContext(
+		ctx,
+		query,
+		alert.URLID,
+		alert.OwnerID,
+		alert.Kind,
+		alert.Clicks,
+		alert.BaselineMean,
+		alert.BaselineStdDev,
+		alert.ZScore,
+		alert.AutoDisabled,
+		alert.WindowStart,
+		alert.CreatedAt,
+	).Scan(&alert.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to insert alert: %w", err)
+	}
+
+	return true, nil
+}
+
+func (p *PostgresAlertRepo) ListByOwner(ctx context.Context, ownerID string, limit int) ([]models.Alert, error) {
+	query := `SELECT a.id, a.url_id, a.owner_id, u.short_code, COALESCE(u.domain, ''), a.kind, a.clicks,
+                     a.baseline_mean, a.baseline_stddev, a.z_score, a.auto_disabled, a.window_start, a.created_at
+              FROM alerts a
+              JOIN urls u ON u.id = a.url_id
+              WHERE a.owner_id = $1
+              ORDER BY a.created_at DESC, a.id DESC
+              LIMIT $2`
+
+	rows, err := p.db.QueryContext(ctx, query, ownerID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var alerts []models.Alert
+	for rows.Next() {
+		var a models.Alert
+		if err := rows.Scan(
+			&a.ID,
+			&a.URLID,
+			&a.OwnerID,
+			&a.ShortCode,
+			&a.Domain,
+			&a.Kind,
+			&a.Clicks,
+			&a.BaselineMean,
+			&a.BaselineStdDev,
+			&a.ZScore,
+			&a.AutoDisabled,
+			&a.WindowStart,
+			&a.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan alert: %w", err)
+		}
+		alerts = append(alerts, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+}
@@ -7,20 +7,28 @@ import (
 	"fmt"
 	"time"
 	"url-shortener/internal/models"
+	"url-shortener/internal/tracing"
 )
 
 type PostgresClickRepo struct {
-	db *sql.DB
+	db       *sql.DB
+	replicas *DBRouter
 }
 
-func NewPostgresClickRepo(db *sql.DB) *PostgresClickRepo {
-	return &PostgresClickRepo{db: db}
+// NewPostgresClickRepo создает репозиторий кликов. Если replicas не nil, отчеты
+// строятся на репликах: небольшое отставание статистики допустимо.
+func NewPostgresClickRepo(db *sql.DB, replicas *DBRouter) *PostgresClickRepo {
+	return &PostgresClickRepo{db: db, replicas: replicas}
 }
 
-func (p *PostgresClickRepo) SaveClick(ctx context.Context, click *models.Click) error {
+// SaveClick сохраняет клик, увеличивает счетчик ссылки и возвращает его новое значение
+func (p *PostgresClickRepo) SaveClick(ctx context.Context, click *models.Click) (_ int, err error) {
+	ctx, span := startSpan(ctx, "clicks.SaveClick", tracing.AttrURLID.Int(click.URLID))
+	defer func() { endSpan(span, err) }()
+
 	tx, err := p.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 
 	defer func(tx *sql.Tx) {
@@ -34,56 +42,54 @@ func (p *PostgresClickRepo) SaveClick(ctx context.Context, click *models.Click)
 		click.CreatedAt = time.Now()
 	}
 
-	query := `INSERT INTO clicks (id, url_id, ip_address, user_agent, referer, created_at)
-              VALUES ($1, $2, $3, $4, $5, $6)`
+	query := `INSERT INTO clicks (url_id, ip_address, user_agent, referer, variant_id, source, created_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7)
+              RETURNING id`
 
 	err = tx.QueryRowContext(
 		ctx,
 		query,
-		click.ID,
 		click.URLID,
 		click.IPAddress,
 		click.UserAgent,
 		click.Referer,
+		click.VariantID,
+		click.Source,
 		click.CreatedAt,
 	).Scan(&click.ID)
 
 	if err != nil {
-		return fmt.Errorf("failed to insert click: %w", err)
+		return 0, fmt.Errorf("failed to insert click: %w", err)
 	}
 
 	UpdatedAt := time.Now()
 
-	query = `UPDATE urls SET click_count = click_count + 1, updated_at = $1 WHERE id = $2`
-
-	result, err := tx.ExecContext(ctx, query, UpdatedAt, click.URLID)
-	if err != nil {
-		return fmt.Errorf("failed to update click count: %w", err)
-	}
+	query = `UPDATE urls SET click_count = click_count + 1, updated_at = $1 WHERE id = $2 RETURNING click_count`
 
-	rowsAffected, err := result.RowsAffected()
+	var clickCount int
+	err = tx.QueryRowContext(ctx, query, UpdatedAt, click.URLID).Scan(&clickCount)
 	if err != nil {
-		return fmt.Errorf("failed to get affected rows: %w", err)
-	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("no URL found with id %s", click.URLID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("no URL found with id %d", click.URLID)
+		}
+		return 0, fmt.Errorf("failed to update click count: %w", err)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return nil
+	return clickCount, nil
 }
 
 func (p *PostgresClickRepo) GetAnalyticsByID(ctx context.Context, ID int) (*models.Analytics, error) {
 	var a models.Analytics
+	db, _ := reader(ctx, p.db, p.replicas)
 
 	query := `SELECT COUNT(*) as click_count FROM clicks WHERE url_id = $1 AND created_at > NOW() - INTERVAL '1 week'`
 
 	var totalClicks int
-	err := p.db.QueryRowContext(ctx, query, ID).Scan(&totalClicks)
+	err := db.QueryRowContext(ctx, query, ID).Scan(&totalClicks)
 	if err != nil {
 		return nil, err
 	}
@@ -97,7 +103,7 @@ func (p *PostgresClickRepo) GetAnalyticsByID(ctx context.Context, ID int) (*mode
 			GROUP BY TO_CHAR(created_at, 'YYYY-MM-DD')
 			ORDER BY day_date DESC`
 
-	rows, err := p.db.QueryContext(ctx, query, ID)
+	rows, err := db.QueryContext(ctx, query, ID)
 	if err != nil {
 		return nil, err
 	}
@@ -124,7 +130,7 @@ func (p *PostgresClickRepo) GetAnalyticsByID(ctx context.Context, ID int) (*mode
 			GROUP BY referer
 			ORDER BY referrer_count DESC`
 
-	rows, err = p.db.QueryContext(ctx, query, ID)
+	rows, err = db.QueryContext(ctx, query, ID)
 	if err != nil {
 		return nil, err
 	}
@@ -157,7 +163,7 @@ func (p *PostgresClickRepo) GetAnalyticsByID(ctx context.Context, ID int) (*mode
 			GROUP BY user_agent
 			ORDER BY browser_count DESC`
 
-	rows, err = p.db.QueryContext(ctx, query, ID)
+	rows, err = db.QueryContext(ctx, query, ID)
 	if err != nil {
 		return nil, err
 	}
@@ -176,13 +182,78 @@ func (p *PostgresClickRepo) GetAnalyticsByID(ctx context.Context, ID int) (*mode
 		return nil, err
 	}
 
+	query = `SELECT 
+				v.id,
+				v.destination_url,
+				v.weight,
+				COUNT(c.id) as variant_count,
+				v.retired_at IS NOT NULL as retired
+			FROM url_variants v
+			LEFT JOIN clicks c ON c.variant_id = v.id
+			WHERE v.url_id = $1
+			GROUP BY v.id, v.destination_url, v.weight, v.retired_at
+			ORDER BY v.id`
+
+	rows, err = db.QueryContext(ctx, query, ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var variantStat models.VariantStat
+		err := rows.Scan(&variantStat.VariantID, &variantStat.DestinationURL, &variantStat.Weight, &variantStat.Count, &variantStat.Retired)
+		if err != nil {
+			return nil, err
+		}
+		a.Variants = append(a.Variants, variantStat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `SELECT 
+				COALESCE(NULLIF(source, ''), 'direct') as click_source,
+				COUNT(*) as source_count
+			FROM clicks 
+			WHERE url_id = $1
+			GROUP BY click_source
+			ORDER BY source_count DESC`
+
+	rows, err = db.QueryContext(ctx, query, ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sourceStat models.SourceStat
+		err := rows.Scan(&sourceStat.Source, &sourceStat.Count)
+		if err != nil {
+			return nil, err
+		}
+		a.Sources = append(a.Sources, sourceStat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return &a, nil
 }
 
-func (r *PostgresClickRepo) GetAnalyticsByShortCode(ctx context.Context, shortCode string) (*models.Analytics, error) {
+func (r *PostgresClickRepo) GetAnalyticsByShortCode(ctx context.Context, domain, shortCode string) (_ *models.Analytics, err error) {
+	ctx, span := startSpan(ctx, "clicks.GetAnalyticsByShortCode", tracing.AttrShortCode.String(shortCode), tracing.AttrDomain.String(domain))
+	defer func() { endSpan(span, err) }()
+
 	var urlID int
-	query := `SELECT id FROM urls WHERE short_code = $1`
-	err := r.db.QueryRowContext(ctx, query, shortCode).Scan(&urlID)
+	query := `SELECT id FROM urls WHERE COALESCE(domain, '') = $1 AND short_code = $2`
+	db, replica := reader(ctx, r.db, r.replicas)
+	err = db.QueryRowContext(ctx, query, domain, shortCode).Scan(&urlID)
+	if replica && errors.Is(err, sql.ErrNoRows) {
+		err = r.db.QueryRowContext(ctx, query, domain, shortCode).Scan(&urlID)
+	}
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -192,3 +263,49 @@ func (r *PostgresClickRepo) GetAnalyticsByShortCode(ctx context.Context, shortCo
 
 	return r.GetAnalyticsByID(ctx, urlID)
 }
+
+// ClickCountsByWindow возвращает число переходов по каждой ссылке в windows+1 последовательных
+// окнах длиной window, заканчивающихся в now. Индекс 0 - последнее окно, остальные - история.
+// Ссылки без переходов за весь период в результат не попадают.
+func (p *PostgresClickRepo) ClickCountsByWindow(ctx context.Context, now time.Time, window time.Duration, windows int) (_ map[int][]int, err error) {
+	ctx, span := startSpan(ctx, "clicks.ClickCountsByWindow")
+	defer func() { endSpan(span, err) }()
+
+	query := `SELECT
+				url_id,
+				FLOOR(EXTRACT(EPOCH FROM ($1::timestamp - created_at)) / $2::float8)::int as bucket,
+				COUNT(*) as bucket_count
+			FROM clicks
+			WHERE created_at > $1::timestamp - make_interval(secs => $2::float8 * $3::int) AND created_at <= $1::timestamp
+			GROUP BY url_id, bucket`
+
+	seconds := window.Seconds()
+	db, _ := reader(ctx, p.db, p.replicas)
+	rows, err := db.QueryContext(ctx, query, now, seconds, windows+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count clicks by window: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int][]int)
+	for rows.Next() {
+		var urlID, bucket, count int
+		if err := rows.Scan(&urlID, &bucket, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan click counts: %w", err)
+		}
+		if bucket < 0 || bucket > windows {
+			continue
+		}
+		if counts[urlID] == nil {
+			counts[urlID] = make([]int, windows+1)
+		}
+		counts[urlID][bucket] += count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(tracing.AttrRows.Int(len(counts)))
+
+	return counts, nil
+}
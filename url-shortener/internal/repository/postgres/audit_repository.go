@@ -0,0 +1,82 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+	"url-shortener/internal/models"
+)
+
+type PostgresAuditRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresAuditRepo(db *sql.DB) *PostgresAuditRepo {
+	return &PostgresAuditRepo{db: db}
+}
+
+// Record записывает изменение. Внутри WithinTx запись попадает в ту же транзакцию, что и само изменение.
+func (p *PostgresAuditRepo) Record(ctx context.Context, entry *models.AuditEntry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit changes: %w", err)
+	}
+
+	query := `INSERT INTO audit_log (url_id, actor, action, changes, created_at)
+              VALUES ($1, $2, $3, $4, $5)
+              RETURNING id`
+
+	err = conn(ctx, p.db).QueryRowContext(
+		ctx,
+		query,
+		entry.URLID,
+		entry.Actor,
+		entry.Action,
+		changes,
+		entry.CreatedAt,
+	).Scan(&entry.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+
+	return nil
+}
+
+func (p *PostgresAuditRepo) ListByURLID(ctx context.Context, urlID int) ([]models.AuditEntry, error) {
+	query := `SELECT id, url_id, actor, action, changes, created_at
+              FROM audit_log WHERE url_id = $1
+              ORDER BY created_at DESC, id DESC`
+
+	rows, err := p.db.QueryContext(ctx, query, urlID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.AuditEntry
+	for rows.Next() {
+		var entry models.AuditEntry
+		var changes []byte
+		if err := rows.Scan(&entry.ID, &entry.URLID, &entry.Actor, &entry.Action, &changes, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		if len(changes) > 0 {
+			if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal audit changes: %w", err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,264 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+)
+
+type PostgresDomainRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresDomainRepo(db *sql.DB) *PostgresDomainRepo {
+	return &PostgresDomainRepo{db: db}
+}
+
+const domainColumns = `id, hostname, owner_id, fallback_mode, COALESCE(fallback_url, ''),
+              COALESCE(fallback_template, ''), created_at`
+
+func scanDomain(row rowScanner) (*models.Domain, error) {
+	var d models.Domain
+	err := row.Scan(&d.ID, &d.Hostname, &d.OwnerID, &d.FallbackMode, &d.FallbackURL, &d.FallbackTemplate, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (p *PostgresDomainRepo) Create(ctx context.Context, domain *models.Domain) error {
+	if domain.CreatedAt.IsZero() {
+		domain.CreatedAt = time.Now()
+	}
+	if domain.FallbackMode == "" {
+		domain.FallbackMode = models.FallbackModePage
+	}
+
+	query := `INSERT INTO domains (hostname, owner_id, fallback_mode, created_at)
+              VALUES ($1, $2, $3, $4)
+              RETURNING id`
+
+	err := p.db.QueryRowContext(ctx, query, domain.Hostname, domain.OwnerID, domain.FallbackMode, domain.CreatedAt).Scan(&domain.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert domain: %w", err)
+	}
+
+	return nil
+}
+
+func (p *PostgresDomainRepo) GetByHostname(ctx context.Context, hostname string) (*models.Domain, error) {
+	query := `SELECT ` + domainColumns + ` FROM domains WHERE hostname = $1`
+
+	d, err := scanDomain(p.db.QueryRowContext(ctx, query, hostname))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("failed to scan domain: %w", err)
+	}
+
+	return d, nil
+}
+
+func (p *PostgresDomainRepo) ListByOwner(ctx context.Context, ownerID string) ([]models.Domain, error) {
+	query := `SELECT ` + domainColumns + ` FROM domains WHERE owner_id = $1 ORDER BY hostname`
+	return p.list(ctx, query, ownerID)
+}
+
+func (p *PostgresDomainRepo) ListAll(ctx context.Context) ([]models.Domain, error) {
+	query := `SELECT ` + domainColumns + ` FROM domains ORDER BY hostname`
+	return p.list(ctx, query)
+}
+
+func (p *PostgresDomainRepo) list(ctx context.Context, query string, args ...any) ([]models.Domain, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domains: %w", err)
+	}
+	defer rows.Close()
+
+	var domains []models.Domain
+	for rows.Next() {
+		d, err := scanDomain(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan domain: %w", err)
+		}
+		domains = append(domains, *d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return domains, nil
+}
+
+// UpdateFallback сохраняет настройки страницы-заглушки домена
+func (p *PostgresDomainRepo) UpdateFallback(ctx context.Context, domain *models.Domain) error {
+	query := `UPDATE domains SET fallback_mode = $1, fallback_url = NULLIF($2, ''), fallback_template = NULLIF($3, '')
+              WHERE hostname = $4`
+
+	result, err := p.db.ExecContext(ctx, query, domain.FallbackMode, domain.FallbackURL, domain.FallbackTemplate, domain.Hostname)
+	if err != nil {
+		return fmt.Errorf("failed to update domain fallback: %w", err)
+	}
+
+	rowsAffect, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rowsAffect == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// CountURLs возвращает число ссылок на домене, включая удаленные
+func (p *PostgresDomainRepo) CountURLs(ctx context.Context, hostname string) (int, error) {
+	var count int
+	err := p.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM urls WHERE domain = $1`, hostname).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count domain URLs: %w", err)
+	}
+	return count, nil
+}
+
+func (p *PostgresDomainRepo) Delete(ctx context.Context, hostname string) error {
+	result, err := p.db.ExecContext(ctx, `DELETE FROM domains WHERE hostname = $1`, hostname)
+	if err != nil {
+		return fmt.Errorf("failed to delete domain: %w", err)
+	}
+
+	rowsAffect, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rowsAffect == 0 {
+		return fmt.Errorf("domain %s not found", hostname)
+	}
+
+	return nil
+}
+
+const claimColumns = `id, hostname, owner_id, token, created_at`
+
+func scanClaim(row rowScanner) (*models.DomainClaim, error) {
+	var c models.DomainClaim
+	if err := row.Scan(&c.ID, &c.Hostname, &c.OwnerID, &c.Token, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (p *PostgresDomainRepo) CreateClaim(ctx context.Context, claim *models.DomainClaim) error {
+	if claim.CreatedAt.IsZero() {
+		claim.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO domain_claims (hostname, owner_id, token, created_at)
+              VALUES ($1, $2, $3, $4)
+              RETURNING id`
+
+	err := p.db.QueryRowContext(ctx, query, claim.Hostname, claim.OwnerID, claim.Token, claim.CreatedAt).Scan(&claim.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert domain claim: %w", err)
+	}
+
+	return nil
+}
+
+func (p *PostgresDomainRepo) GetClaim(ctx context.Context, ownerID, hostname string) (*models.DomainClaim, error) {
+	query := `SELECT ` + claimColumns + ` FROM domain_claims WHERE hostname = $1 AND owner_id = $2`
+
+	c, err := scanClaim(p.db.QueryRowContext(ctx, query, hostname, ownerID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("failed to scan domain claim: %w", err)
+	}
+
+	return c, nil
+}
+
+func (p *PostgresDomainRepo) ListClaimsByOwner(ctx context.Context, ownerID string) ([]models.DomainClaim, error) {
+	query := `SELECT ` + claimColumns + ` FROM domain_claims WHERE owner_id = $1 ORDER BY hostname`
+
+	rows, err := p.db.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domain claims: %w", err)
+	}
+	defer rows.Close()
+
+	var claims []models.DomainClaim
+	for rows.Next() {
+		c, err := scanClaim(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan domain claim: %w", err)
+		}
+		claims = append(claims, *c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (p *PostgresDomainRepo) DeleteClaim(ctx context.Context, ownerID, hostname string) error {
+	result, err := p.db.ExecContext(ctx, `DELETE FROM domain_claims WHERE hostname = $1 AND owner_id = $2`, hostname, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to delete domain claim: %w", err)
+	}
+
+	rowsAffect, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rowsAffect == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (p *PostgresDomainRepo) ConfirmClaim(ctx context.Context, claim *models.DomainClaim) (*models.Domain, error) {
+	domain := &models.Domain{
+		Hostname:     claim.Hostname,
+		OwnerID:      claim.OwnerID,
+		FallbackMode: models.FallbackModePage,
+		CreatedAt:    time.Now(),
+	}
+
+	err := withinTx(ctx, p.db, func(ctx context.Context) error {
+		tx := conn(ctx, p.db)
+
+		query := `INSERT INTO domains (hostname, owner_id, fallback_mode, created_at)
+	              VALUES ($1, $2, $3, $4)
+	              RETURNING id`
+		err := tx.QueryRowContext(ctx, query, domain.Hostname, domain.OwnerID, domain.FallbackMode, domain.CreatedAt).Scan(&domain.ID)
+		if isUniqueViolation(err, "domains_hostname_key") {
+			return repository.ErrDomainExists
+		}
+		if err != nil {
+			return fmt.Errorf("failed to insert domain: %w", err)
+		}
+
+		// Заявки других арендаторов на этот хост больше не могут быть подтверждены
+		if _, err := tx.ExecContext(ctx, `DELETE FROM domain_claims WHERE hostname = $1`, claim.Hostname); err != nil {
+			return fmt.Errorf("failed to delete domain claims: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return domain, nil
+}
@@ -0,0 +1,16 @@
+package postgres
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// uniqueViolation - код ошибки PostgreSQL при нарушении уникального индекса
+const uniqueViolation = "23505"
+
+// isUniqueViolation сообщает, что запрос нарушил уникальный индекс или ограничение constraint
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation && pqErr.Constraint == constraint
+}
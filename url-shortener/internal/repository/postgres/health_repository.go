@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"url-shortener/internal/models"
+)
+
+type PostgresHealthRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresHealthRepo(db *sql.DB) *PostgresHealthRepo {
+	return &PostgresHealthRepo{db: db}
+}
+
+// Save сохраняет результат последней проверки. Счетчик неудач подряд сбрасывается при успешной проверке.
+func (p *PostgresHealthRepo) Save(ctx context.Context, h *models.URLHealth) error {
+	query := `INSERT INTO url_health (url_id, healthy, status_code, latency_ms, final_url, error, consecutive_failures, checked_at)
+              VALUES ($1, $2, NULLIF($3, 0), $4, NULLIF($5, ''), NULLIF($6, ''), CASE WHEN $2 THEN 0 ELSE 1 END, $7)
+              ON CONFLICT (url_id) DO UPDATE SET
+                  healthy = EXCLUDED.healthy,
+                  status_code = EXCLUDED.status_code,
+                  latency_ms = EXCLUDED.latency_ms,
+                  final_url = EXCLUDED.final_url,
+                  error = EXCLUDED.error,
+                  consecutive_failures = CASE WHEN EXCLUDED.healthy THEN 0 ELSE url_health.consecutive_failures + 1 END,
+                  checked_at = EXCLUDED.checked_at
+              RETURNING consecutive_failures`
+
+	err := p.db.QueryRowContext(
+		ctx,
+		query,
+		h.URLID,
+		h.Healthy,
+		h.StatusCode,
+		h.LatencyMS,
+		h.FinalURL,
+		h.Error,
+		h.CheckedAt,
+	).Scan(&h.ConsecutiveFailures)
+	if err != nil {
+		return fmt.Errorf("failed to save URL health: %w", err)
+	}
+
+	return nil
+}
+
+const healthColumns = `h.url_id, u.short_code, u.original_url, h.healthy, COALESCE(h.status_code, 0), h.latency_ms,
+       COALESCE(h.final_url, ''), COALESCE(h.error, ''), h.consecutive_failures, h.checked_at`
+
+func scanHealth(row rowScanner) (*models.URLHealth, error) {
+	var h models.URLHealth
+	if err := row.Scan(
+		&h.URLID,
+		&h.ShortCode,
+		&h.OriginalURL,
+		&h.Healthy,
+		&h.StatusCode,
+		&h.LatencyMS,
+		&h.FinalURL,
+		&h.Error,
+		&h.ConsecutiveFailures,
+		&h.CheckedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// GetByURLID возвращает результат последней проверки или nil, если ссылку еще не проверяли
+func (p *PostgresHealthRepo) GetByURLID(ctx context.Context, urlID int) (*models.URLHealth, error) {
+	query := `SELECT ` + healthColumns + `
+              FROM url_health h JOIN urls u ON u.id = h.url_id
+              WHERE h.url_id = $1`
+
+	h, err := scanHealth(p.db.QueryRowContext(ctx, query, urlID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get URL health: %w", err)
+	}
+
+	return h, nil
+}
+
+// ListBroken возвращает неработающие ссылки владельца, начиная с самых свежих проверок
+func (p *PostgresHealthRepo) ListBroken(ctx context.Context, ownerID string) ([]models.URLHealth, error) {
+	query := `SELECT ` + healthColumns + `
+              FROM url_health h JOIN urls u ON u.id = h.url_id
+              WHERE u.owner_id = $1 AND NOT h.healthy AND u.deleted_at IS NULL
+              ORDER BY h.checked_at DESC`
+
+	rows, err := p.db.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list broken URLs: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.URLHealth
+	for rows.Next() {
+		h, err := scanHealth(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan URL health: %w", err)
+		}
+		result = append(result, *h)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
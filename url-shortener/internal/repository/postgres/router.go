@@ -0,0 +1,190 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/repository"
+)
+
+// replicaLagQuery возвращает отставание реплики в секундах. Реплика, проигравшая весь
+// полученный WAL, считается догнавшей: иначе при простое основной базы время последней
+// транзакции устаревает и отставание растет без реальной задержки. Но это верно, только
+// пока WAL поступает: без потоковой репликации запрос возвращает NULL. Статус приемника
+// виден роли с правами pg_read_all_stats.
+const replicaLagQuery = `SELECT CASE
+		WHEN NOT pg_is_in_recovery() THEN 0
+		WHEN NOT EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE status = 'streaming') THEN NULL
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END`
+
+// Replica - реплика для чтения
+type Replica struct {
+	Name string
+	DB   *sql.DB
+}
+
+// RouterConfig задает проверку состояния реплик
+type RouterConfig struct {
+	HealthInterval time.Duration // Как часто проверяются реплики
+	HealthTimeout  time.Duration // Таймаут одной проверки
+	MaxLag         time.Duration // Реплика с большим отставанием не получает запросов, 0 - не проверять
+}
+
+type replica struct {
+	Replica
+	healthy atomic.Bool
+}
+
+// DBRouter распределяет чтения по исправным репликам по кругу. Записи и чтения,
+// требующие свежих данных, идут в основную базу; без исправных реплик - тоже.
+type DBRouter struct {
+	primary  *sql.DB
+	replicas []*replica
+	next     atomic.Uint64
+	cfg      RouterConfig
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewDBRouter(primary *sql.DB, replicas []Replica, cfg RouterConfig) *DBRouter {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &DBRouter{
+		primary: primary,
+		cfg:     cfg,
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	// До первой проверки реплика считается исправной, чтобы ее отказ попал в журнал
+	for _, rep := range replicas {
+		rr := &replica{Replica: rep}
+		rr.healthy.Store(true)
+		r.replicas = append(r.replicas, rr)
+	}
+	return r
+}
+
+// Primary возвращает основную базу
+func (r *DBRouter) Primary() *sql.DB {
+	return r.primary
+}
+
+// Replicas возвращает настроенные реплики
+func (r *DBRouter) Replicas() []Replica {
+	replicas := make([]Replica, len(r.replicas))
+	for i, rep := range r.replicas {
+		replicas[i] = rep.Replica
+	}
+	return replicas
+}
+
+// Reader возвращает базу для чтения и признак того, что это реплика
+func (r *DBRouter) Reader(ctx context.Context) (*sql.DB, bool) {
+	if len(r.replicas) == 0 || repository.UsePrimary(ctx) {
+		return r.primary, false
+	}
+
+	start := r.next.Add(1)
+	for i := range r.replicas {
+		rep := r.replicas[(start+uint64(i))%uint64(len(r.replicas))]
+		if rep.healthy.Load() {
+			return rep.DB, true
+		}
+	}
+	return r.primary, false
+}
+
+// CheckReplicas проверяет доступность и отставание всех реплик. Вызывается до начала
+// работы, чтобы недоступная при старте реплика не получила ни одного запроса.
+func (r *DBRouter) CheckReplicas(ctx context.Context) {
+	for _, rep := range r.replicas {
+		err := r.check(ctx, rep)
+		if ctx.Err() != nil {
+			return
+		}
+
+		healthy := err == nil
+		if rep.healthy.Swap(healthy) != healthy {
+			if healthy {
+				slog.InfoContext(ctx, "postgres replica recovered", "replica", rep.Name)
+			} else {
+				slog.WarnContext(ctx, "postgres replica is unhealthy, reading from other nodes", "replica", rep.Name, "error", err)
+			}
+		}
+		if healthy {
+			metrics.ReplicaHealthy.WithLabelValues(rep.Name).Set(1)
+		} else {
+			metrics.ReplicaHealthy.WithLabelValues(rep.Name).Set(0)
+		}
+	}
+}
+
+func (r *DBRouter) check(ctx context.Context, rep *replica) error {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.HealthTimeout)
+	defer cancel()
+
+	var result sql.NullFloat64
+	if err := rep.DB.QueryRowContext(ctx, replicaLagQuery).Scan(&result); err != nil {
+		return err
+	}
+	if !result.Valid {
+		return errors.New("replica is not streaming WAL from the primary")
+	}
+	lag := result.Float64
+	metrics.ReplicaLag.WithLabelValues(rep.Name).Set(lag)
+
+	if r.cfg.MaxLag > 0 && lag > r.cfg.MaxLag.Seconds() {
+		return fmt.Errorf("replication lag %.1fs exceeds %s", lag, r.cfg.MaxLag)
+	}
+	return nil
+}
+
+func (r *DBRouter) Start() {
+	go r.run()
+}
+
+func (r *DBRouter) run() {
+	defer close(r.done)
+	if len(r.replicas) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(r.cfg.HealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			r.CheckReplicas(r.ctx)
+		}
+	}
+}
+
+// Shutdown останавливает проверки и закрывает соединения с репликами
+func (r *DBRouter) Shutdown() {
+	r.cancel()
+	<-r.done
+	for _, rep := range r.replicas {
+		rep.DB.Close()
+	}
+}
+
+// reader выбирает базу для чтения. Внутри транзакции чтение идет в ней же,
+// без маршрутизатора - в основную базу.
+func reader(ctx context.Context, primary *sql.DB, router *DBRouter) (dbtx, bool) {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok || router == nil {
+		return conn(ctx, primary), false
+	}
+	return router.Reader(ctx)
+}
@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"url-shortener/internal/models"
+)
+
+type PostgresScheduleRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresScheduleRepo(db *sql.DB) *PostgresScheduleRepo {
+	return &PostgresScheduleRepo{db: db}
+}
+
+func (p *PostgresScheduleRepo) GetByURLID(ctx context.Context, urlID int) ([]models.URLScheduleEntry, error) {
+	query := `SELECT id, url_id, starts_at, destination_url, created_at FROM url_schedule WHERE url_id = $1 ORDER BY starts_at`
+
+	rows, err := p.db.QueryContext(ctx, query, urlID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schedule: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.URLScheduleEntry
+	for rows.Next() {
+		var e models.URLScheduleEntry
+		if err := rows.Scan(&e.ID, &e.URLID, &e.StartsAt, &e.DestinationURL, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schedule entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// ReplaceForURL атомарно заменяет расписание ссылки. Пустой набор отключает смену адресов.
+func (p *PostgresScheduleRepo) ReplaceForURL(ctx context.Context, urlID int, entries []models.URLScheduleEntry) error {
+	return withinTx(ctx, p.db, func(ctx context.Context) error {
+		tx := conn(ctx, p.db)
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM url_schedule WHERE url_id = $1`, urlID); err != nil {
+			return fmt.Errorf("failed to delete schedule: %w", err)
+		}
+
+		query := `INSERT INTO url_schedule (url_id, starts_at, destination_url, created_at)
+	              VALUES ($1, $2, $3, $4)
+	              RETURNING id`
+
+		for i := range entries {
+			entries[i].URLID = urlID
+			if entries[i].CreatedAt.IsZero() {
+				entries[i].CreatedAt = time.Now()
+			}
+
+			err := tx.QueryRowContext(
+				ctx,
+				query,
+				entries[i].URLID,
+				entries[i].StartsAt,
+				entries[i].DestinationURL,
+				entries[i].CreatedAt,
+			).Scan(&entries[i].ID)
+			if err != nil {
+				return fmt.Errorf("failed to insert schedule entry: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,29 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"url-shortener/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan начинает клиентский спан запроса к Postgres
+func startSpan(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs,
+		attribute.String("db.system.name", "postgresql"),
+		attribute.String("db.operation.name", op),
+	)
+	return tracing.Tracer().Start(ctx, "postgres."+op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan завершает спан. Отсутствие строки - обычный результат поиска, а не ошибка.
+func endSpan(span trace.Span, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		span.SetAttributes(tracing.AttrRows.Int(0))
+		err = nil
+	}
+	tracing.End(span, err)
+}
@@ -7,17 +7,87 @@ import (
 	"fmt"
 	"time"
 	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// urlColumns - список колонок, которые читает scanURL, в том же порядке
+const urlColumns = `id, owner_id, COALESCE(domain, ''), original_url, COALESCE(canonical_url, ''), COALESCE(canonical_hash, ''),
+       short_code, created_at, updated_at, click_count, disabled, COALESCE(disabled_reason, ''), deleted_at,
+       COALESCE(og_title, ''), COALESCE(og_description, ''), COALESCE(og_image, ''),
+       COALESCE(ios_deep_link, ''), COALESCE(ios_store_url, ''), COALESCE(android_deep_link, ''), COALESCE(android_store_url, ''),
+       query_passthrough, path_passthrough, active_from, active_until, pending_behavior`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanURL(row rowScanner) (*models.URL, error) {
+	var url models.URL
+	if err := row.Scan(
+		&url.ID,
+		&url.OwnerID,
+		&url.Domain,
+		&url.OriginalURL,
+		&url.CanonicalURL,
+		&url.CanonicalHash,
+		&url.ShortCode,
+		&url.CreatedAt,
+		&url.UpdatedAt,
+		&url.ClickCount,
+		&url.Disabled,
+		&url.DisabledReason,
+		&url.DeletedAt,
+		&url.OGTitle,
+		&url.OGDescription,
+		&url.OGImage,
+		&url.IOSDeepLink,
+		&url.IOSStoreURL,
+		&url.AndroidDeepLink,
+		&url.AndroidStoreURL,
+		&url.QueryPassthrough,
+		&url.PathPassthrough,
+		&url.ActiveFrom,
+		&url.ActiveUntil,
+		&url.PendingBehavior,
+	); err != nil {
+		return nil, err
+	}
+	return &url, nil
+}
+
 type PostgresURLRepo struct {
-	db *sql.DB
+	db       *sql.DB
+	replicas *DBRouter
 }
 
-func NewPostgresURLRepo(db *sql.DB) *PostgresURLRepo {
-	return &PostgresURLRepo{db: db}
+// NewPostgresURLRepo создает репозиторий ссылок. Если replicas не nil, поиск ссылки
+// по коду и идентификатору идет на реплики, остальные запросы - в db.
+func NewPostgresURLRepo(db *sql.DB, replicas *DBRouter) *PostgresURLRepo {
+	return &PostgresURLRepo{db: db, replicas: replicas}
+}
+
+// findURL читает одну ссылку с реплики. Только что созданной ссылки на реплике может
+// еще не быть, поэтому отсутствие строки перепроверяется в основной базе.
+func (p *PostgresURLRepo) findURL(ctx context.Context, span trace.Span, query string, args ...any) (*models.URL, error) {
+	db, replica := reader(ctx, p.db, p.replicas)
+	span.SetAttributes(attribute.Bool("db.replica", replica))
+
+	url, err := scanURL(db.QueryRowContext(ctx, query, args...))
+	if replica && errors.Is(err, sql.ErrNoRows) {
+		span.AddEvent("not found on replica, retrying on primary")
+		url, err = scanURL(p.db.QueryRowContext(ctx, query, args...))
+	}
+	return url, err
 }
 
-func (p *PostgresURLRepo) Create(ctx context.Context, url *models.URL) error {
+func (p *PostgresURLRepo) Create(ctx context.Context, url *models.URL) (err error) {
+	ctx, span := startSpan(ctx, "urls.Create", tracing.AttrShortCode.String(url.ShortCode), tracing.AttrDomain.String(url.Domain))
+	defer func() { endSpan(span, err) }()
+
 	if url.CreatedAt.IsZero() {
 		url.CreatedAt = time.Now()
 	}
@@ -27,15 +97,19 @@ func (p *PostgresURLRepo) Create(ctx context.Context, url *models.URL) error {
 	}
 
 	query := `
-		INSERT INTO urls (original_url, short_code, created_at, updated_at, click_count)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO urls (owner_id, domain, original_url, canonical_url, canonical_hash, short_code, created_at, updated_at, click_count)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id
 	`
 
-	err := p.db.QueryRowContext(
+	err = conn(ctx, p.db).QueryRowContext(
 		ctx,
 		query,
+		url.OwnerID,
+		url.Domain,
 		url.OriginalURL,
+		url.CanonicalURL,
+		url.CanonicalHash,
 		url.ShortCode,
 		url.CreatedAt,
 		url.UpdatedAt,
@@ -43,6 +117,9 @@ func (p *PostgresURLRepo) Create(ctx context.Context, url *models.URL) error {
 	).Scan(&url.ID)
 
 	if err != nil {
+		if isUniqueViolation(err, "idx_urls_domain_short_code") {
+			return repository.ErrShortCodeTaken
+		}
 		return fmt.Errorf("failed to insert URL: %w", err)
 	}
 
@@ -66,63 +143,76 @@ func (p *PostgresClickRepo) IncrementClickCount(ctx context.Context, ID int) err
 	return nil
 }
 
-func (p *PostgresURLRepo) GetByID(ctx context.Context, ID int) (*models.URL, error) {
-	query := `SELECT id, original_url, short_code, created_at, updated_at, click_count FROM urls WHERE id = $1`
+func (p *PostgresURLRepo) GetByID(ctx context.Context, ID int) (_ *models.URL, err error) {
+	ctx, span := startSpan(ctx, "urls.GetByID", tracing.AttrURLID.Int(ID))
+	defer func() { endSpan(span, err) }()
 
-	row := p.db.QueryRowContext(ctx, query, ID)
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE id = $1`
 
-	var url models.URL
-	if err := row.Scan(
-		&url.ID,
-		&url.OriginalURL,
-		&url.ShortCode,
-		&url.CreatedAt,
-		&url.UpdatedAt,
-		&url.ClickCount,
-	); err != nil {
+	url, err := p.findURL(ctx, span, query, ID)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, sql.ErrNoRows
 		}
 		return nil, fmt.Errorf("failed to scan task: %w", err)
 	}
 
-	return &url, nil
+	return url, nil
 }
 
-func (p *PostgresURLRepo) FindByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
-	query := `SELECT id, original_url, short_code, created_at, updated_at, click_count FROM urls WHERE short_code = $1`
+func (p *PostgresURLRepo) FindByShortCode(ctx context.Context, domain, shortCode string) (_ *models.URL, err error) {
+	ctx, span := startSpan(ctx, "urls.FindByShortCode", tracing.AttrShortCode.String(shortCode), tracing.AttrDomain.String(domain))
+	defer func() { endSpan(span, err) }()
 
-	row := p.db.QueryRowContext(ctx, query, shortCode)
-	var url models.URL
-	if err := row.Scan(
-		&url.ID,
-		&url.OriginalURL,
-		&url.ShortCode,
-		&url.CreatedAt,
-		&url.UpdatedAt,
-		&url.ClickCount,
-	); err != nil {
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE COALESCE(domain, '') = $1 AND short_code = $2`
+
+	url, err := p.findURL(ctx, span, query, domain, shortCode)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, sql.ErrNoRows
 		}
 		return nil, fmt.Errorf("failed to scan URL: %w", err)
 	}
 
-	return &url, nil
+	return url, nil
 }
 
-func (p *PostgresURLRepo) Update(ctx context.Context, url *models.URL) error {
+func (p *PostgresURLRepo) Update(ctx context.Context, url *models.URL) (err error) {
+	ctx, span := startSpan(ctx, "urls.Update", tracing.AttrURLID.Int(url.ID))
+	defer func() { endSpan(span, err) }()
+
 	url.UpdatedAt = time.Now()
 
-	query := `UPDATE urls SET original_url = $1, short_code = $2, updated_at = $3, click_count = $4 WHERE id = $5`
+	query := `UPDATE urls SET original_url = $1, canonical_url = $2, canonical_hash = $3, short_code = $4, updated_at = $5, click_count = $6,
+              og_title = NULLIF($7, ''), og_description = NULLIF($8, ''), og_image = NULLIF($9, ''),
+              ios_deep_link = NULLIF($10, ''), ios_store_url = NULLIF($11, ''),
+              android_deep_link = NULLIF($12, ''), android_store_url = NULLIF($13, ''),
+              query_passthrough = $14, path_passthrough = $15,
+              expiry_notified = CASE WHEN active_until IS DISTINCT FROM $17 THEN false ELSE expiry_notified END,
+              active_from = $16, active_until = $17, pending_behavior = $18
+              WHERE id = $19`
 
-	result, err := p.db.ExecContext(
+	result, err := conn(ctx, p.db).ExecContext(
 		ctx,
 		query,
 		url.OriginalURL,
+		url.CanonicalURL,
+		url.CanonicalHash,
 		url.ShortCode,
 		url.UpdatedAt,
 		url.ClickCount,
+		url.OGTitle,
+		url.OGDescription,
+		url.OGImage,
+		url.IOSDeepLink,
+		url.IOSStoreURL,
+		url.AndroidDeepLink,
+		url.AndroidStoreURL,
+		url.QueryPassthrough,
+		url.PathPassthrough,
+		url.ActiveFrom,
+		url.ActiveUntil,
+		url.PendingBehavior,
 		url.ID,
 	)
 
@@ -134,6 +224,7 @@ func (p *PostgresURLRepo) Update(ctx context.Context, url *models.URL) error {
 	if err != nil {
 		return fmt.Errorf("failed to get affected rows: %w", err)
 	}
+	span.SetAttributes(tracing.AttrRows.Int64(rowsAffect))
 	if rowsAffect == 0 {
 		return fmt.Errorf("task with id %d not found", url.ID)
 	}
@@ -142,9 +233,9 @@ func (p *PostgresURLRepo) Update(ctx context.Context, url *models.URL) error {
 }
 
 func (p *PostgresURLRepo) Delete(ctx context.Context, ID int) error {
-	query := `DELETE FROM urls WHERE id = $1`
+	query := `UPDATE urls SET deleted_at = $1, updated_at = $1 WHERE id = $2 AND deleted_at IS NULL`
 
-	row, err := p.db.ExecContext(ctx, query, ID)
+	row, err := conn(ctx, p.db).ExecContext(ctx, query, time.Now(), ID)
 	if err != nil {
 		return fmt.Errorf("failed to delete URL: %w", err)
 	}
@@ -159,26 +250,131 @@ func (p *PostgresURLRepo) Delete(ctx context.Context, ID int) error {
 	return nil
 }
 
-func (p *PostgresURLRepo) FindByOriginalURL(ctx context.Context, originalURL string) (*models.URL, error) {
-	query := `SELECT id, original_url, short_code, created_at, updated_at, click_count 
-              FROM urls WHERE original_url = $1`
+func (p *PostgresURLRepo) FindByCanonicalHash(ctx context.Context, ownerID, domain, hash string) (_ *models.URL, err error) {
+	ctx, span := startSpan(ctx, "urls.FindByCanonicalHash", tracing.AttrDomain.String(domain))
+	defer func() { endSpan(span, err) }()
 
-	var url models.URL
-	err := p.db.QueryRowContext(ctx, query, originalURL).Scan(
-		&url.ID,
-		&url.OriginalURL,
-		&url.ShortCode,
-		&url.CreatedAt,
-		&url.UpdatedAt,
-		&url.ClickCount,
-	)
+	query := `SELECT ` + urlColumns + `
+              FROM urls WHERE owner_id = $1 AND COALESCE(domain, '') = $2 AND canonical_hash = $3 AND deleted_at IS NULL
+              ORDER BY id LIMIT 1`
 
+	url, err := scanURL(p.db.QueryRowContext(ctx, query, ownerID, domain, hash))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
 		}
-		return nil, fmt.Errorf("failed to find URL by original: %w", err)
+		return nil, fmt.Errorf("failed to find URL by canonical hash: %w", err)
 	}
 
-	return &url, nil
+	return url, nil
+}
+
+// ListActive возвращает пачку включенных ссылок с id больше afterID, упорядоченных по id
+func (p *PostgresURLRepo) ListActive(ctx context.Context, afterID, limit int) ([]models.URL, error) {
+	query := `SELECT ` + urlColumns + `
+              FROM urls WHERE id > $1 AND NOT disabled AND deleted_at IS NULL
+              ORDER BY id LIMIT $2`
+
+	rows, err := p.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list URLs: %w", err)
+	}
+	defer rows.Close()
+
+	var urls []models.URL
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan URL: %w", err)
+		}
+		urls = append(urls, *url)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+func (p *PostgresURLRepo) ListShortCodes(ctx context.Context, afterID, limit int) ([]models.ShortCodeRef, error) {
+	query := `SELECT id, COALESCE(domain, ''), short_code FROM urls WHERE id > $1 ORDER BY id LIMIT $2`
+
+	rows, err := p.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list short codes: %w", err)
+	}
+	defer rows.Close()
+
+	var refs []models.ShortCodeRef
+	for rows.Next() {
+		var ref models.ShortCodeRef
+		if err := rows.Scan(&ref.ID, &ref.Domain, &ref.ShortCode); err != nil {
+			return nil, fmt.Errorf("failed to scan short code: %w", err)
+		}
+		refs = append(refs, ref)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
+
+// ClaimExpired помечает истекшие к моменту now ссылки как обработанные и возвращает их.
+// SKIP LOCKED не дает нескольким экземплярам сервиса обработать одну ссылку дважды.
+func (p *PostgresURLRepo) ClaimExpired(ctx context.Context, now time.Time, limit int) (_ []models.URL, err error) {
+	ctx, span := startSpan(ctx, "urls.ClaimExpired")
+	defer func() { endSpan(span, err) }()
+
+	query := `UPDATE urls SET expiry_notified = true
+              WHERE id IN (
+                  SELECT id FROM urls
+                  WHERE active_until <= $1 AND NOT expiry_notified AND deleted_at IS NULL
+                  ORDER BY active_until LIMIT $2
+                  FOR UPDATE SKIP LOCKED
+              )
+              RETURNING ` + urlColumns
+
+	rows, err := conn(ctx, p.db).QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim expired URLs: %w", err)
+	}
+	defer rows.Close()
+
+	var urls []models.URL
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan URL: %w", err)
+		}
+		urls = append(urls, *url)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(tracing.AttrRows.Int(len(urls)))
+
+	return urls, nil
+}
+
+func (p *PostgresURLRepo) SetDisabled(ctx context.Context, ID int, disabled bool, reason string) error {
+	query := `UPDATE urls SET disabled = $1, disabled_reason = NULLIF($2, ''), updated_at = $3 WHERE id = $4`
+
+	result, err := conn(ctx, p.db).ExecContext(ctx, query, disabled, reason, time.Now(), ID)
+	if err != nil {
+		return fmt.Errorf("failed to update URL state: %w", err)
+	}
+
+	rowsAffect, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rowsAffect == 0 {
+		return fmt.Errorf("url with id %d not found", ID)
+	}
+
+	return nil
 }
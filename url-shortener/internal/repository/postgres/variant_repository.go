@@ -0,0 +1,154 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+)
+
+type PostgresVariantRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresVariantRepo(db *sql.DB) *PostgresVariantRepo {
+	return &PostgresVariantRepo{db: db}
+}
+
+// GetByURLID возвращает действующие варианты ссылки
+func (p *PostgresVariantRepo) GetByURLID(ctx context.Context, urlID int) ([]models.URLVariant, error) {
+	query := `SELECT id, url_id, destination_url, weight, created_at FROM url_variants
+	          WHERE url_id = $1 AND retired_at IS NULL ORDER BY id`
+
+	rows, err := p.db.QueryContext(ctx, query, urlID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variants: %w", err)
+	}
+	defer rows.Close()
+
+	var variants []models.URLVariant
+	for rows.Next() {
+		var v models.URLVariant
+		if err := rows.Scan(&v.ID, &v.URLID, &v.DestinationURL, &v.Weight, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan variant: %w", err)
+		}
+		variants = append(variants, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return variants, nil
+}
+
+// ReplaceForURL атомарно заменяет набор вариантов ссылки. Пустой набор отключает A/B тест.
+// Вариант с ID, а без ID - с тем же адресом назначения, обновляется на месте, остальные
+// добавляются. Убранные варианты помечаются выведенными, а не удаляются: клики по ним
+// сохраняют привязку и остаются в статистике. Варианту без ID присваивается ID.
+func (p *PostgresVariantRepo) ReplaceForURL(ctx context.Context, urlID int, variants []models.URLVariant) error {
+	return withinTx(ctx, p.db, func(ctx context.Context) error {
+		tx := conn(ctx, p.db)
+
+		// Блокировка строк сериализует одновременные изменения теста одной ссылки
+		rows, err := tx.QueryContext(ctx, `SELECT id, destination_url FROM url_variants
+		                                   WHERE url_id = $1 AND retired_at IS NULL
+		                                   ORDER BY id FOR UPDATE`, urlID)
+		if err != nil {
+			return fmt.Errorf("failed to get variants: %w", err)
+		}
+		var current []models.URLVariant
+		for rows.Next() {
+			var v models.URLVariant
+			if err := rows.Scan(&v.ID, &v.DestinationURL); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan variant: %w", err)
+			}
+			current = append(current, v)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		kept := make(map[int]bool, len(current))
+		for i := range variants {
+			if variants[i].ID == 0 {
+				continue
+			}
+			if !containsVariant(current, variants[i].ID) || kept[variants[i].ID] {
+				return fmt.Errorf("%w: %d", repository.ErrUnknownVariant, variants[i].ID)
+			}
+			kept[variants[i].ID] = true
+		}
+		for i := range variants {
+			if variants[i].ID != 0 {
+				continue
+			}
+			for _, c := range current {
+				if !kept[c.ID] && c.DestinationURL == variants[i].DestinationURL {
+					variants[i].ID = c.ID
+					kept[c.ID] = true
+					break
+				}
+			}
+		}
+
+		for _, c := range current {
+			if kept[c.ID] {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE url_variants SET retired_at = now() WHERE id = $1`, c.ID); err != nil {
+				return fmt.Errorf("failed to retire variant: %w", err)
+			}
+		}
+
+		insert := `INSERT INTO url_variants (url_id, destination_url, weight, created_at)
+	               VALUES ($1, $2, $3, $4)
+	               RETURNING id`
+		update := `UPDATE url_variants SET destination_url = $2, weight = $3
+	               WHERE id = $1
+	               RETURNING created_at`
+
+		for i := range variants {
+			variants[i].URLID = urlID
+
+			if variants[i].ID != 0 {
+				err := tx.QueryRowContext(ctx, update, variants[i].ID, variants[i].DestinationURL, variants[i].Weight).
+					Scan(&variants[i].CreatedAt)
+				if err != nil {
+					return fmt.Errorf("failed to update variant: %w", err)
+				}
+				continue
+			}
+
+			if variants[i].CreatedAt.IsZero() {
+				variants[i].CreatedAt = time.Now()
+			}
+			err := tx.QueryRowContext(
+				ctx,
+				insert,
+				variants[i].URLID,
+				variants[i].DestinationURL,
+				variants[i].Weight,
+				variants[i].CreatedAt,
+			).Scan(&variants[i].ID)
+			if err != nil {
+				return fmt.Errorf("failed to insert variant: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func containsVariant(variants []models.URLVariant, id int) bool {
+	for _, v := range variants {
+		if v.ID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,422 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"url-shortener/internal/models"
+
+	"github.com/lib/pq"
+)
+
+type PostgresWebhookRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresWebhookRepo(db *sql.DB) *PostgresWebhookRepo {
+	return &PostgresWebhookRepo{db: db}
+}
+
+const webhookColumns = `id, owner_id, url, secret, events, click_thresholds, active, created_at`
+
+func scanWebhook(row rowScanner) (*models.Webhook, error) {
+	var w models.Webhook
+	var thresholds pq.Int64Array
+	if err := row.Scan(
+		&w.ID,
+		&w.OwnerID,
+		&w.URL,
+		&w.Secret,
+		pq.Array(&w.Events),
+		&thresholds,
+		&w.Active,
+		&w.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	w.ClickThresholds = make([]int, len(thresholds))
+	for i, t := range thresholds {
+		w.ClickThresholds[i] = int(t)
+	}
+	if w.Events == nil {
+		w.Events = []string{}
+	}
+
+	return &w, nil
+}
+
+func (p *PostgresWebhookRepo) Create(ctx context.Context, w *models.Webhook) error {
+	if w.CreatedAt.IsZero() {
+		w.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO webhooks (owner_id, url, secret, events, click_thresholds, active, created_at)
+              VALUES ($1, $2, $3, $4, $5, $6, $7)
+              RETURNING id`
+
+	err := p.db.QueryRowContext(
+		ctx,
+		query,
+		w.OwnerID,
+		w.URL,
+		w.Secret,
+		pq.Array(w.Events),
+		pq.Array(w.ClickThresholds),
+		w.Active,
+		w.CreatedAt,
+	).Scan(&w.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert webhook: %w", err)
+	}
+
+	return nil
+}
+
+func (p *PostgresWebhookRepo) GetByID(ctx context.Context, ID int) (*models.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1`
+
+	w, err := scanWebhook(p.db.QueryRowContext(ctx, query, ID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("failed to scan webhook: %w", err)
+	}
+
+	return w, nil
+}
+
+func (p *PostgresWebhookRepo) ListByOwner(ctx context.Context, ownerID string) ([]models.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE owner_id = $1 ORDER BY id`
+	return p.list(ctx, query, ownerID)
+}
+
+// ListSubscribed возвращает активные вебхуки владельца, подписанные на событие
+func (p *PostgresWebhookRepo) ListSubscribed(ctx context.Context, ownerID, event string) ([]models.Webhook, error) {
+	query := `SELECT ` + webhookColumns + `
+              FROM webhooks
+              WHERE owner_id = $1 AND active AND (cardinality(events) = 0 OR $2 = ANY(events))
+              ORDER BY id`
+	return p.list(ctx, query, ownerID, event)
+}
+
+// ListForClickThreshold возвращает активные вебхуки владельца ссылки, у которых
+// среди порогов есть clickCount и которые подписаны на событие порога кликов
+func (p *PostgresWebhookRepo) ListForClickThreshold(ctx context.Context, urlID, clickCount int) ([]models.Webhook, error) {
+	query := `SELECT w.id, w.owner_id, w.url, w.secret, w.events, w.click_thresholds, w.active, w.created_at
+              FROM webhooks w JOIN urls u ON u.owner_id = w.owner_id
+              WHERE u.id = $1 AND w.active AND $2 = ANY(w.click_thresholds)
+                AND (cardinality(w.events) = 0 OR $3 = ANY(w.events))
+              ORDER BY w.id`
+	return p.list(ctx, query, urlID, clickCount, models.EventLinkClickThreshold)
+}
+
+// ListClickThresholds возвращает различные пороги кликов всех активных вебхуков
+func (p *PostgresWebhookRepo) ListClickThresholds(ctx context.Context) ([]int, error) {
+	query := `SELECT DISTINCT unnest(click_thresholds) FROM webhooks WHERE active`
+
+	rows, err := p.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list click thresholds: %w", err)
+	}
+	defer rows.Close()
+
+	var thresholds []int
+	for rows.Next() {
+		var t int
+		if err := rows.Scan(&t); err != nil {
+			return nil, fmt.Errorf("failed to scan click threshold: %w", err)
+		}
+		thresholds = append(thresholds, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return thresholds, nil
+}
+
+func (p *PostgresWebhookRepo) list(ctx context.Context, query string, args ...any) ([]models.Webhook, error) {
+	rows, err := conn(ctx, p.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var webhooks []models.Webhook
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, *w)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (p *PostgresWebhookRepo) Delete(ctx context.Context, ID int) error {
+	result, err := p.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, ID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	rowsAffect, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rowsAffect == 0 {
+		return fmt.Errorf("webhook with id %d not found", ID)
+	}
+
+	return nil
+}
+
+func (p *PostgresWebhookRepo) EnqueueDelivery(ctx context.Context, d *models.WebhookDelivery) error {
+	now := time.Now()
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = now
+	}
+	if d.NextAttemptAt.IsZero() {
+		d.NextAttemptAt = now
+	}
+	if d.Status == "" {
+		d.Status = models.DeliveryStatusPending
+	}
+
+	query := `INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at)
+              VALUES ($1, $2, $3, $4, $5, $6)
+              RETURNING id`
+
+	err := conn(ctx, p.db).QueryRowContext(
+		ctx,
+		query,
+		d.WebhookID,
+		d.Event,
+		[]byte(d.Payload),
+		d.Status,
+		d.NextAttemptAt,
+		d.CreatedAt,
+	).Scan(&d.ID)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimDue забирает готовые к отправке доставки и откладывает их на lease, чтобы другие
+// экземпляры сервиса не отправили их повторно. SKIP LOCKED позволяет им работать параллельно.
+func (p *PostgresWebhookRepo) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	now := time.Now()
+
+	query := `WITH due AS (
+                  SELECT id FROM webhook_deliveries
+                  WHERE status = $1 AND next_attempt_at <= $2
+                  ORDER BY next_attempt_at
+                  LIMIT $3
+                  FOR UPDATE SKIP LOCKED
+              )
+              UPDATE webhook_deliveries d
+              SET next_attempt_at = $4
+              FROM due, webhooks w
+              WHERE d.id = due.id AND w.id = d.webhook_id
+              RETURNING d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.created_at, w.url, w.secret`
+
+	rows, err := p.db.QueryContext(ctx, query, models.DeliveryStatusPending, now, limit, now.Add(lease))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.CreatedAt, &d.WebhookURL, &d.Secret); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// SaveAttempt записывает попытку в журнал и обновляет состояние доставки в одной транзакции
+func (p *PostgresWebhookRepo) SaveAttempt(ctx context.Context, d *models.WebhookDelivery, attempt *models.WebhookAttempt) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if attempt.CreatedAt.IsZero() {
+		attempt.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO webhook_delivery_attempts (delivery_id, attempt, status_code, error, duration_ms, created_at)
+              VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, ''), $5, $6)
+              RETURNING id`
+
+	err = tx.QueryRowContext(
+		ctx,
+		query,
+		d.ID,
+		attempt.Attempt,
+		attempt.StatusCode,
+		attempt.Error,
+		attempt.DurationMS,
+		attempt.CreatedAt,
+	).Scan(&attempt.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert webhook attempt: %w", err)
+	}
+
+	query = `UPDATE webhook_deliveries
+             SET status = $1, attempts = $2, next_attempt_at = $3, last_status_code = NULLIF($4, 0),
+                 last_error = NULLIF($5, ''), delivered_at = $6
+             WHERE id = $7`
+
+	_, err = tx.ExecContext(
+		ctx,
+		query,
+		d.Status,
+		d.Attempts,
+		d.NextAttemptAt,
+		d.LastStatusCode,
+		d.LastError,
+		d.DeliveredAt,
+		d.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+const deliveryColumns = `id, webhook_id, event, payload, status, attempts, next_attempt_at,
+       COALESCE(last_status_code, 0), COALESCE(last_error, ''), created_at, delivered_at`
+
+func scanDelivery(row rowScanner) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	if err := row.Scan(
+		&d.ID,
+		&d.WebhookID,
+		&d.Event,
+		&d.Payload,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.LastStatusCode,
+		&d.LastError,
+		&d.CreatedAt,
+		&d.DeliveredAt,
+	); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (p *PostgresWebhookRepo) GetDelivery(ctx context.Context, ID int) (*models.WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE id = $1`
+
+	d, err := scanDelivery(p.db.QueryRowContext(ctx, query, ID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+	}
+
+	return d, nil
+}
+
+func (p *PostgresWebhookRepo) ListDeliveries(ctx context.Context, webhookID, limit int) ([]models.WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + `
+              FROM webhook_deliveries WHERE webhook_id = $1
+              ORDER BY created_at DESC, id DESC LIMIT $2`
+
+	rows, err := p.db.QueryContext(ctx, query, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, *d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (p *PostgresWebhookRepo) ListAttempts(ctx context.Context, deliveryID int) ([]models.WebhookAttempt, error) {
+	query := `SELECT id, delivery_id, attempt, COALESCE(status_code, 0), COALESCE(error, ''), duration_ms, created_at
+              FROM webhook_delivery_attempts WHERE delivery_id = $1
+              ORDER BY attempt`
+
+	rows, err := p.db.QueryContext(ctx, query, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []models.WebhookAttempt
+	for rows.Next() {
+		var a models.WebhookAttempt
+		if err := rows.Scan(&a.ID, &a.DeliveryID, &a.Attempt, &a.StatusCode, &a.Error, &a.DurationMS, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook attempt: %w", err)
+		}
+		attempts = append(attempts, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+// Replay возвращает доставку в очередь на немедленную отправку, независимо от ее статуса
+func (p *PostgresWebhookRepo) Replay(ctx context.Context, ID int) error {
+	query := `UPDATE webhook_deliveries SET status = $1, next_attempt_at = $2 WHERE id = $3`
+
+	result, err := p.db.ExecContext(ctx, query, models.DeliveryStatusPending, time.Now(), ID)
+	if err != nil {
+		return fmt.Errorf("failed to replay webhook delivery: %w", err)
+	}
+
+	rowsAffect, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rowsAffect == 0 {
+		return fmt.Errorf("webhook delivery with id %d not found", ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package safety
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// ErrUnsafeURL возвращается, когда адрес назначения признан небезопасным.
+// Остальные ошибки проверки (например, сбой DNS) считаются временными.
+var ErrUnsafeURL = errors.New("unsafe destination URL")
+
+// Checker проверяет безопасность адреса назначения перед созданием или обновлением ссылки
+type Checker interface {
+	Check(ctx context.Context, u *url.URL) error
+}
+
+// CheckerFunc позволяет использовать обычную функцию как Checker
+type CheckerFunc func(ctx context.Context, u *url.URL) error
+
+func (f CheckerFunc) Check(ctx context.Context, u *url.URL) error {
+	return f(ctx, u)
+}
+
+func unsafe(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrUnsafeURL, fmt.Sprintf(format, args...))
+}
+
+// Chain последовательно запускает проверки и останавливается на первой ошибке.
+// Домены из списка доверенных (allowlist) пропускают все остальные проверки.
+type Chain struct {
+	allow    *DomainList
+	checkers []Checker
+}
+
+func NewChain(allow *DomainList, checkers ...Checker) *Chain {
+	return &Chain{allow: allow, checkers: checkers}
+}
+
+func (c *Chain) Check(ctx context.Context, u *url.URL) error {
+	if c.allow != nil && c.allow.Match(u.Hostname()) {
+		return nil
+	}
+
+	for _, checker := range c.checkers {
+		if err := checker.Check(ctx, u); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckString разбирает адрес и проверяет его
+func CheckString(ctx context.Context, checker Checker, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.New("invalid URL format")
+	}
+	return checker.Check(ctx, u)
+}
@@ -0,0 +1,73 @@
+package safety
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	var calls int
+	counting := CheckerFunc(func(ctx context.Context, u *url.URL) error {
+		calls++
+		return nil
+	})
+
+	chain := NewChain(
+		NewDomainList("trusted.example"),
+		NewDenylistChecker(NewDomainList("evil.example")),
+		NewPrivateNetworkChecker(staticResolver{
+			"example.com":          {"93.184.216.34"},
+			"app.trusted.example":  {"10.0.0.1"},
+			"cdn.example.org":      {"93.184.216.35"},
+			"intranet.example.org": {"192.168.0.10"},
+		}),
+		counting,
+	)
+
+	tests := []struct {
+		name      string
+		url       string
+		unsafe    bool
+		wantCalls int
+	}{
+		{name: "public destination passes every check", url: "https://example.com/", wantCalls: 1},
+		{name: "allowlist skips the other checks", url: "http://app.trusted.example/", wantCalls: 0},
+		{name: "allowlisted domain itself", url: "http://trusted.example/", wantCalls: 0},
+		{name: "denylisted domain", url: "https://evil.example/", unsafe: true},
+		{name: "denylist covers subdomains", url: "https://login.EVIL.example./", unsafe: true},
+		{name: "private address literal", url: "http://192.168.0.1/", unsafe: true},
+		{name: "hostname resolving to private network", url: "https://intranet.example.org/", unsafe: true},
+		{name: "unrelated domain of the same zone", url: "https://cdn.example.org/", wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+			err := chain.Check(context.Background(), mustParse(t, tt.url))
+			if tt.unsafe {
+				if !errors.Is(err, ErrUnsafeURL) {
+					t.Fatalf("err = %v, want ErrUnsafeURL", err)
+				}
+				if calls != 0 {
+					t.Errorf("chain kept checking after the first failure")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("last checker ran %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCheckStringRejectsMalformedURL(t *testing.T) {
+	err := CheckString(context.Background(), NewChain(nil), "http://[::1")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
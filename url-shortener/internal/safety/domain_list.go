@@ -0,0 +1,95 @@
+package safety
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// DomainList - набор доменов; домен совпадает вместе со всеми своими поддоменами
+type DomainList struct {
+	domains map[string]struct{}
+}
+
+func NewDomainList(domains ...string) *DomainList {
+	l := &DomainList{domains: make(map[string]struct{}, len(domains))}
+	for _, d := range domains {
+		l.Add(d)
+	}
+	return l
+}
+
+// LoadDomainList читает домены из файла: по одному на строку, строки с # игнорируются.
+// Пустой путь дает пустой список.
+func LoadDomainList(path string) (*DomainList, error) {
+	l := NewDomainList()
+	if path == "" {
+		return l, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open domain list: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		l.Add(line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read domain list: %w", err)
+	}
+
+	return l, nil
+}
+
+func (l *DomainList) Add(domain string) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain != "" {
+		l.domains[domain] = struct{}{}
+	}
+}
+
+func (l *DomainList) Len() int {
+	return len(l.domains)
+}
+
+func (l *DomainList) Match(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for host != "" {
+		if _, ok := l.domains[host]; ok {
+			return true
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+	}
+	return false
+}
+
+// DenylistChecker отклоняет ссылки на домены из списка запрещенных
+type DenylistChecker struct {
+	deny *DomainList
+}
+
+func NewDenylistChecker(deny *DomainList) *DenylistChecker {
+	return &DenylistChecker{deny: deny}
+}
+
+func (c *DenylistChecker) Check(ctx context.Context, u *url.URL) error {
+	if c.deny.Match(u.Hostname()) {
+		return unsafe("domain %q is denylisted", u.Hostname())
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package safety
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// internalSuffixes - зоны, которые никогда не резолвятся во внешний интернет
+var internalSuffixes = []string{".localhost", ".local", ".internal", ".intranet", ".lan", ".home.arpa"}
+
+// Resolver абстрагирует DNS, чтобы проверку можно было использовать без сети
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// PrivateNetworkChecker запрещает ссылки на loopback, приватные, link-local и
+// прочие внутренние адреса, в том числе через имена хостов, которые в них резолвятся
+type PrivateNetworkChecker struct {
+	resolver Resolver
+}
+
+func NewPrivateNetworkChecker(resolver Resolver) *PrivateNetworkChecker {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &PrivateNetworkChecker{resolver: resolver}
+}
+
+func (c *PrivateNetworkChecker) Check(ctx context.Context, u *url.URL) error {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if isInternalAddr(addr) {
+			return unsafe("address %s is not publicly routable", addr)
+		}
+		return nil
+	}
+
+	if host == "localhost" || !strings.Contains(host, ".") {
+		return unsafe("internal hostname %q", host)
+	}
+	for _, suffix := range internalSuffixes {
+		if strings.HasSuffix(host, suffix) {
+			return unsafe("internal hostname %q", host)
+		}
+	}
+
+	addrs, err := c.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+
+	for _, addr := range addrs {
+		if isInternalAddr(addr) {
+			return unsafe("hostname %q resolves to non-public address %s", host, addr)
+		}
+	}
+
+	return nil
+}
+
+// DialControl запрещает исходящие соединения на непубличные адреса уже после
+// резолва DNS. Подходит для net.Dialer.Control у клиентов, которые ходят по адресам пользователей.
+func DialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	if isInternalAddr(addr) {
+		return unsafe("connection to non-public address %s", addr)
+	}
+
+	return nil
+}
+
+// nonPublicPrefixes - немаршрутизируемые в интернете диапазоны, которых нет среди проверок netip.Addr
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "Эта" сеть
+	netip.MustParsePrefix("100.64.0.0/10"),   // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // Служебные назначения IETF
+	netip.MustParsePrefix("192.0.2.0/24"),    // TEST-NET-1
+	netip.MustParsePrefix("198.18.0.0/15"),   // Тестирование производительности сетей
+	netip.MustParsePrefix("198.51.100.0/24"), // TEST-NET-2
+	netip.MustParsePrefix("203.0.113.0/24"),  // TEST-NET-3
+	netip.MustParsePrefix("240.0.0.0/4"),     // Зарезервировано, включая широковещательный адрес
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // Локальный NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // Документация
+}
+
+var (
+	// nat64Prefix - общеизвестный префикс NAT64: младшие 32 бита адреса - IPv4 получателя
+	nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+	// sixToFourPrefix - 6to4: биты 16-47 адреса - IPv4 шлюза
+	sixToFourPrefix = netip.MustParsePrefix("2002::/16")
+)
+
+func isInternalAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	// Адреса с встроенным IPv4 ведут туда же, куда и сам IPv4
+	if embedded, ok := embeddedIPv4(addr); ok {
+		return isInternalAddr(embedded)
+	}
+	return false
+}
+
+// embeddedIPv4 извлекает IPv4 из адресов NAT64 и 6to4
+func embeddedIPv4(addr netip.Addr) (netip.Addr, bool) {
+	b := addr.As16()
+	switch {
+	case nat64Prefix.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[12:16])), true
+	case sixToFourPrefix.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[2:6])), true
+	}
+	return netip.Addr{}, false
+}
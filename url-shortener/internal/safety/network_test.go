@@ -0,0 +1,136 @@
+package safety
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"net/url"
+	"testing"
+)
+
+func TestIsInternalAddr(t *testing.T) {
+	tests := []struct {
+		addr     string
+		internal bool
+	}{
+		{"8.8.8.8", false},
+		{"93.184.216.34", false},
+		{"2606:4700:4700::1111", false},
+		{"127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"0.0.0.0", true},
+		{"0.1.2.3", true},
+		{"100.64.0.1", true},
+		{"100.128.0.1", false},
+		{"192.0.0.8", true},
+		{"192.0.2.1", true},
+		{"198.18.0.1", true},
+		{"198.19.255.255", true},
+		{"198.20.0.1", false},
+		{"240.0.0.1", true},
+		{"255.255.255.255", true},
+		{"224.0.0.1", true},
+		{"::1", true},
+		{"::", true},
+		{"fc00::1", true},
+		{"fe80::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:8.8.8.8", false},
+		{"64:ff9b::a00:1", true},    // NAT64 -> 10.0.0.1
+		{"64:ff9b::808:808", false}, // NAT64 -> 8.8.8.8
+		{"64:ff9b:1::1", true},      // Локальный NAT64
+		{"2002:c0a8:101::1", true},  // 6to4 -> 192.168.1.1
+		{"2002:808:808::1", false},  // 6to4 -> 8.8.8.8
+		{"2001:db8::1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := isInternalAddr(netip.MustParseAddr(tt.addr)); got != tt.internal {
+				t.Errorf("isInternalAddr(%s) = %v, want %v", tt.addr, got, tt.internal)
+			}
+		})
+	}
+}
+
+// staticResolver резолвит имена по таблице
+type staticResolver map[string][]string
+
+func (r staticResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	raw, ok := r[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	addrs := make([]netip.Addr, 0, len(raw))
+	for _, a := range raw {
+		addrs = append(addrs, netip.MustParseAddr(a))
+	}
+	return addrs, nil
+}
+
+func TestPrivateNetworkChecker(t *testing.T) {
+	checker := NewPrivateNetworkChecker(staticResolver{
+		"example.com":      {"93.184.216.34"},
+		"internal.example": {"93.184.216.34", "10.0.0.5"},
+		"nat64.example":    {"64:ff9b::7f00:1"},
+	})
+
+	tests := []struct {
+		url       string
+		unsafe    bool
+		temporary bool
+	}{
+		{url: "https://example.com/page"},
+		{url: "https://8.8.8.8/"},
+		{url: "http://127.0.0.1:8080/admin", unsafe: true},
+		{url: "http://[::1]/", unsafe: true},
+		{url: "http://localhost/", unsafe: true},
+		{url: "http://intranet/", unsafe: true},
+		{url: "http://printer.local/", unsafe: true},
+		{url: "http://db.internal/", unsafe: true},
+		{url: "http://internal.example/", unsafe: true},
+		{url: "http://nat64.example/", unsafe: true},
+		{url: "http://missing.example/", temporary: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := CheckString(context.Background(), checker, tt.url)
+			switch {
+			case tt.unsafe:
+				if !errors.Is(err, ErrUnsafeURL) {
+					t.Errorf("err = %v, want ErrUnsafeURL", err)
+				}
+			case tt.temporary:
+				if err == nil || errors.Is(err, ErrUnsafeURL) {
+					t.Errorf("err = %v, want a temporary error", err)
+				}
+			default:
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestDialControl(t *testing.T) {
+	if err := DialControl("tcp", "10.0.0.1:443", nil); !errors.Is(err, ErrUnsafeURL) {
+		t.Errorf("DialControl(10.0.0.1) = %v, want ErrUnsafeURL", err)
+	}
+	if err := DialControl("tcp", "[2606:4700:4700::1111]:443", nil); err != nil {
+		t.Errorf("DialControl(public) = %v", err)
+	}
+}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
@@ -0,0 +1,37 @@
+package safety
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// ReputationProvider - внешний сервис репутации (Safe Browsing, PhishTank и т.п.)
+type ReputationProvider interface {
+	Name() string
+	// Lookup возвращает malicious=true и причину, если адрес известен как вредоносный
+	Lookup(ctx context.Context, u *url.URL) (malicious bool, reason string, err error)
+}
+
+// ReputationChecker опрашивает провайдеров по очереди. Ошибка провайдера не
+// считается признаком небезопасного адреса и возвращается как временная.
+type ReputationChecker struct {
+	providers []ReputationProvider
+}
+
+func NewReputationChecker(providers ...ReputationProvider) *ReputationChecker {
+	return &ReputationChecker{providers: providers}
+}
+
+func (c *ReputationChecker) Check(ctx context.Context, u *url.URL) error {
+	for _, p := range c.providers {
+		malicious, reason, err := p.Lookup(ctx, u)
+		if err != nil {
+			return fmt.Errorf("reputation provider %s failed: %w", p.Name(), err)
+		}
+		if malicious {
+			return unsafe("flagged by %s: %s", p.Name(), reason)
+		}
+	}
+	return nil
+}
@@ -2,6 +2,8 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"url-shortener/internal/models"
 	"url-shortener/internal/repository"
 )
@@ -18,7 +20,8 @@ func NewAnalyticsService(clickRepo repository.AnalyticsRepository, urlRepo repos
 	}
 }
 
-func (s *AnalyticsService) SaveClick(ctx context.Context, click *models.Click) error {
+// SaveClick сохраняет клик и возвращает новое число кликов ссылки
+func (s *AnalyticsService) SaveClick(ctx context.Context, click *models.Click) (int, error) {
 	return s.clickRepo.SaveClick(ctx, click)
 }
 
@@ -26,6 +29,20 @@ func (s *AnalyticsService) GetAnalyticsByID(ctx context.Context, urlID int) (*mo
 	return s.clickRepo.GetAnalyticsByID(ctx, urlID)
 }
 
-func (s *AnalyticsService) GetAnalyticsByShortCode(ctx context.Context, shortCode string) (*models.Analytics, error) {
-	return s.clickRepo.GetAnalyticsByShortCode(ctx, shortCode)
+// GetAnalyticsByShortCode возвращает аналитику ссылки владельца ownerID.
+// Для несуществующих и чужих ссылок возвращается nil без ошибки.
+func (s *AnalyticsService) GetAnalyticsByShortCode(ctx context.Context, ownerID, domain, shortCode string) (*models.Analytics, error) {
+	url, err := s.urlRepo.FindByShortCode(ctx, domain, shortCode)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if url.OwnerID != ownerID {
+		return nil, nil
+	}
+
+	return s.clickRepo.GetAnalyticsByID(ctx, url.ID)
 }
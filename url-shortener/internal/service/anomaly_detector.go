@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+)
+
+const (
+	anomalyDetectorActor = "system:anomaly"
+	alertsPageSize       = 100
+)
+
+// AnomalyConfig задает параметры поиска аномалий в потоке кликов
+type AnomalyConfig struct {
+	Interval        time.Duration // Как часто запускается проверка
+	Window          time.Duration // Длина окна, за которое считаются переходы
+	BaselineWindows int           // Сколько предыдущих окон образуют базовый уровень
+	ZThreshold      float64       // z-оценка, начиная с которой рост считается всплеском
+	MinClicks       int           // Минимум переходов в окне для оповещения о всплеске
+	MinBaseline     float64       // Минимальный средний уровень для оповещения о падении до нуля
+	AbuseThreshold  int           // Переходов в окне для автоматического отключения, 0 - не отключать
+}
+
+// AnomalyDetector сравнивает число переходов за последнее окно со скользящим средним
+// по предыдущим окнам и записывает всплески и падения в таблицу alerts
+type AnomalyDetector struct {
+	clickRepo repository.AnalyticsRepository
+	urlRepo   repository.URLRepository
+	alertRepo repository.AlertRepository
+	cacheRepo repository.CacheRepository
+	auditRepo repository.AuditRepository
+	tx        repository.Transactor
+	events    EventPublisher
+	cfg       AnomalyConfig
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewAnomalyDetector(clickRepo repository.AnalyticsRepository, urlRepo repository.URLRepository, alertRepo repository.AlertRepository, cacheRepo repository.CacheRepository, auditRepo repository.AuditRepository, tx repository.Transactor, events EventPublisher, cfg AnomalyConfig) *AnomalyDetector {
+	if cfg.BaselineWindows < 2 {
+		cfg.BaselineWindows = 2
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &AnomalyDetector{
+		clickRepo: clickRepo,
+		urlRepo:   urlRepo,
+		alertRepo: alertRepo,
+		cacheRepo: cacheRepo,
+		auditRepo: auditRepo,
+		tx:        tx,
+		events:    events,
+		cfg:       cfg,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+}
+
+func (d *AnomalyDetector) Start() {
+	go d.run()
+}
+
+func (d *AnomalyDetector) run() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			raised, err := d.Detect(d.ctx, time.Now())
+			if err != nil && !errors.Is(err, context.Canceled) {
+				slog.ErrorContext(d.ctx, "anomaly detection failed", "error", err)
+				continue
+			}
+			if raised > 0 {
+				slog.InfoContext(d.ctx, "anomaly detection raised alerts", "alerts", raised)
+			}
+		}
+	}
+}
+
+// baselineStats возвращает среднее и стандартное отклонение числа переходов по окнам истории
+func baselineStats(history []int) (mean, stddev float64) {
+	if len(history) == 0 {
+		return 0, 0
+	}
+
+	for _, c := range history {
+		mean += float64(c)
+	}
+	mean /= float64(len(history))
+
+	for _, c := range history {
+		diff := float64(c) - mean
+		stddev += diff * diff
+	}
+	stddev = math.Sqrt(stddev / float64(len(history)))
+
+	return mean, stddev
+}
+
+// zScore считает отклонение от базового уровня. Знаменатель ограничен снизу корнем из
+// среднего (как для пуассоновского потока) и единицей, чтобы ровная история не давала
+// бесконечную оценку на первом же клике.
+func zScore(current int, mean, stddev float64) float64 {
+	spread := math.Max(stddev, math.Max(math.Sqrt(mean), 1))
+	return (float64(current) - mean) / spread
+}
+
+// classify определяет вид аномалии в последнем окне или возвращает пустую строку
+func (d *AnomalyDetector) classify(current int, mean, z float64) string {
+	switch {
+	case d.cfg.AbuseThreshold > 0 && current >= d.cfg.AbuseThreshold:
+		return models.AlertKindAbuse
+	case current >= d.cfg.MinClicks && z >= d.cfg.ZThreshold:
+		return models.AlertKindSpike
+	case current == 0 && mean >= d.cfg.MinBaseline:
+		return models.AlertKindDrop
+	default:
+		return ""
+	}
+}
+
+// Detect проверяет все ссылки с переходами за период и возвращает число новых оповещений
+func (d *AnomalyDetector) Detect(ctx context.Context, now time.Time) (int, error) {
+	counts, err := d.clickRepo.ClickCountsByWindow(ctx, now, d.cfg.Window, d.cfg.BaselineWindows)
+	if err != nil {
+		return 0, err
+	}
+
+	raised := 0
+	for urlID, windows := range counts {
+		current := windows[0]
+		mean, stddev := baselineStats(windows[1:])
+		z := zScore(current, mean, stddev)
+
+		kind := d.classify(current, mean, z)
+		if kind == "" {
+			continue
+		}
+
+		ok, err := d.raise(ctx, now, urlID, kind, current, mean, stddev, z)
+		if err != nil {
+			return raised, err
+		}
+		if ok {
+			raised++
+		}
+	}
+
+	return raised, nil
+}
+
+// raise записывает оповещение, если по этой ссылке такого же еще не было в текущем окне.
+// Окна выровнены по длине, поэтому экземпляры детектора, проверяющие одно окно, пишут
+// одно и то же оповещение, и записать его удается только одному из них.
+func (d *AnomalyDetector) raise(ctx context.Context, now time.Time, urlID int, kind string, clicks int, mean, stddev, z float64) (bool, error) {
+	url, err := d.urlRepo.GetByID(ctx, urlID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load URL %d: %w", urlID, err)
+	}
+	if url.IsDeleted() {
+		return false, nil
+	}
+
+	alert := &models.Alert{
+		URLID:          url.ID,
+		OwnerID:        url.OwnerID,
+		ShortCode:      url.ShortCode,
+		Domain:         url.Domain,
+		Kind:           kind,
+		Clicks:         clicks,
+		BaselineMean:   mean,
+		BaselineStdDev: stddev,
+		ZScore:         z,
+		AutoDisabled:   kind == models.AlertKindAbuse && !url.Disabled,
+		WindowStart:    now.Truncate(d.cfg.Window).UTC(),
+	}
+
+	// Оповещение и отключение фиксируются вместе: отключает ссылку тот, кто записал оповещение
+	created := false
+	err = d.tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		created, err = d.alertRepo.Create(ctx, alert)
+		if err != nil || !created || !alert.AutoDisabled {
+			return err
+		}
+		return d.disable(ctx, url, clicks)
+	})
+	if err != nil || !created {
+		return false, err
+	}
+
+	if alert.AutoDisabled {
+		if err := d.cacheRepo.DeleteURL(ctx, url.Domain, url.ShortCode); err != nil {
+			slog.WarnContext(ctx, "failed to invalidate cached URL", "short_code", url.ShortCode, "error", err)
+		}
+	}
+
+	slog.WarnContext(ctx, "click anomaly", "kind", kind, "short_code", url.ShortCode, "clicks", clicks, "mean", mean, "z", z)
+	return true, nil
+}
+
+// disable отключает ссылку, превысившую порог злоупотребления, записывает отключение
+// в журнал аудита и публикует событие link.disabled. Вызывается в транзакции оповещения.
+func (d *AnomalyDetector) disable(ctx context.Context, url *models.URL, clicks int) error {
+	reason := fmt.Sprintf("automatically disabled: %d clicks in %s exceeds abuse threshold", clicks, d.cfg.Window)
+	changes := map[string]interface{}{"reason": reason}
+
+	if err := d.urlRepo.SetDisabled(ctx, url.ID, true, reason); err != nil {
+		return err
+	}
+
+	entry := &models.AuditEntry{
+		URLID:   url.ID,
+		Actor:   anomalyDetectorActor,
+		Action:  models.AuditActionDisable,
+		Changes: changes,
+	}
+	if err := d.auditRepo.Record(ctx, entry); err != nil {
+		return fmt.Errorf("failed to record audit entry for URL ID %d: %w", url.ID, err)
+	}
+
+	if d.events != nil {
+		return d.events.Publish(ctx, url.OwnerID, models.EventLinkDisabled, map[string]interface{}{
+			"domain":       url.Domain,
+			"short_code":   url.ShortCode,
+			"original_url": url.OriginalURL,
+			"owner_id":     url.OwnerID,
+			"changes":      changes,
+		})
+	}
+	return nil
+}
+
+// ListAlerts возвращает последние оповещения по ссылкам владельца
+func (d *AnomalyDetector) ListAlerts(ctx context.Context, ownerID string) ([]models.Alert, error) {
+	return d.alertRepo.ListByOwner(ctx, ownerID, alertsPageSize)
+}
+
+func (d *AnomalyDetector) Shutdown() {
+	d.cancel()
+	<-d.done
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+)
+
+func TestBaselineStats(t *testing.T) {
+	tests := []struct {
+		name       string
+		history    []int
+		wantMean   float64
+		wantStdDev float64
+	}{
+		{name: "empty", history: nil},
+		{name: "flat", history: []int{10, 10, 10, 10}, wantMean: 10},
+		{name: "varying", history: []int{2, 4, 4, 4, 5, 5, 7, 9}, wantMean: 5, wantStdDev: 2},
+		{name: "single", history: []int{3}, wantMean: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mean, stddev := baselineStats(tt.history)
+			if math.Abs(mean-tt.wantMean) > 1e-9 || math.Abs(stddev-tt.wantStdDev) > 1e-9 {
+				t.Errorf("baselineStats() = (%v, %v), want (%v, %v)", mean, stddev, tt.wantMean, tt.wantStdDev)
+			}
+		})
+	}
+}
+
+func TestZScore(t *testing.T) {
+	tests := []struct {
+		name    string
+		current int
+		mean    float64
+		stddev  float64
+		want    float64
+	}{
+		{name: "stddev dominates", current: 20, mean: 4, stddev: 4, want: 4},
+		{name: "poisson floor on flat history", current: 30, mean: 25, stddev: 0, want: 1},
+		{name: "unit floor on empty history", current: 5, mean: 0, stddev: 0, want: 5},
+		{name: "drop is negative", current: 0, mean: 16, stddev: 2, want: -4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := zScore(tt.current, tt.mean, tt.stddev); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("zScore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnomalyClassify(t *testing.T) {
+	d := &AnomalyDetector{cfg: AnomalyConfig{ZThreshold: 3, MinClicks: 10, MinBaseline: 5, AbuseThreshold: 1000}}
+
+	tests := []struct {
+		name    string
+		current int
+		mean    float64
+		z       float64
+		want    string
+	}{
+		{name: "abuse wins over spike", current: 1000, mean: 10, z: 300, want: models.AlertKindAbuse},
+		{name: "spike", current: 50, mean: 10, z: 12, want: models.AlertKindSpike},
+		{name: "spike below min clicks", current: 9, mean: 0, z: 9},
+		{name: "growth below threshold", current: 15, mean: 10, z: 1.5},
+		{name: "drop to zero", current: 0, mean: 8, z: -2.8, want: models.AlertKindDrop},
+		{name: "quiet link going silent", current: 0, mean: 2, z: -2},
+		{name: "normal", current: 10, mean: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := d.classify(tt.current, tt.mean, tt.z); got != tt.want {
+				t.Errorf("classify() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	d.cfg.AbuseThreshold = 0
+	if got := d.classify(5000, 10, 100); got != models.AlertKindSpike {
+		t.Errorf("without abuse threshold classify() = %q, want spike", got)
+	}
+}
+
+// fixedClickCounts отдает заранее заданные числа переходов по окнам
+type fixedClickCounts struct {
+	repository.AnalyticsRepository
+	counts map[int][]int
+}
+
+func (r fixedClickCounts) ClickCountsByWindow(ctx context.Context, now time.Time, window time.Duration, windows int) (map[int][]int, error) {
+	return r.counts, nil
+}
+
+// disableURLRepo хранит одну ссылку и считает отключения
+type disableURLRepo struct {
+	repository.URLRepository
+	mu       sync.Mutex
+	url      models.URL
+	disabled int
+}
+
+func (r *disableURLRepo) GetByID(ctx context.Context, id int) (*models.URL, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	url := r.url
+	return &url, nil
+}
+
+func (r *disableURLRepo) SetDisabled(ctx context.Context, id int, disabled bool, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.url.Disabled = disabled
+	r.disabled++
+	return nil
+}
+
+// memoryAlertRepo повторяет уникальный ключ (url_id, kind, window_start) таблицы alerts
+type memoryAlertRepo struct {
+	mu     sync.Mutex
+	alerts map[string]models.Alert
+}
+
+func (r *memoryAlertRepo) Create(ctx context.Context, alert *models.Alert) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := fmt.Sprintf("%d/%s/%d", alert.URLID, alert.Kind, alert.WindowStart.UnixNano())
+	if _, ok := r.alerts[key]; ok {
+		return false, nil
+	}
+	r.alerts[key] = *alert
+	return true, nil
+}
+
+func (r *memoryAlertRepo) ListByOwner(ctx context.Context, ownerID string, limit int) ([]models.Alert, error) {
+	return nil, nil
+}
+
+// countingAudit считает записи журнала аудита
+type countingAudit struct {
+	repository.AuditRepository
+	mu      sync.Mutex
+	entries int
+}
+
+func (r *countingAudit) Record(ctx context.Context, entry *models.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries++
+	return nil
+}
+
+// serialTx выполняет транзакции по очереди
+type serialTx struct {
+	mu sync.Mutex
+}
+
+func (t *serialTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return fn(ctx)
+}
+
+// nopURLCache принимает инвалидацию ссылок
+type nopURLCache struct {
+	repository.CacheRepository
+}
+
+func (nopURLCache) DeleteURL(ctx context.Context, domain, shortCode string) error {
+	return nil
+}
+
+func TestAnomalyDetectorRaisesAbuseOnceAcrossInstances(t *testing.T) {
+	clicks := fixedClickCounts{counts: map[int][]int{1: {5000, 10, 12, 8}}}
+	urls := &disableURLRepo{url: models.URL{ID: 1, ShortCode: "abc123", OwnerID: "owner"}}
+	alerts := &memoryAlertRepo{alerts: make(map[string]models.Alert)}
+	audit := &countingAudit{}
+	tx := &serialTx{}
+	cfg := AnomalyConfig{
+		Window:          10 * time.Minute,
+		BaselineWindows: 3,
+		ZThreshold:      3,
+		MinClicks:       10,
+		MinBaseline:     5,
+		AbuseThreshold:  1000,
+	}
+
+	// Экземпляры запускаются в разное время, но внутри одного окна
+	windowStart := time.Date(2025, 11, 20, 12, 0, 0, 0, time.UTC)
+	var wg sync.WaitGroup
+	raised := make([]int, 4)
+	for i := range raised {
+		d := NewAnomalyDetector(clicks, urls, alerts, nopURLCache{}, audit, tx, nil, cfg)
+		now := windowStart.Add(time.Duration(i+1) * time.Minute)
+		wg.Go(func() {
+			n, err := d.Detect(context.Background(), now)
+			if err != nil {
+				t.Errorf("Detect: %v", err)
+			}
+			raised[i] = n
+		})
+	}
+	wg.Wait()
+
+	total := 0
+	for _, n := range raised {
+		total += n
+	}
+	if total != 1 || len(alerts.alerts) != 1 {
+		t.Fatalf("raised %d alerts, stored %d, want 1", total, len(alerts.alerts))
+	}
+	for _, alert := range alerts.alerts {
+		if alert.Kind != models.AlertKindAbuse || !alert.AutoDisabled || !alert.WindowStart.Equal(windowStart) {
+			t.Errorf("alert = %+v", alert)
+		}
+	}
+	if urls.disabled != 1 || audit.entries != 1 {
+		t.Errorf("link disabled %d times with %d audit entries, want 1 and 1", urls.disabled, audit.entries)
+	}
+
+	// В следующем окне оповещение поднимается снова, но уже отключенная ссылка не отключается повторно
+	d := NewAnomalyDetector(clicks, urls, alerts, nopURLCache{}, audit, tx, nil, cfg)
+	if n, err := d.Detect(context.Background(), windowStart.Add(cfg.Window)); err != nil || n != 1 {
+		t.Fatalf("Detect in next window = %d, %v", n, err)
+	}
+	if urls.disabled != 1 || audit.entries != 1 {
+		t.Errorf("link disabled %d times with %d audit entries after next window", urls.disabled, audit.entries)
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// trackingParams - параметры, которые не влияют на содержимое страницы и
+// удаляются из канонической формы, если включен StripTracking
+var trackingParams = map[string]struct{}{
+	"fbclid":  {},
+	"gclid":   {},
+	"dclid":   {},
+	"msclkid": {},
+	"yclid":   {},
+	"igshid":  {},
+	"mc_cid":  {},
+	"mc_eid":  {},
+	"_ga":     {},
+	"_gl":     {},
+	"ref_src": {},
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Canonicalizer приводит URL к канонической форме для дедупликации
+type Canonicalizer struct {
+	StripTracking bool
+}
+
+// Canonicalize возвращает каноническую форму адреса: схема и хост в нижнем регистре,
+// IDN в punycode, без порта по умолчанию, с отсортированными параметрами запроса
+func (c Canonicalizer) Canonicalize(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", errors.New("invalid URL format")
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	host, err := canonicalHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host = host + ":" + port
+	}
+	u.Host = host
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	query := u.Query()
+	if c.StripTracking {
+		for key := range query {
+			if isTrackingParam(key) {
+				query.Del(key)
+			}
+		}
+	}
+	// Encode сортирует параметры по ключу
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+func canonicalHost(host string) (string, error) {
+	host = strings.TrimSuffix(host, ".")
+	if net.ParseIP(host) != nil {
+		return strings.ToLower(host), nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", errors.New("invalid hostname")
+	}
+
+	return strings.ToLower(ascii), nil
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	if strings.HasPrefix(key, "utm_") {
+		return true
+	}
+	_, ok := trackingParams[key]
+	return ok
+}
+
+// CanonicalHash возвращает hex SHA-256 канонической формы, по которому ищутся дубликаты
+func CanonicalHash(canonicalURL string) string {
+	sum := sha256.Sum256([]byte(canonicalURL))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+	"url-shortener/internal/bloom"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/repository"
+)
+
+const (
+	codeFilterBatchSize   = 10000
+	codeFilterMinCapacity = 1 << 16
+	// codeFilterSyncOverlap - сколько последних id перечитывается при каждой синхронизации.
+	// id выдаются до фиксации транзакции, и ссылка с меньшим id может появиться позже соседней.
+	codeFilterSyncOverlap = 1000
+)
+
+// CodeBroadcast рассылает выданные коды остальным экземплярам, чтобы новая ссылка
+// открывалась на них сразу, а не после следующей синхронизации
+type CodeBroadcast interface {
+	PublishCode(ctx context.Context, domain, shortCode string) error
+	// Available сообщает, доходят ли сейчас коды до подписчиков
+	Available() bool
+	// SubscribeCodes вызывает fn для каждого кода, выданного любым экземпляром, пока не отменен ctx
+	SubscribeCodes(ctx context.Context, fn func(domain, shortCode string))
+}
+
+// CodeFilterConfig задает точность фильтра и частоту синхронизации с базой
+type CodeFilterConfig struct {
+	FalsePositiveRate float64
+	SyncInterval      time.Duration // Как часто подгружаются коды, выданные другими экземплярами
+	RebuildInterval   time.Duration // Как часто фильтр строится заново по всей таблице
+}
+
+// CodeFilter - фильтр Блума по всем выданным коротким кодам. Запросы к кодам, которых
+// точно нет, отклоняются без обращения к Redis и Postgres. Коды не удаляются из фильтра:
+// удаленная ссылка продолжает отвечать страницей "ссылка удалена".
+//
+// Коды других экземпляров приходят через рассылку. Пока она не работает, сообщения теряются,
+// и фильтр ничего не отклоняет до первой синхронизации с базой после ее восстановления.
+type CodeFilter struct {
+	urlRepo   repository.URLRepository
+	broadcast CodeBroadcast
+	cfg       CodeFilterConfig
+
+	filter   atomic.Pointer[bloom.Filter]
+	capacity atomic.Int64
+
+	// trusted выставляется синхронизацией, во время которой рассылка работала, и снимается,
+	// как только рассылка перестает работать. lost считает замеченные сбои рассылки.
+	trusted    atomic.Bool
+	lost       atomic.Int64
+	subscribed atomic.Bool
+
+	mu     sync.Mutex // Сериализует загрузку и синхронизацию
+	lastID int
+	count  int
+
+	// Коды, добавленные во время загрузки, переносятся в новый фильтр перед заменой
+	addMu   sync.Mutex
+	loading bool
+	pending []string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewCodeFilter создает фильтр. broadcast может быть nil: тогда коды других экземпляров
+// появляются в фильтре только после синхронизации.
+func NewCodeFilter(urlRepo repository.URLRepository, broadcast CodeBroadcast, cfg CodeFilterConfig) *CodeFilter {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &CodeFilter{
+		urlRepo:   urlRepo,
+		broadcast: broadcast,
+		cfg:       cfg,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+}
+
+func codeFilterKey(domain, shortCode string) string {
+	return domain + "/" + shortCode
+}
+
+// MayContain возвращает false, только если код точно не выдавался. До первой загрузки
+// и пока фильтр может не знать о кодах других экземпляров, он ничего не отклоняет.
+func (f *CodeFilter) MayContain(domain, shortCode string) bool {
+	filter := f.filter.Load()
+	if filter == nil || !f.broadcastWorks() || !f.trusted.Load() {
+		return true
+	}
+	if filter.MayContain(codeFilterKey(domain, shortCode)) {
+		return true
+	}
+	metrics.CodeFilterRejected.Inc()
+	return false
+}
+
+// Add добавляет только что выданный код, не дожидаясь синхронизации, и рассылает его
+// остальным экземплярам
+func (f *CodeFilter) Add(ctx context.Context, domain, shortCode string) {
+	f.add(domain, shortCode)
+	if f.broadcast == nil {
+		return
+	}
+	if err := f.broadcast.PublishCode(ctx, domain, shortCode); err != nil {
+		slog.WarnContext(ctx, "failed to publish short code", "domain", domain, "short_code", shortCode, "error", err)
+	}
+}
+
+// broadcastWorks сообщает, что коды других экземпляров сейчас доходят до фильтра. Без рассылки
+// коды появляются только при синхронизации, и фильтр полагается на нее.
+func (f *CodeFilter) broadcastWorks() bool {
+	if f.broadcast == nil {
+		return true
+	}
+	if f.subscribed.Load() && f.broadcast.Available() {
+		return true
+	}
+	f.lost.Add(1)
+	if f.trusted.Swap(false) {
+		slog.Warn("short code broadcast is unavailable, code filter is bypassed until the next sync")
+	}
+	return false
+}
+
+// trustAfterSync включает отклонение запросов, если рассылка работала на протяжении всей
+// синхронизации: коды, выданные до нее, прочитаны из базы, а после - пришли через рассылку
+func (f *CodeFilter) trustAfterSync(lost int64, worked bool) {
+	if worked && f.broadcastWorks() && f.lost.Load() == lost {
+		f.trusted.Store(true)
+	}
+}
+
+func (f *CodeFilter) add(domain, shortCode string) {
+	key := codeFilterKey(domain, shortCode)
+
+	f.addMu.Lock()
+	defer f.addMu.Unlock()
+
+	if filter := f.filter.Load(); filter != nil {
+		filter.Add(key)
+	}
+	if f.loading {
+		f.pending = append(f.pending, key)
+	}
+}
+
+// Load строит фильтр заново по всей таблице ссылок. Пока строится новый фильтр,
+// запросы проверяются по старому.
+func (f *CodeFilter) Load(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	lost, worked := f.lost.Load(), f.broadcastWorks()
+
+	f.addMu.Lock()
+	f.loading = true
+	f.addMu.Unlock()
+	defer func() {
+		f.addMu.Lock()
+		f.loading, f.pending = false, nil
+		f.addMu.Unlock()
+	}()
+
+	capacity := max(codeFilterMinCapacity, 2*f.count)
+	for {
+		filter := bloom.New(capacity, f.cfg.FalsePositiveRate)
+		lastID, count, err := f.fill(ctx, filter, 0)
+		if err != nil {
+			return err
+		}
+
+		// Таблица выросла сильнее ожидаемого: фильтр перестроится с запасом
+		if count > capacity {
+			capacity = 2 * count
+			continue
+		}
+
+		// Код, выданный после чтения своей пачки, иначе пропал бы до следующей синхронизации
+		f.addMu.Lock()
+		for _, key := range f.pending {
+			filter.Add(key)
+		}
+		f.filter.Store(filter)
+		f.addMu.Unlock()
+		f.capacity.Store(int64(capacity))
+		f.lastID, f.count = lastID, count
+		f.trustAfterSync(lost, worked)
+		return nil
+	}
+}
+
+// fill добавляет в фильтр коды с id больше afterID и возвращает последний id и число кодов
+func (f *CodeFilter) fill(ctx context.Context, filter *bloom.Filter, afterID int) (int, int, error) {
+	lastID, count := afterID, 0
+	for {
+		refs, err := f.urlRepo.ListShortCodes(ctx, lastID, codeFilterBatchSize)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, ref := range refs {
+			filter.Add(codeFilterKey(ref.Domain, ref.ShortCode))
+			lastID = ref.ID
+		}
+		count += len(refs)
+
+		if len(refs) < codeFilterBatchSize {
+			return lastID, count, nil
+		}
+	}
+}
+
+// Sync подгружает коды, выданные после последней загрузки, в том числе другими экземплярами
+func (f *CodeFilter) Sync(ctx context.Context) error {
+	f.mu.Lock()
+
+	filter := f.filter.Load()
+	if filter == nil {
+		f.mu.Unlock()
+		return f.Load(ctx)
+	}
+
+	lost, worked := f.lost.Load(), f.broadcastWorks()
+	afterID := max(f.lastID-codeFilterSyncOverlap, 0)
+	lastID, _, err := f.fill(ctx, filter, afterID)
+	if err != nil {
+		f.mu.Unlock()
+		return err
+	}
+	if lastID > f.lastID {
+		f.count += lastID - f.lastID
+		f.lastID = lastID
+	}
+	overflow := int64(f.count) > f.capacity.Load()
+	f.mu.Unlock()
+
+	if overflow {
+		return f.Load(ctx)
+	}
+	f.trustAfterSync(lost, worked)
+	return nil
+}
+
+func (f *CodeFilter) Start() {
+	go f.run()
+}
+
+func (f *CodeFilter) run() {
+	defer close(f.done)
+
+	if f.broadcast != nil {
+		var wg sync.WaitGroup
+		f.subscribed.Store(true)
+		wg.Go(func() {
+			defer f.subscribed.Store(false)
+			f.broadcast.SubscribeCodes(f.ctx, f.add)
+		})
+		defer wg.Wait()
+	}
+
+	syncTicker := time.NewTicker(f.cfg.SyncInterval)
+	defer syncTicker.Stop()
+	rebuildTicker := time.NewTicker(f.cfg.RebuildInterval)
+	defer rebuildTicker.Stop()
+
+	for {
+		var err error
+		select {
+		case <-f.ctx.Done():
+			return
+		case <-syncTicker.C:
+			err = f.Sync(f.ctx)
+		case <-rebuildTicker.C:
+			err = f.Load(f.ctx)
+		}
+		if err != nil && !errors.Is(err, context.Canceled) {
+			slog.ErrorContext(f.ctx, "short code filter sync failed", "error", err)
+		}
+	}
+}
+
+func (f *CodeFilter) Shutdown() {
+	f.cancel()
+	<-f.done
+}
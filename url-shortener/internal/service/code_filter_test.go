@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+)
+
+// pausedCodeRepo отдает коды из refs, а первую пачку - только после закрытия release
+type pausedCodeRepo struct {
+	repository.URLRepository
+	refs    []models.ShortCodeRef
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (r *pausedCodeRepo) ListShortCodes(ctx context.Context, afterID, limit int) ([]models.ShortCodeRef, error) {
+	r.once.Do(func() {
+		close(r.started)
+		<-r.release
+	})
+	var refs []models.ShortCodeRef
+	for _, ref := range r.refs {
+		if ref.ID > afterID && len(refs) < limit {
+			refs = append(refs, ref)
+		}
+	}
+	return refs, nil
+}
+
+// chanBroadcast доставляет опубликованные коды подписчику через канал
+type chanBroadcast struct {
+	codes chan [2]string
+	down  atomic.Bool
+}
+
+func (b *chanBroadcast) Available() bool {
+	return !b.down.Load()
+}
+
+func (b *chanBroadcast) PublishCode(ctx context.Context, domain, shortCode string) error {
+	b.codes <- [2]string{domain, shortCode}
+	return nil
+}
+
+func (b *chanBroadcast) SubscribeCodes(ctx context.Context, fn func(domain, shortCode string)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case code := <-b.codes:
+			fn(code[0], code[1])
+		}
+	}
+}
+
+func TestCodeFilterLoadKeepsConcurrentAdds(t *testing.T) {
+	repo := &pausedCodeRepo{
+		refs:    []models.ShortCodeRef{{ID: 1, ShortCode: "old"}},
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	f := NewCodeFilter(repo, nil, CodeFilterConfig{FalsePositiveRate: 0.001})
+
+	errs := make(chan error, 1)
+	go func() { errs <- f.Load(context.Background()) }()
+
+	// Код выдан, когда загрузка уже прочитала таблицу без него
+	<-repo.started
+	f.Add(context.Background(), "", "fresh")
+	close(repo.release)
+	if err := <-errs; err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	for _, code := range []string{"old", "fresh"} {
+		if !f.MayContain("", code) {
+			t.Errorf("MayContain(%q) = false after Load", code)
+		}
+	}
+}
+
+func TestCodeFilterReceivesBroadcastCodes(t *testing.T) {
+	repo := &pausedCodeRepo{started: make(chan struct{}), release: make(chan struct{})}
+	close(repo.release)
+	broadcast := &chanBroadcast{codes: make(chan [2]string)}
+	f := NewCodeFilter(repo, broadcast, CodeFilterConfig{
+		FalsePositiveRate: 0.001,
+		SyncInterval:      time.Hour,
+		RebuildInterval:   time.Hour,
+	})
+	if err := f.Load(context.Background()); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	f.Start()
+	defer f.Shutdown()
+
+	// Код выдан другим экземпляром: до синхронизации с базой далеко
+	if err := broadcast.PublishCode(context.Background(), "go.example", "remote"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !f.MayContain("go.example", "remote") {
+		if time.Now().After(deadline) {
+			t.Fatal("broadcast code is not in the filter")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCodeFilterBypassedUntilSyncAfterBroadcastOutage(t *testing.T) {
+	repo := &pausedCodeRepo{started: make(chan struct{}), release: make(chan struct{})}
+	close(repo.release)
+	broadcast := &chanBroadcast{codes: make(chan [2]string)}
+	f := NewCodeFilter(repo, broadcast, CodeFilterConfig{
+		FalsePositiveRate: 0.001,
+		SyncInterval:      time.Hour,
+		RebuildInterval:   time.Hour,
+	})
+	ctx := context.Background()
+	if err := f.Load(ctx); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	// Коды, выданные до подписки, фильтр мог пропустить
+	if !f.MayContain("", "missing") {
+		t.Fatal("filter rejects codes before the subscription is running")
+	}
+
+	f.Start()
+	defer f.Shutdown()
+	waitFor(t, "filter to reject unknown codes after sync", func() bool {
+		if err := f.Sync(ctx); err != nil {
+			t.Fatalf("Sync: %v", err)
+		}
+		return !f.MayContain("", "missing")
+	})
+
+	// Пока Redis недоступен, коды других экземпляров теряются
+	broadcast.down.Store(true)
+	if !f.MayContain("", "missing") {
+		t.Error("filter rejects codes while the broadcast is down")
+	}
+	if err := f.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if !f.MayContain("", "missing") {
+		t.Error("filter trusted after a sync without the broadcast")
+	}
+
+	// После восстановления фильтр ждет синхронизации, которая подберет потерянные коды
+	broadcast.down.Store(false)
+	if !f.MayContain("", "missing") {
+		t.Error("filter rejects codes before the sync that follows the outage")
+	}
+	if err := f.Sync(ctx); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if f.MayContain("", "missing") {
+		t.Error("filter does not reject unknown codes after recovery")
+	}
+}
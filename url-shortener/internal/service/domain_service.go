@@ -0,0 +1,482 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	domainMaxPerOwner = 20
+	// domainVerificationPrefix - поддомен, в TXT записи которого владелец публикует токен
+	domainVerificationPrefix = "_url-shortener-verification."
+)
+
+// templateNamePattern - допустимые имена шаблонов, чтобы имя нельзя было использовать как путь
+var templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+var (
+	ErrDomainTaken       = errors.New("domain is already registered")
+	ErrDomainNotOwned    = errors.New("domain is not registered to this owner")
+	ErrDomainInUse       = errors.New("domain still has links")
+	ErrDomainNotVerified = errors.New("domain ownership is not verified")
+)
+
+// TXTResolver абстрагирует DNS, чтобы проверку владения можно было использовать без сети
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DomainBroadcast рассылает изменения доменов остальным экземплярам, чтобы подтвержденный
+// домен начал работать на них сразу, а удаленный - сразу перестал
+type DomainBroadcast interface {
+	PublishDomain(ctx context.Context, hostname string) error
+	// SubscribeDomains вызывает fn для каждого измененного домена, пока не отменен ctx
+	SubscribeDomains(ctx context.Context, fn func(hostname string))
+}
+
+// DomainService управляет брендированными доменами коротких ссылок и определяет
+// домен ссылки по заголовку Host. Список доменов держится в памяти и периодически
+// перечитывается из базы, чтобы редирект не обращался к ней за каждым запросом.
+// Домен закрепляется за владельцем только после подтверждения записью TXT.
+type DomainService struct {
+	repo          repository.DomainRepository
+	broadcast     DomainBroadcast
+	txt           TXTResolver
+	defaultDomain string
+	scheme        string
+	interval      time.Duration
+
+	mu    sync.RWMutex
+	hosts map[string]models.Domain
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewDomainService создает сервис. defaultDomain - хост ссылок без собственного домена,
+// scheme - схема, с которой строятся короткие адреса. broadcast может быть nil: тогда
+// другие экземпляры узнают об изменениях при следующем перечитывании. txt равен nil
+// для системного DNS.
+func NewDomainService(repo repository.DomainRepository, broadcast DomainBroadcast, txt TXTResolver, defaultDomain, scheme string, interval time.Duration) *DomainService {
+	if txt == nil {
+		txt = net.DefaultResolver
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &DomainService{
+		repo:          repo,
+		broadcast:     broadcast,
+		txt:           txt,
+		defaultDomain: NormalizeHost(defaultDomain),
+		scheme:        scheme,
+		interval:      interval,
+		hosts:         make(map[string]models.Domain),
+		ctx:           ctx,
+		cancel:        cancel,
+		done:          make(chan struct{}),
+	}
+}
+
+// NormalizeHost приводит значение заголовка Host к виду, в котором домены хранятся в базе:
+// нижний регистр, без завершающей точки и без стандартных портов 80 и 443
+func NormalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname, port = host, ""
+	}
+	hostname = strings.TrimSuffix(hostname, ".")
+
+	if port == "" || port == "80" || port == "443" {
+		return hostname
+	}
+	return net.JoinHostPort(hostname, port)
+}
+
+// Resolve возвращает домен ссылки для заголовка Host. Для домена по умолчанию и
+// незарегистрированных хостов возвращается пустая строка.
+func (s *DomainService) Resolve(host string) string {
+	host = NormalizeHost(host)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.hosts[host]; ok {
+		return host
+	}
+	return ""
+}
+
+// Lookup возвращает настройки зарегистрированного домена из памяти.
+// Для домена по умолчанию второе значение равно false.
+func (s *DomainService) Lookup(domain string) (models.Domain, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d, ok := s.hosts[domain]
+	return d, ok
+}
+
+// ShortURL строит полный короткий адрес ссылки на ее домене
+func (s *DomainService) ShortURL(url *models.URL) string {
+	host := url.Domain
+	if host == "" {
+		host = s.defaultDomain
+	}
+	return s.scheme + "://" + host + "/" + url.ShortCode
+}
+
+// CheckOwned проверяет, что ownerID может создавать ссылки на домене.
+// Пустой домен означает домен по умолчанию и доступен всем.
+func (s *DomainService) CheckOwned(ctx context.Context, ownerID, hostname string) error {
+	if hostname == "" {
+		return nil
+	}
+
+	domain, err := s.repo.GetByHostname(ctx, hostname)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrDomainNotOwned
+		}
+		return err
+	}
+
+	if domain.OwnerID != ownerID {
+		return ErrDomainNotOwned
+	}
+
+	return nil
+}
+
+// VerificationRecord возвращает имя TXT записи, в которой публикуется токен заявки на домен
+func VerificationRecord(hostname string) string {
+	name, _, err := net.SplitHostPort(hostname)
+	if err != nil {
+		name = hostname
+	}
+	return domainVerificationPrefix + name
+}
+
+// Register создает заявку на домен. Домен начнет работать после того, как владелец
+// опубликует токен заявки в TXT записи VerificationRecord и вызовет Verify. Повторная
+// заявка того же владельца возвращает существующую.
+func (s *DomainService) Register(ctx context.Context, ownerID, hostname string) (*models.DomainClaim, error) {
+	if ownerID == "" {
+		return nil, errors.New("owner is required")
+	}
+
+	hostname, err := validateDomain(hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	if hostname == s.defaultDomain {
+		return nil, ErrDomainTaken
+	}
+
+	existing, err := s.repo.GetByHostname(ctx, hostname)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrDomainTaken
+	}
+
+	claim, err := s.repo.GetClaim(ctx, ownerID, hostname)
+	if err == nil {
+		return claim, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	owned, err := s.repo.ListByOwner(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.repo.ListClaimsByOwner(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if len(owned)+len(claims) >= domainMaxPerOwner {
+		return nil, fmt.Errorf("too many domains, maximum is %d", domainMaxPerOwner)
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("failed to generate verification token: %w", err)
+	}
+
+	claim = &models.DomainClaim{Hostname: hostname, OwnerID: ownerID, Token: hex.EncodeToString(token)}
+	if err := s.repo.CreateClaim(ctx, claim); err != nil {
+		return nil, err
+	}
+
+	return claim, nil
+}
+
+// Verify проверяет TXT запись заявки и закрепляет домен за владельцем. Если домен
+// успел подтвердить другой арендатор, возвращает ErrDomainTaken.
+func (s *DomainService) Verify(ctx context.Context, ownerID, hostname string) (*models.Domain, error) {
+	hostname = NormalizeHost(hostname)
+	claim, err := s.repo.GetClaim(ctx, ownerID, hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	record := VerificationRecord(hostname)
+	values, err := s.txt.LookupTXT(ctx, record)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return nil, fmt.Errorf("%w: TXT %s", ErrDomainNotVerified, record)
+		}
+		return nil, fmt.Errorf("failed to look up TXT %s: %w", record, err)
+	}
+	if !slices.Contains(values, claim.Token) {
+		return nil, fmt.Errorf("%w: TXT %s does not contain the token", ErrDomainNotVerified, record)
+	}
+
+	domain, err := s.repo.ConfirmClaim(ctx, claim)
+	if err != nil {
+		if errors.Is(err, repository.ErrDomainExists) {
+			return nil, ErrDomainTaken
+		}
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.hosts[hostname] = *domain
+	s.mu.Unlock()
+	s.publish(ctx, hostname)
+
+	return domain, nil
+}
+
+// List возвращает подтвержденные домены владельца и заявки, ждущие подтверждения
+func (s *DomainService) List(ctx context.Context, ownerID string) ([]models.Domain, []models.DomainClaim, error) {
+	domains, err := s.repo.ListByOwner(ctx, ownerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	claims, err := s.repo.ListClaimsByOwner(ctx, ownerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return domains, claims, nil
+}
+
+// Delete удаляет домен владельца. Домен, на котором остались ссылки (в том числе
+// удаленные), освободить нельзя, иначе их коды стали бы доступны другому арендатору.
+func (s *DomainService) Delete(ctx context.Context, ownerID, hostname string) error {
+	hostname = NormalizeHost(hostname)
+	if err := s.CheckOwned(ctx, ownerID, hostname); err != nil {
+		if errors.Is(err, ErrDomainNotOwned) {
+			// Неподтвержденный домен - это только заявка, ссылок на нем нет
+			return s.repo.DeleteClaim(ctx, ownerID, hostname)
+		}
+		return err
+	}
+
+	count, err := s.repo.CountURLs(ctx, hostname)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDomainInUse
+	}
+
+	if err := s.repo.Delete(ctx, hostname); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.hosts, hostname)
+	s.mu.Unlock()
+	s.publish(ctx, hostname)
+
+	return nil
+}
+
+// Fallback - настройки страницы, которую браузер видит вместо редиректа
+type Fallback struct {
+	Mode     string
+	URL      string
+	Template string
+}
+
+// SetFallback задает поведение домена для ненайденных, удаленных и отключенных ссылок
+func (s *DomainService) SetFallback(ctx context.Context, ownerID, hostname string, fallback Fallback) (*models.Domain, error) {
+	switch fallback.Mode {
+	case models.FallbackModePage:
+		fallback.URL, fallback.Template = "", ""
+	case models.FallbackModeRedirect:
+		if err := validateURL(fallback.URL); err != nil {
+			return nil, fmt.Errorf("invalid fallback url: %w", err)
+		}
+		fallback.Template = ""
+	case models.FallbackModeTemplate:
+		if !templateNamePattern.MatchString(fallback.Template) {
+			return nil, errors.New("template name may contain only letters, digits, '-' and '_'")
+		}
+		fallback.URL = ""
+	default:
+		return nil, fmt.Errorf("unknown fallback mode %q", fallback.Mode)
+	}
+
+	hostname = NormalizeHost(hostname)
+	domain, err := s.repo.GetByHostname(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+	if domain.OwnerID != ownerID {
+		return nil, sql.ErrNoRows
+	}
+
+	domain.FallbackMode = fallback.Mode
+	domain.FallbackURL = fallback.URL
+	domain.FallbackTemplate = fallback.Template
+	if err := s.repo.UpdateFallback(ctx, domain); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.hosts[hostname] = *domain
+	s.mu.Unlock()
+	s.publish(ctx, hostname)
+
+	return domain, nil
+}
+
+// publish сообщает остальным экземплярам, что домен нужно перечитать
+func (s *DomainService) publish(ctx context.Context, hostname string) {
+	if s.broadcast == nil {
+		return
+	}
+	if err := s.broadcast.PublishDomain(ctx, hostname); err != nil {
+		slog.WarnContext(ctx, "failed to publish domain change", "hostname", hostname, "error", err)
+	}
+}
+
+// reload перечитывает из базы домен, измененный другим экземпляром
+func (s *DomainService) reload(hostname string) {
+	domain, err := s.repo.GetByHostname(s.ctx, hostname)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		// Домен перечитается при следующем обновлении списка
+		slog.ErrorContext(s.ctx, "failed to reload domain", "hostname", hostname, "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if domain == nil {
+		delete(s.hosts, hostname)
+		return
+	}
+	s.hosts[hostname] = *domain
+}
+
+// Refresh перечитывает список доменов из базы
+func (s *DomainService) Refresh(ctx context.Context) error {
+	domains, err := s.repo.ListAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	hosts := make(map[string]models.Domain, len(domains))
+	for _, d := range domains {
+		hosts[d.Hostname] = d
+	}
+
+	s.mu.Lock()
+	s.hosts = hosts
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *DomainService) Start() {
+	go s.run()
+}
+
+func (s *DomainService) run() {
+	defer close(s.done)
+
+	if s.broadcast != nil {
+		var wg sync.WaitGroup
+		wg.Go(func() { s.broadcast.SubscribeDomains(s.ctx, s.reload) })
+		defer wg.Wait()
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(s.ctx); err != nil && !errors.Is(err, context.Canceled) {
+				slog.ErrorContext(s.ctx, "failed to refresh domains", "error", err)
+			}
+		}
+	}
+}
+
+func (s *DomainService) Shutdown() {
+	s.cancel()
+	<-s.done
+}
+
+// validateDomain проверяет имя хоста и возвращает его каноническую форму (punycode)
+func validateDomain(hostname string) (string, error) {
+	hostname = NormalizeHost(hostname)
+	if hostname == "" {
+		return "", errors.New("hostname is required")
+	}
+
+	if strings.ContainsAny(hostname, "/?#@ ") {
+		return "", errors.New("hostname must not contain scheme, path or credentials")
+	}
+
+	name, port, err := net.SplitHostPort(hostname)
+	if err != nil {
+		name, port = hostname, ""
+	}
+
+	if net.ParseIP(name) != nil {
+		return "", errors.New("hostname must be a domain name, not an IP address")
+	}
+
+	ascii, err := idna.Lookup.ToASCII(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid hostname: %w", err)
+	}
+	if !strings.Contains(ascii, ".") {
+		return "", errors.New("hostname must be a fully qualified domain name")
+	}
+	if len(ascii) > 253 {
+		return "", errors.New("hostname is too long")
+	}
+
+	if port != "" {
+		return net.JoinHostPort(ascii, port), nil
+	}
+	return ascii, nil
+}
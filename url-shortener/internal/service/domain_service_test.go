@@ -0,0 +1,383 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+)
+
+// memoryDomainRepo хранит домены и заявки в памяти, как общая база нескольких экземпляров
+type memoryDomainRepo struct {
+	mu      sync.Mutex
+	domains map[string]models.Domain
+	claims  map[[2]string]models.DomainClaim // Ключ - хост и владелец
+}
+
+func newMemoryDomainRepo() *memoryDomainRepo {
+	return &memoryDomainRepo{
+		domains: make(map[string]models.Domain),
+		claims:  make(map[[2]string]models.DomainClaim),
+	}
+}
+
+func (r *memoryDomainRepo) Create(ctx context.Context, domain *models.Domain) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.domains[domain.Hostname] = *domain
+	return nil
+}
+
+func (r *memoryDomainRepo) GetByHostname(ctx context.Context, hostname string) (*models.Domain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d, ok := r.domains[hostname]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &d, nil
+}
+
+func (r *memoryDomainRepo) ListByOwner(ctx context.Context, ownerID string) ([]models.Domain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var domains []models.Domain
+	for _, d := range r.domains {
+		if d.OwnerID == ownerID {
+			domains = append(domains, d)
+		}
+	}
+	return domains, nil
+}
+
+func (r *memoryDomainRepo) ListAll(ctx context.Context) ([]models.Domain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var domains []models.Domain
+	for _, d := range r.domains {
+		domains = append(domains, d)
+	}
+	return domains, nil
+}
+
+func (r *memoryDomainRepo) UpdateFallback(ctx context.Context, domain *models.Domain) error {
+	return r.Create(ctx, domain)
+}
+
+func (r *memoryDomainRepo) CountURLs(ctx context.Context, hostname string) (int, error) {
+	return 0, nil
+}
+
+func (r *memoryDomainRepo) Delete(ctx context.Context, hostname string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.domains, hostname)
+	return nil
+}
+
+func (r *memoryDomainRepo) CreateClaim(ctx context.Context, claim *models.DomainClaim) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.claims[[2]string{claim.Hostname, claim.OwnerID}] = *claim
+	return nil
+}
+
+func (r *memoryDomainRepo) GetClaim(ctx context.Context, ownerID, hostname string) (*models.DomainClaim, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.claims[[2]string{hostname, ownerID}]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &c, nil
+}
+
+func (r *memoryDomainRepo) ListClaimsByOwner(ctx context.Context, ownerID string) ([]models.DomainClaim, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var claims []models.DomainClaim
+	for _, c := range r.claims {
+		if c.OwnerID == ownerID {
+			claims = append(claims, c)
+		}
+	}
+	return claims, nil
+}
+
+func (r *memoryDomainRepo) DeleteClaim(ctx context.Context, ownerID, hostname string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := [2]string{hostname, ownerID}
+	if _, ok := r.claims[key]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.claims, key)
+	return nil
+}
+
+func (r *memoryDomainRepo) ConfirmClaim(ctx context.Context, claim *models.DomainClaim) (*models.Domain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.domains[claim.Hostname]; ok {
+		return nil, repository.ErrDomainExists
+	}
+	d := models.Domain{Hostname: claim.Hostname, OwnerID: claim.OwnerID, FallbackMode: models.FallbackModePage}
+	r.domains[claim.Hostname] = d
+	for key := range r.claims {
+		if key[0] == claim.Hostname {
+			delete(r.claims, key)
+		}
+	}
+	return &d, nil
+}
+
+// staticTXT отвечает TXT записями из таблицы
+type staticTXT map[string][]string
+
+func (r staticTXT) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	values, ok := r[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return values, nil
+}
+
+// memoryDomainBroadcast доставляет изменения доменов всем подписчикам, как канал Redis
+type memoryDomainBroadcast struct {
+	mu          sync.Mutex
+	subscribers []chan string
+}
+
+func (b *memoryDomainBroadcast) PublishDomain(ctx context.Context, hostname string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, ch := range b.subscribers {
+		ch <- hostname
+	}
+	return nil
+}
+
+func (b *memoryDomainBroadcast) SubscribeDomains(ctx context.Context, fn func(hostname string)) {
+	ch := make(chan string, 16)
+	b.mu.Lock()
+	b.subscribers = append(b.subscribers, ch)
+	b.mu.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case hostname := <-ch:
+			fn(hostname)
+		}
+	}
+}
+
+func TestValidateDomain(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "go.acme.com", want: "go.acme.com"},
+		{in: "  GO.Acme.COM.  ", want: "go.acme.com"},
+		{in: "go.acme.com:443", want: "go.acme.com"},
+		{in: "go.acme.com:8443", want: "go.acme.com:8443"},
+		{in: "пример.рф", want: "xn--e1afmkfd.xn--p1ai"},
+		{in: "", wantErr: true},
+		{in: "localhost", wantErr: true},
+		{in: "https://go.acme.com", wantErr: true},
+		{in: "go.acme.com/path", wantErr: true},
+		{in: "user@go.acme.com", wantErr: true},
+		{in: "10.0.0.1", wantErr: true},
+		{in: "[::1]:8080", wantErr: true},
+		{in: "bad_label!.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := validateDomain(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomainServiceResolve(t *testing.T) {
+	repo := newMemoryDomainRepo()
+	repo.domains["go.acme.com"] = models.Domain{Hostname: "go.acme.com", OwnerID: "acme"}
+	repo.domains["links.example.org:8443"] = models.Domain{Hostname: "links.example.org:8443", OwnerID: "example"}
+
+	s := NewDomainService(repo, nil, staticTXT{}, "sho.rt", "https", time.Minute)
+	if err := s.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{host: "go.acme.com", want: "go.acme.com"},
+		{host: "GO.ACME.COM.", want: "go.acme.com"},
+		{host: "go.acme.com:443", want: "go.acme.com"},
+		{host: "go.acme.com:80", want: "go.acme.com"},
+		{host: "links.example.org:8443", want: "links.example.org:8443"},
+		{host: "links.example.org", want: ""},
+		{host: "sho.rt", want: ""},
+		{host: "unknown.example", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if got := s.Resolve(tt.host); got != tt.want {
+				t.Errorf("Resolve(%q) = %q, want %q", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomainServiceShortURL(t *testing.T) {
+	s := NewDomainService(newMemoryDomainRepo(), nil, staticTXT{}, "Sho.rt", "https", time.Minute)
+
+	tests := []struct {
+		name string
+		url  models.URL
+		want string
+	}{
+		{name: "default domain", url: models.URL{ShortCode: "abc123"}, want: "https://sho.rt/abc123"},
+		{name: "branded domain", url: models.URL{Domain: "go.acme.com", ShortCode: "promo"}, want: "https://go.acme.com/promo"},
+		{name: "domain with port", url: models.URL{Domain: "links.example.org:8443", ShortCode: "x"}, want: "https://links.example.org:8443/x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.ShortURL(&tt.url); got != tt.want {
+				t.Errorf("ShortURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomainServiceRequiresVerification(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryDomainRepo()
+	txt := staticTXT{}
+	s := NewDomainService(repo, nil, txt, "sho.rt", "https", time.Minute)
+
+	// Первым заявку подает чужой арендатор
+	squatter, err := s.Register(ctx, "squatter", "go.acme.com")
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	claim, err := s.Register(ctx, "acme", "go.acme.com")
+	if err != nil {
+		t.Fatalf("Register by the real owner: %v", err)
+	}
+	if again, err := s.Register(ctx, "acme", "go.acme.com"); err != nil || again.Token != claim.Token {
+		t.Errorf("repeated Register = %v, %v, want the same claim", again, err)
+	}
+
+	if s.Resolve("go.acme.com") != "" {
+		t.Error("pending domain is resolved")
+	}
+	if err := s.CheckOwned(ctx, "acme", "go.acme.com"); !errors.Is(err, ErrDomainNotOwned) {
+		t.Errorf("CheckOwned on a pending domain = %v, want ErrDomainNotOwned", err)
+	}
+	if _, err := s.Verify(ctx, "acme", "go.acme.com"); !errors.Is(err, ErrDomainNotVerified) {
+		t.Errorf("Verify without a TXT record = %v, want ErrDomainNotVerified", err)
+	}
+
+	// Токен другого арендатора в записи не подтверждает заявку
+	txt[VerificationRecord("go.acme.com")] = []string{squatter.Token}
+	if _, err := s.Verify(ctx, "acme", "go.acme.com"); !errors.Is(err, ErrDomainNotVerified) {
+		t.Errorf("Verify with someone else's token = %v, want ErrDomainNotVerified", err)
+	}
+
+	txt[VerificationRecord("go.acme.com")] = []string{"v=spf1 -all", claim.Token}
+	domain, err := s.Verify(ctx, "acme", "go.acme.com")
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if domain.OwnerID != "acme" {
+		t.Errorf("domain owner = %q, want acme", domain.OwnerID)
+	}
+	if got := s.Resolve("go.acme.com"); got != "go.acme.com" {
+		t.Errorf("Resolve after Verify = %q", got)
+	}
+	if err := s.CheckOwned(ctx, "acme", "go.acme.com"); err != nil {
+		t.Errorf("CheckOwned after Verify = %v", err)
+	}
+
+	// Заявка чужого арендатора удалена вместе с подтверждением
+	if _, err := s.Verify(ctx, "squatter", "go.acme.com"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Verify of the squatter's claim = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := s.Register(ctx, "squatter", "go.acme.com"); !errors.Is(err, ErrDomainTaken) {
+		t.Errorf("Register of a verified domain = %v, want ErrDomainTaken", err)
+	}
+}
+
+func TestDomainServiceBroadcastsChanges(t *testing.T) {
+	ctx := context.Background()
+	repo := newMemoryDomainRepo()
+	broadcast := &memoryDomainBroadcast{}
+	txt := staticTXT{}
+
+	// Два экземпляра с общей базой; перечитывание списка не успеет сработать
+	a := NewDomainService(repo, broadcast, txt, "sho.rt", "https", time.Hour)
+	b := NewDomainService(repo, broadcast, txt, "sho.rt", "https", time.Hour)
+	a.Start()
+	defer a.Shutdown()
+	b.Start()
+	defer b.Shutdown()
+	waitFor(t, "subscriptions", func() bool {
+		broadcast.mu.Lock()
+		defer broadcast.mu.Unlock()
+		return len(broadcast.subscribers) == 2
+	})
+
+	claim, err := a.Register(ctx, "acme", "go.acme.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt[VerificationRecord("go.acme.com")] = []string{claim.Token}
+	if _, err := a.Verify(ctx, "acme", "go.acme.com"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "verified domain on the other instance", func() bool {
+		return b.Resolve("go.acme.com") == "go.acme.com"
+	})
+
+	if err := a.Delete(ctx, "acme", "go.acme.com"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "deleted domain on the other instance", func() bool {
+		return b.Resolve("go.acme.com") == ""
+	})
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
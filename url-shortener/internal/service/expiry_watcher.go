@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+)
+
+const expiryClaimBatchSize = 100
+
+// ExpiryWatcher находит ссылки, у которых наступило active_until, сбрасывает их кэш
+// и публикует событие link.expired. Отметка об обработке и событие фиксируются одной
+// транзакцией, поэтому каждая ссылка дает ровно одно событие.
+type ExpiryWatcher struct {
+	urlRepo   repository.URLRepository
+	cacheRepo repository.CacheRepository
+	tx        repository.Transactor
+	events    EventPublisher
+	interval  time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewExpiryWatcher(urlRepo repository.URLRepository, cacheRepo repository.CacheRepository, tx repository.Transactor, events EventPublisher, interval time.Duration) *ExpiryWatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ExpiryWatcher{
+		urlRepo:   urlRepo,
+		cacheRepo: cacheRepo,
+		tx:        tx,
+		events:    events,
+		interval:  interval,
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+}
+
+func (w *ExpiryWatcher) Start() {
+	go w.run()
+}
+
+func (w *ExpiryWatcher) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.ProcessExpired(w.ctx); err != nil && !errors.Is(err, context.Canceled) {
+				slog.ErrorContext(w.ctx, "expiry check failed", "error", err)
+			}
+		}
+	}
+}
+
+// ProcessExpired обрабатывает все ссылки, истекшие к текущему моменту
+func (w *ExpiryWatcher) ProcessExpired(ctx context.Context) error {
+	for {
+		var urls []models.URL
+		err := w.tx.WithinTx(ctx, func(ctx context.Context) error {
+			var err error
+			urls, err = w.urlRepo.ClaimExpired(ctx, time.Now(), expiryClaimBatchSize)
+			if err != nil {
+				return err
+			}
+
+			if w.events == nil {
+				return nil
+			}
+			for _, url := range urls {
+				err := w.events.Publish(ctx, url.OwnerID, models.EventLinkExpired, map[string]interface{}{
+					"domain":       url.Domain,
+					"short_code":   url.ShortCode,
+					"original_url": url.OriginalURL,
+					"owner_id":     url.OwnerID,
+					"active_until": url.ActiveUntil,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, url := range urls {
+			if err := w.cacheRepo.DeleteURL(ctx, url.Domain, url.ShortCode); err != nil {
+				slog.WarnContext(ctx, "failed to invalidate cached URL", "short_code", url.ShortCode, "error", err)
+			}
+		}
+
+		if len(urls) < expiryClaimBatchSize {
+			return nil
+		}
+	}
+}
+
+func (w *ExpiryWatcher) Shutdown() {
+	w.cancel()
+	<-w.done
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/safety"
+)
+
+const (
+	healthCheckBatchSize    = 100
+	healthCheckMaxRedirects = 10
+	healthCheckUserAgent    = "url-shortener-health-checker/1.0"
+	// healthCheckBodyLimit - сколько байт тела читать при GET, чтобы соединение можно было переиспользовать
+	healthCheckBodyLimit = 64 * 1024
+)
+
+// HealthCheckerConfig задает параметры фоновой проверки адресов назначения
+type HealthCheckerConfig struct {
+	Interval    time.Duration // Период полного прохода по всем ссылкам
+	Concurrency int           // Максимум одновременных запросов
+	HostDelay   time.Duration // Минимальная пауза между запросами к одному хосту
+	Timeout     time.Duration // Таймаут одного запроса
+}
+
+// HealthChecker периодически проверяет, что адреса назначения активных ссылок отвечают
+type HealthChecker struct {
+	urlRepo    repository.URLRepository
+	healthRepo repository.HealthRepository
+	client     *http.Client
+	cfg        HealthCheckerConfig
+
+	hostsMu sync.Mutex
+	hosts   map[string]*hostSlot
+	// requests ограничивает число одновременных запросов. Место занимается только после
+	// очереди к хосту, чтобы ожидание паузы медленного хоста не держало место других.
+	requests chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// hostSlot сериализует запросы к одному хосту и выдерживает паузу между ними
+type hostSlot struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// NewHealthChecker создает проверку. client может быть nil, тогда используется клиент,
+// который не ходит на внутренние адреса и останавливается после 10 редиректов.
+func NewHealthChecker(urlRepo repository.URLRepository, healthRepo repository.HealthRepository, client *http.Client, cfg HealthCheckerConfig) *HealthChecker {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if client == nil {
+		client = newHealthCheckClient(cfg.Timeout)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &HealthChecker{
+		urlRepo:    urlRepo,
+		healthRepo: healthRepo,
+		client:     client,
+		cfg:        cfg,
+		hosts:      make(map[string]*hostSlot),
+		requests:   make(chan struct{}, cfg.Concurrency),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+}
+
+func newHealthCheckClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: safety.DialControl,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= healthCheckMaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", healthCheckMaxRedirects)
+			}
+			return nil
+		},
+	}
+}
+
+func (c *HealthChecker) Start() {
+	go c.run()
+}
+
+func (c *HealthChecker) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			checked, broken, err := c.CheckAll(c.ctx)
+			if err != nil {
+				slog.ErrorContext(c.ctx, "health check failed", "error", err)
+				continue
+			}
+			slog.InfoContext(c.ctx, "health check finished", "checked", checked, "broken", broken)
+		}
+	}
+}
+
+// CheckAll проверяет все активные ссылки и возвращает число проверенных и неработающих
+func (c *HealthChecker) CheckAll(ctx context.Context) (int, int, error) {
+	var (
+		mu      sync.Mutex
+		checked int
+		broken  int
+		wg      sync.WaitGroup
+	)
+
+	// Паузы между запросами к хосту нужны только в пределах одного прохода
+	c.hostsMu.Lock()
+	c.hosts = make(map[string]*hostSlot)
+	c.hostsMu.Unlock()
+
+	// Проверки, ждущие очереди к хосту, не занимают места запросов, но их число тоже ограничено
+	pending := make(chan struct{}, max(healthCheckBatchSize, 4*c.cfg.Concurrency))
+	afterID := 0
+
+	for {
+		urls, err := c.urlRepo.ListActive(ctx, afterID, healthCheckBatchSize)
+		if err != nil {
+			wg.Wait()
+			return checked, broken, err
+		}
+		if len(urls) == 0 {
+			break
+		}
+
+		for _, u := range urls {
+			afterID = u.ID
+
+			select {
+			case pending <- struct{}{}:
+			case <-ctx.Done():
+				wg.Wait()
+				return checked, broken, ctx.Err()
+			}
+
+			wg.Add(1)
+			go func(u models.URL) {
+				defer wg.Done()
+				defer func() { <-pending }()
+
+				health := c.Check(ctx, u.ID, u.OriginalURL)
+				if err := c.healthRepo.Save(ctx, health); err != nil {
+					slog.ErrorContext(ctx, "failed to save health check result", "short_code", u.ShortCode, "error", err)
+					return
+				}
+
+				mu.Lock()
+				checked++
+				if !health.Healthy {
+					broken++
+				}
+				mu.Unlock()
+			}(u)
+		}
+	}
+
+	wg.Wait()
+	return checked, broken, nil
+}
+
+// Check выполняет одну проверку адреса: сначала HEAD, а если сервер его не
+// поддерживает или соединение оборвалось, то GET
+func (c *HealthChecker) Check(ctx context.Context, urlID int, target string) *models.URLHealth {
+	health := &models.URLHealth{
+		URLID:       urlID,
+		OriginalURL: target,
+	}
+
+	host := target
+	if parsed, err := url.Parse(target); err == nil {
+		host = strings.ToLower(parsed.Host)
+	}
+
+	release := c.acquireHost(ctx, host)
+	defer release()
+
+	select {
+	case c.requests <- struct{}{}:
+	case <-ctx.Done():
+		health.Error = ctx.Err().Error()
+		health.CheckedAt = time.Now()
+		return health
+	}
+	defer func() { <-c.requests }()
+
+	start := time.Now()
+	resp, err := c.do(ctx, http.MethodHead, target)
+	if err != nil || resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		start = time.Now()
+		resp, err = c.do(ctx, http.MethodGet, target)
+	}
+	health.LatencyMS = time.Since(start).Milliseconds()
+	health.CheckedAt = time.Now()
+
+	if err != nil {
+		health.Error = describeHealthError(err)
+		return health
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, healthCheckBodyLimit))
+
+	health.StatusCode = resp.StatusCode
+	health.FinalURL = resp.Request.URL.String()
+	health.Healthy = resp.StatusCode < http.StatusBadRequest
+
+	return health
+}
+
+func (c *HealthChecker) do(ctx context.Context, method, target string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", healthCheckUserAgent)
+
+	return c.client.Do(req)
+}
+
+// acquireHost ждет своей очереди к хосту с учетом HostDelay и возвращает функцию освобождения
+func (c *HealthChecker) acquireHost(ctx context.Context, host string) func() {
+	c.hostsMu.Lock()
+	slot, ok := c.hosts[host]
+	if !ok {
+		slot = &hostSlot{}
+		c.hosts[host] = slot
+	}
+	c.hostsMu.Unlock()
+
+	slot.mu.Lock()
+	if wait := time.Until(slot.last.Add(c.cfg.HostDelay)); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	return func() {
+		slot.last = time.Now()
+		slot.mu.Unlock()
+	}
+}
+
+// GetHealth возвращает результат последней проверки ссылки или nil, если проверки еще не было
+func (c *HealthChecker) GetHealth(ctx context.Context, urlID int) (*models.URLHealth, error) {
+	return c.healthRepo.GetByURLID(ctx, urlID)
+}
+
+// ListBroken возвращает неработающие ссылки владельца
+func (c *HealthChecker) ListBroken(ctx context.Context, ownerID string) ([]models.URLHealth, error) {
+	return c.healthRepo.ListBroken(ctx, ownerID)
+}
+
+func describeHealthError(err error) string {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if urlErr.Timeout() {
+			return "timeout"
+		}
+		return urlErr.Err.Error()
+	}
+	return err.Error()
+}
+
+func (c *HealthChecker) Shutdown() {
+	c.cancel()
+	<-c.done
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+)
+
+// listURLRepo отдает фиксированный набор ссылок в ListActive
+type listURLRepo struct {
+	repository.URLRepository
+	urls []models.URL
+}
+
+func (r *listURLRepo) ListActive(ctx context.Context, afterID, limit int) ([]models.URL, error) {
+	var page []models.URL
+	for _, u := range r.urls {
+		if u.ID > afterID && len(page) < limit {
+			page = append(page, u)
+		}
+	}
+	return page, nil
+}
+
+// memoryHealthRepo запоминает сохраненные результаты проверок
+type memoryHealthRepo struct {
+	repository.HealthRepository
+	mu    sync.Mutex
+	saved map[int]*models.URLHealth
+}
+
+func (r *memoryHealthRepo) Save(ctx context.Context, health *models.URLHealth) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.saved == nil {
+		r.saved = make(map[int]*models.URLHealth)
+	}
+	r.saved[health.URLID] = health
+	return nil
+}
+
+func newTestHealthChecker(client *http.Client, cfg HealthCheckerConfig) *HealthChecker {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = time.Second
+	}
+	return NewHealthChecker(nil, &memoryHealthRepo{}, client, cfg)
+}
+
+func TestHealthCheckerCheck(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/no-head", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Write([]byte("body"))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := srv.Client()
+	client.Timeout = 50 * time.Millisecond
+
+	tests := []struct {
+		name       string
+		path       string
+		healthy    bool
+		statusCode int
+		finalPath  string
+		err        string
+	}{
+		{name: "ok", path: "/ok", healthy: true, statusCode: http.StatusOK, finalPath: "/ok"},
+		{name: "not found", path: "/missing", healthy: false, statusCode: http.StatusNotFound, finalPath: "/missing"},
+		{name: "falls back to GET", path: "/no-head", healthy: true, statusCode: http.StatusOK, finalPath: "/no-head"},
+		{name: "follows redirects", path: "/moved", healthy: true, statusCode: http.StatusOK, finalPath: "/ok"},
+		{name: "timeout", path: "/slow", healthy: false, err: "timeout"},
+	}
+
+	checker := newTestHealthChecker(client, HealthCheckerConfig{Concurrency: 1})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := checker.Check(context.Background(), 1, srv.URL+tt.path)
+
+			if health.Healthy != tt.healthy {
+				t.Errorf("Healthy = %v, want %v (error %q)", health.Healthy, tt.healthy, health.Error)
+			}
+			if health.StatusCode != tt.statusCode {
+				t.Errorf("StatusCode = %d, want %d", health.StatusCode, tt.statusCode)
+			}
+			if tt.finalPath != "" && health.FinalURL != srv.URL+tt.finalPath {
+				t.Errorf("FinalURL = %q, want %q", health.FinalURL, srv.URL+tt.finalPath)
+			}
+			if health.Error != tt.err {
+				t.Errorf("Error = %q, want %q", health.Error, tt.err)
+			}
+			if health.CheckedAt.IsZero() {
+				t.Error("CheckedAt is not set")
+			}
+		})
+	}
+}
+
+func TestHealthCheckerHostDelay(t *testing.T) {
+	var mu sync.Mutex
+	var hits []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits = append(hits, time.Now())
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	const delay = 100 * time.Millisecond
+	checker := newTestHealthChecker(srv.Client(), HealthCheckerConfig{Concurrency: 4, HostDelay: delay})
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checker.Check(context.Background(), i, srv.URL)
+		}()
+	}
+	wg.Wait()
+
+	if len(hits) != 3 {
+		t.Fatalf("got %d requests, want 3", len(hits))
+	}
+	for i := 1; i < len(hits); i++ {
+		// Запрос идет после паузы, отсчитанной от окончания предыдущего
+		if gap := hits[i].Sub(hits[i-1]); gap < delay {
+			t.Errorf("requests %d and %d are %s apart, want at least %s", i-1, i, gap, delay)
+		}
+	}
+}
+
+func TestHealthCheckerSlowHostDoesNotBlockOthers(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer slow.Close()
+
+	fastHit := make(chan time.Time, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case fastHit <- time.Now():
+		default:
+		}
+	}))
+	defer fast.Close()
+
+	// Три ссылки на хост с паузой 300ms идут первыми, единственное место запроса
+	// не должно простаивать, пока они ждут своей очереди
+	urls := &listURLRepo{urls: []models.URL{
+		{ID: 1, OriginalURL: slow.URL + "/a"},
+		{ID: 2, OriginalURL: slow.URL + "/b"},
+		{ID: 3, OriginalURL: slow.URL + "/c"},
+		{ID: 4, OriginalURL: fast.URL},
+	}}
+	health := &memoryHealthRepo{}
+	checker := NewHealthChecker(urls, health, slow.Client(), HealthCheckerConfig{
+		Concurrency: 1,
+		HostDelay:   300 * time.Millisecond,
+		Timeout:     time.Second,
+	})
+
+	start := time.Now()
+	checked, broken, err := checker.CheckAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != 4 || broken != 0 {
+		t.Fatalf("checked %d, broken %d, want 4 and 0", checked, broken)
+	}
+
+	if waited := (<-fastHit).Sub(start); waited > 250*time.Millisecond {
+		t.Errorf("fast host was checked after %s, blocked behind the slow host", waited)
+	}
+	if len(health.saved) != 4 {
+		t.Errorf("saved %d results, want 4", len(health.saved))
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"url-shortener/internal/models"
+)
+
+// placeholderPattern находит подстановки {param} в адресе назначения
+var placeholderPattern = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// PassthroughRequest - часть запроса к короткой ссылке, которая может быть передана в адрес назначения
+type PassthroughRequest struct {
+	Query url.Values // Параметры запроса без служебных маркеров
+	Path  string     // Путь после короткого кода, без ведущего слэша
+}
+
+// validatePassthrough проверяет режим передачи параметров ссылки
+func validatePassthrough(mode string) error {
+	switch mode {
+	case models.QueryPassthroughIgnore, models.QueryPassthroughMerge, models.QueryPassthroughOverride:
+		return nil
+	default:
+		return fmt.Errorf("unknown query passthrough mode %q", mode)
+	}
+}
+
+// BuildDestination строит итоговый адрес редиректа: заполняет подстановки {param}
+// значениями из запроса, добавляет хвост пути и параметры запроса согласно политике ссылки.
+// Подстановки экранируются по месту: в пути как сегмент пути, в запросе как значение параметра.
+// Адрес ссылки без передачи параметров возвращается как есть, даже если в нем есть фигурные скобки.
+func BuildDestination(destination string, link *models.URL, req PassthroughRequest) (string, error) {
+	if !link.HasPassthrough() {
+		return destination, nil
+	}
+
+	query := req.Query
+	if query == nil {
+		query = url.Values{}
+	}
+
+	filled, used := fillPlaceholders(destination, query)
+
+	target, err := url.Parse(filled)
+	if err != nil {
+		return "", fmt.Errorf("invalid destination after substitution: %w", err)
+	}
+
+	// Подстановки не должны менять хост назначения
+	if original, err := url.Parse(placeholderPattern.ReplaceAllString(destination, "")); err == nil && original.Host != target.Host {
+		return "", errors.New("placeholder changes destination host")
+	}
+
+	if link.PathPassthrough && req.Path != "" {
+		appendPath(target, req.Path)
+	}
+
+	switch link.QueryPassthrough {
+	case models.QueryPassthroughMerge, models.QueryPassthroughOverride:
+		values := target.Query()
+		for key, vals := range query {
+			if used[key] {
+				continue
+			}
+			if _, exists := values[key]; exists && link.QueryPassthrough == models.QueryPassthroughMerge {
+				continue
+			}
+			values[key] = vals
+		}
+		target.RawQuery = values.Encode()
+	}
+
+	return target.String(), nil
+}
+
+// fillPlaceholders заменяет {param} значениями из query. Отсутствующие параметры дают пустую строку.
+// Возвращает имена параметров, использованных в подстановках: они не передаются повторно.
+func fillPlaceholders(destination string, query url.Values) (string, map[string]bool) {
+	used := make(map[string]bool)
+	if !strings.Contains(destination, "{") {
+		return destination, used
+	}
+
+	queryStart := strings.IndexAny(destination, "?#")
+
+	var b strings.Builder
+	last := 0
+	for _, m := range placeholderPattern.FindAllStringSubmatchIndex(destination, -1) {
+		name := destination[m[2]:m[3]]
+		value := query.Get(name)
+		used[name] = true
+
+		b.WriteString(destination[last:m[0]])
+		if queryStart >= 0 && m[0] > queryStart {
+			b.WriteString(url.QueryEscape(value))
+		} else {
+			b.WriteString(url.PathEscape(value))
+		}
+		last = m[1]
+	}
+	b.WriteString(destination[last:])
+
+	return b.String(), used
+}
+
+// appendPath добавляет сегменты пути из запроса к пути назначения.
+// Сегменты "." и ".." отбрасываются, остальные экранируются по отдельности.
+func appendPath(target *url.URL, extra string) {
+	var segments []string
+	for _, segment := range strings.Split(extra, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	if len(segments) == 0 {
+		return
+	}
+
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = url.PathEscape(segment)
+	}
+
+	base := strings.TrimSuffix(target.EscapedPath(), "/")
+	rawPath := base + "/" + strings.Join(escaped, "/")
+
+	decoded, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return
+	}
+	target.Path = decoded
+	target.RawPath = rawPath
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"net/url"
+	"testing"
+	"url-shortener/internal/models"
+)
+
+func TestBuildDestination(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		queryMode   string
+		path        bool
+		query       url.Values
+		rest        string
+		want        string
+		wantErr     bool
+	}{
+		{
+			name:        "no passthrough keeps braces",
+			destination: "https://example.com/{id}?q={q}",
+			queryMode:   models.QueryPassthroughIgnore,
+			query:       url.Values{"id": {"1"}, "q": {"x"}},
+			want:        "https://example.com/{id}?q={q}",
+		},
+		{
+			name:        "ignore drops query",
+			destination: "https://example.com/page",
+			queryMode:   models.QueryPassthroughIgnore,
+			path:        true,
+			query:       url.Values{"ref": {"newsletter"}},
+			want:        "https://example.com/page",
+		},
+		{
+			name:        "merge keeps destination params",
+			destination: "https://example.com/page?ref=site",
+			queryMode:   models.QueryPassthroughMerge,
+			query:       url.Values{"ref": {"newsletter"}, "utm_source": {"mail"}},
+			want:        "https://example.com/page?ref=site&utm_source=mail",
+		},
+		{
+			name:        "override replaces destination params",
+			destination: "https://example.com/page?ref=site&lang=en",
+			queryMode:   models.QueryPassthroughOverride,
+			query:       url.Values{"ref": {"newsletter"}},
+			want:        "https://example.com/page?lang=en&ref=newsletter",
+		},
+		{
+			name:        "passed value is escaped",
+			destination: "https://example.com/page",
+			queryMode:   models.QueryPassthroughMerge,
+			query:       url.Values{"q": {"a&b=c d"}},
+			want:        "https://example.com/page?q=a%26b%3Dc+d",
+		},
+		{
+			name:        "path placeholder escapes slash and space",
+			destination: "https://example.com/users/{user}",
+			queryMode:   models.QueryPassthroughMerge,
+			query:       url.Values{"user": {"a b/c"}},
+			want:        "https://example.com/users/a%20b%2Fc",
+		},
+		{
+			name:        "query placeholder escapes separators",
+			destination: "https://example.com/search?q={q}",
+			queryMode:   models.QueryPassthroughMerge,
+			query:       url.Values{"q": {"a&b=c#d"}},
+			want:        "https://example.com/search?q=a%26b%3Dc%23d",
+		},
+		{
+			name:        "used placeholder is not passed again",
+			destination: "https://example.com/{id}",
+			queryMode:   models.QueryPassthroughOverride,
+			query:       url.Values{"id": {"42"}, "ref": {"x"}},
+			want:        "https://example.com/42?ref=x",
+		},
+		{
+			name:        "missing placeholder is empty",
+			destination: "https://example.com/search?q={q}",
+			queryMode:   models.QueryPassthroughMerge,
+			want:        "https://example.com/search?q=",
+		},
+		{
+			name:        "placeholder cannot change host",
+			destination: "https://{host}/page",
+			queryMode:   models.QueryPassthroughMerge,
+			query:       url.Values{"host": {"evil.example"}},
+			wantErr:     true,
+		},
+		{
+			name:        "path segments are appended and escaped",
+			destination: "https://example.com/docs/",
+			queryMode:   models.QueryPassthroughIgnore,
+			path:        true,
+			rest:        "guide/a b/%3F",
+			want:        "https://example.com/docs/guide/a%20b/%253F",
+		},
+		{
+			name:        "dot segments are dropped",
+			destination: "https://example.com/docs",
+			queryMode:   models.QueryPassthroughIgnore,
+			path:        true,
+			rest:        "../../admin/./x",
+			want:        "https://example.com/docs/admin/x",
+		},
+		{
+			name:        "path is ignored without path passthrough",
+			destination: "https://example.com/docs",
+			queryMode:   models.QueryPassthroughMerge,
+			rest:        "extra",
+			want:        "https://example.com/docs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link := &models.URL{QueryPassthrough: tt.queryMode, PathPassthrough: tt.path}
+			got, err := BuildDestination(tt.destination, link, PassthroughRequest{Query: tt.query, Path: tt.rest})
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Статусы проверок готовности
+const (
+	ReadinessOK          = "ok"
+	ReadinessFailed      = "failed"
+	ReadinessUnavailable = "unavailable"
+	ReadinessDraining    = "draining"
+	// ReadinessDegraded - необязательная зависимость недоступна, но трафик принимается
+	ReadinessDegraded = "degraded"
+)
+
+// CheckResult - результат проверки одной зависимости
+type CheckResult struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// ReadinessReport - сводный результат проверки готовности
+type ReadinessReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Ready сообщает, можно ли направлять трафик на этот экземпляр
+func (r ReadinessReport) Ready() bool {
+	return r.Status == ReadinessOK || r.Status == ReadinessDegraded
+}
+
+type readinessCheck struct {
+	name     string
+	check    func(ctx context.Context) error
+	optional bool
+}
+
+// Readiness проверяет зависимости сервиса для /readyz. После начала остановки
+// экземпляр сразу считается неготовым, чтобы балансировщик успел вывести его из ротации.
+type Readiness struct {
+	timeout  time.Duration
+	checks   []readinessCheck
+	draining atomic.Bool
+}
+
+func NewReadiness(timeout time.Duration) *Readiness {
+	return &Readiness{timeout: timeout}
+}
+
+// AddCheck регистрирует проверку зависимости. Вызывается до запуска HTTP сервера.
+func (r *Readiness) AddCheck(name string, check func(ctx context.Context) error) {
+	r.checks = append(r.checks, readinessCheck{name: name, check: check})
+}
+
+// AddOptionalCheck регистрирует зависимость, без которой сервис работает в деградированном режиме
+func (r *Readiness) AddOptionalCheck(name string, check func(ctx context.Context) error) {
+	r.checks = append(r.checks, readinessCheck{name: name, check: check, optional: true})
+}
+
+// SetDraining переводит экземпляр в режим остановки
+func (r *Readiness) SetDraining() {
+	r.draining.Store(true)
+}
+
+// Check выполняет все проверки параллельно, каждую со своим таймаутом
+func (r *Readiness) Check(ctx context.Context) ReadinessReport {
+	if r.draining.Load() {
+		return ReadinessReport{Status: ReadinessDraining}
+	}
+
+	results := make([]CheckResult, len(r.checks))
+	var wg sync.WaitGroup
+	for i, c := range r.checks {
+		wg.Add(1)
+		go func(i int, c readinessCheck) {
+			defer wg.Done()
+			results[i] = r.run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := ReadinessReport{Status: ReadinessOK, Checks: make(map[string]CheckResult, len(r.checks))}
+	for i, c := range r.checks {
+		report.Checks[c.name] = results[i]
+		if results[i].Status == ReadinessOK {
+			continue
+		}
+		if !c.optional {
+			report.Status = ReadinessUnavailable
+		} else if report.Status == ReadinessOK {
+			report.Status = ReadinessDegraded
+		}
+	}
+
+	return report
+}
+
+func (r *Readiness) run(ctx context.Context, c readinessCheck) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.check(ctx)
+	result := CheckResult{
+		Status:     ReadinessOK,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = ReadinessFailed
+		result.Error = err.Error()
+	}
+
+	return result
+}
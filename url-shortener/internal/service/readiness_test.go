@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func okCheck(ctx context.Context) error { return nil }
+
+func failingCheck(ctx context.Context) error { return errors.New("connection refused") }
+
+// hangingCheck ждет, пока не истечет таймаут проверки
+func hangingCheck(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestReadinessStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		postgres func(ctx context.Context) error
+		redis    func(ctx context.Context) error
+		want     string
+	}{
+		{name: "all ok", postgres: okCheck, redis: okCheck, want: ReadinessOK},
+		{name: "redis down", postgres: okCheck, redis: failingCheck, want: ReadinessDegraded},
+		{name: "postgres down", postgres: failingCheck, redis: okCheck, want: ReadinessUnavailable},
+		{name: "both down", postgres: failingCheck, redis: failingCheck, want: ReadinessUnavailable},
+		{name: "postgres hangs", postgres: hangingCheck, redis: okCheck, want: ReadinessUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReadiness(20 * time.Millisecond)
+			r.AddCheck("postgres", tt.postgres)
+			r.AddOptionalCheck("redis", tt.redis)
+
+			report := r.Check(context.Background())
+			if report.Status != tt.want {
+				t.Errorf("Status = %q, want %q", report.Status, tt.want)
+			}
+			if report.Ready() != (tt.want != ReadinessUnavailable) {
+				t.Errorf("Ready() = %v for status %q", report.Ready(), report.Status)
+			}
+			if len(report.Checks) != 2 {
+				t.Errorf("Checks = %v, want postgres and redis", report.Checks)
+			}
+		})
+	}
+}
+
+func TestReadinessCheckTimesOut(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	r := NewReadiness(timeout)
+	r.AddCheck("postgres", hangingCheck)
+	r.AddOptionalCheck("redis", hangingCheck)
+
+	start := time.Now()
+	report := r.Check(context.Background())
+	if elapsed := time.Since(start); elapsed > 10*timeout {
+		t.Fatalf("Check took %s with timeout %s", elapsed, timeout)
+	}
+
+	for _, name := range []string{"postgres", "redis"} {
+		result := report.Checks[name]
+		if result.Status != ReadinessFailed || !strings.Contains(result.Error, context.DeadlineExceeded.Error()) {
+			t.Errorf("%s = %+v, want failed with deadline exceeded", name, result)
+		}
+		if result.DurationMs < float64(timeout.Milliseconds()) {
+			t.Errorf("%s took %.1fms, want at least the timeout", name, result.DurationMs)
+		}
+	}
+}
+
+func TestReadinessDraining(t *testing.T) {
+	r := NewReadiness(time.Second)
+	r.AddCheck("postgres", func(ctx context.Context) error {
+		t.Error("checks must not run while draining")
+		return nil
+	})
+	r.SetDraining()
+
+	report := r.Check(context.Background())
+	if report.Status != ReadinessDraining || report.Ready() {
+		t.Errorf("report = %+v, want draining and not ready", report)
+	}
+}
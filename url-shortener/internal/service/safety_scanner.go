@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/safety"
+)
+
+const (
+	safetyScanBatchSize = 100
+	safetyScannerActor  = "system:safety"
+)
+
+// SafetyScanner периодически перепроверяет существующие ссылки и отключает те,
+// у которых хотя бы один адрес назначения стал небезопасным (например, домен попал в denylist)
+type SafetyScanner struct {
+	urlRepo      repository.URLRepository
+	variantRepo  repository.VariantRepository
+	scheduleRepo repository.ScheduleRepository
+	cacheRepo    repository.CacheRepository
+	auditRepo    repository.AuditRepository
+	tx           repository.Transactor
+	checker      safety.Checker
+	interval     time.Duration
+	ctx          context.Context
+	cancel       context.CancelFunc
+	done         chan struct{}
+}
+
+func NewSafetyScanner(urlRepo repository.URLRepository, variantRepo repository.VariantRepository, scheduleRepo repository.ScheduleRepository, cacheRepo repository.CacheRepository, auditRepo repository.AuditRepository, tx repository.Transactor, checker safety.Checker, interval time.Duration) *SafetyScanner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &SafetyScanner{
+		urlRepo:      urlRepo,
+		variantRepo:  variantRepo,
+		scheduleRepo: scheduleRepo,
+		cacheRepo:    cacheRepo,
+		auditRepo:    auditRepo,
+		tx:           tx,
+		checker:      checker,
+		interval:     interval,
+		ctx:          ctx,
+		cancel:       cancel,
+		done:         make(chan struct{}),
+	}
+}
+
+func (s *SafetyScanner) Start() {
+	go s.run()
+}
+
+func (s *SafetyScanner) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			disabled, err := s.ScanAll(s.ctx)
+			if err != nil {
+				slog.ErrorContext(s.ctx, "safety scan failed", "error", err)
+				continue
+			}
+			if disabled > 0 {
+				slog.InfoContext(s.ctx, "safety scan disabled links", "disabled", disabled)
+			}
+		}
+	}
+}
+
+// ScanAll проверяет все включенные ссылки и возвращает количество отключенных
+func (s *SafetyScanner) ScanAll(ctx context.Context) (int, error) {
+	disabled := 0
+	afterID := 0
+
+	for {
+		urls, err := s.urlRepo.ListActive(ctx, afterID, safetyScanBatchSize)
+		if err != nil {
+			return disabled, err
+		}
+		if len(urls) == 0 {
+			return disabled, nil
+		}
+
+		for _, url := range urls {
+			afterID = url.ID
+
+			checkErr, err := s.check(ctx, &url)
+			if err != nil {
+				return disabled, err
+			}
+			if checkErr == nil {
+				continue
+			}
+			if !errors.Is(checkErr, safety.ErrUnsafeURL) {
+				// Временные ошибки (DNS, провайдер репутации) не повод отключать ссылку
+				slog.WarnContext(ctx, "safety scan skipped link", "short_code", url.ShortCode, "error", checkErr)
+				continue
+			}
+
+			if err := s.disable(ctx, &url, checkErr.Error()); err != nil {
+				return disabled, err
+			}
+
+			slog.WarnContext(ctx, "safety scan disabled link", "short_code", url.ShortCode, "reason", checkErr)
+			disabled++
+		}
+	}
+}
+
+// check проверяет все адреса, на которые ссылка может перенаправить. Возвращает ошибку
+// первой не прошедшей проверки; err - ошибка чтения ссылки из базы.
+func (s *SafetyScanner) check(ctx context.Context, url *models.URL) (checkErr, err error) {
+	destinations, err := s.destinations(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	for _, destination := range destinations {
+		if checkErr := safety.CheckString(ctx, s.checker, destination); checkErr != nil {
+			return fmt.Errorf("%s: %w", destination, checkErr), nil
+		}
+	}
+	return nil, nil
+}
+
+// destinations собирает основной адрес, варианты A/B теста, действующую и будущие записи
+// расписания и страницы магазинов приложений
+func (s *SafetyScanner) destinations(ctx context.Context, url *models.URL) ([]string, error) {
+	destinations := []string{url.OriginalURL}
+	for _, store := range []string{url.IOSStoreURL, url.AndroidStoreURL} {
+		if store != "" {
+			destinations = append(destinations, store)
+		}
+	}
+
+	variants, err := s.variantRepo.GetByURLID(ctx, url.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range variants {
+		destinations = append(destinations, v.DestinationURL)
+	}
+
+	schedule, err := s.scheduleRepo.GetByURLID(ctx, url.ID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i, entry := range schedule {
+		// Запись, после которой уже началась следующая, больше не действует
+		if i+1 < len(schedule) && !schedule[i+1].StartsAt.After(now) {
+			continue
+		}
+		destinations = append(destinations, entry.DestinationURL)
+	}
+
+	return destinations, nil
+}
+
+// disable отключает ссылку и записывает это в журнал аудита одной транзакцией
+func (s *SafetyScanner) disable(ctx context.Context, url *models.URL, reason string) error {
+	err := s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.urlRepo.SetDisabled(ctx, url.ID, true, reason); err != nil {
+			return err
+		}
+
+		entry := &models.AuditEntry{
+			URLID:   url.ID,
+			Actor:   safetyScannerActor,
+			Action:  models.AuditActionDisable,
+			Changes: map[string]interface{}{"reason": reason},
+		}
+		if err := s.auditRepo.Record(ctx, entry); err != nil {
+			return fmt.Errorf("failed to record audit entry for URL ID %d: %w", url.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.cacheRepo.DeleteURL(ctx, url.Domain, url.ShortCode); err != nil {
+		slog.WarnContext(ctx, "failed to invalidate cached URL", "short_code", url.ShortCode, "error", err)
+	}
+	return nil
+}
+
+func (s *SafetyScanner) Shutdown() {
+	s.cancel()
+	<-s.done
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/safety"
+)
+
+type fixedVariantRepo struct {
+	repository.VariantRepository
+	variants []models.URLVariant
+}
+
+func (r fixedVariantRepo) GetByURLID(ctx context.Context, urlID int) ([]models.URLVariant, error) {
+	return r.variants, nil
+}
+
+type fixedScheduleRepo struct {
+	repository.ScheduleRepository
+	entries []models.URLScheduleEntry
+}
+
+func (r fixedScheduleRepo) GetByURLID(ctx context.Context, urlID int) ([]models.URLScheduleEntry, error) {
+	return r.entries, nil
+}
+
+func TestSafetyScannerChecksEveryDestination(t *testing.T) {
+	const good, bad = "https://good.example/", "https://bad.example/"
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		url      models.URL
+		variants []models.URLVariant
+		schedule []models.URLScheduleEntry
+		unsafe   bool
+	}{
+		{name: "all destinations are safe", url: models.URL{OriginalURL: good, IOSStoreURL: good}},
+		{name: "original url", url: models.URL{OriginalURL: bad}, unsafe: true},
+		{name: "app store url", url: models.URL{OriginalURL: good, AndroidStoreURL: bad}, unsafe: true},
+		{
+			name:     "variant destination",
+			url:      models.URL{OriginalURL: good},
+			variants: []models.URLVariant{{DestinationURL: good, Weight: 1}, {DestinationURL: bad, Weight: 1}},
+			unsafe:   true,
+		},
+		{
+			name:     "upcoming schedule entry",
+			url:      models.URL{OriginalURL: good},
+			schedule: []models.URLScheduleEntry{{StartsAt: now.Add(time.Hour), DestinationURL: bad}},
+			unsafe:   true,
+		},
+		{
+			name: "current schedule entry",
+			url:  models.URL{OriginalURL: good},
+			schedule: []models.URLScheduleEntry{
+				{StartsAt: now.Add(-2 * time.Hour), DestinationURL: good},
+				{StartsAt: now.Add(-time.Hour), DestinationURL: bad},
+			},
+			unsafe: true,
+		},
+		{
+			name: "superseded schedule entry is ignored",
+			url:  models.URL{OriginalURL: good},
+			schedule: []models.URLScheduleEntry{
+				{StartsAt: now.Add(-2 * time.Hour), DestinationURL: bad},
+				{StartsAt: now.Add(-time.Hour), DestinationURL: good},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := &SafetyScanner{
+				variantRepo:  fixedVariantRepo{variants: tt.variants},
+				scheduleRepo: fixedScheduleRepo{entries: tt.schedule},
+				checker:      safety.NewDenylistChecker(safety.NewDomainList("bad.example")),
+			}
+
+			checkErr, err := scanner.check(context.Background(), &tt.url)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := errors.Is(checkErr, safety.ErrUnsafeURL); got != tt.unsafe {
+				t.Errorf("check() = %v, want unsafe=%v", checkErr, tt.unsafe)
+			}
+		})
+	}
+}
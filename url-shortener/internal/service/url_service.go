@@ -4,24 +4,84 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"github.com/redis/go-redis/v9"
-	"log"
+	"fmt"
+	"log/slog"
+	"math"
 	"math/rand"
 	"net/url"
+	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
+	"url-shortener/internal/metrics"
 	"url-shortener/internal/models"
 	"url-shortener/internal/repository"
+	"url-shortener/internal/safety"
+	"url-shortener/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 )
 
 const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
+// shortCodeAttempts - сколько случайных кодов проверяется, прежде чем создание ссылки отклоняется
+const shortCodeAttempts = 10
+
+// shortCodeInsertAttempts - сколько раз ссылка создается заново, если выбранный код успели занять
+const shortCodeInsertAttempts = 3
+
+const maxVariants = 10
+
+const maxScheduleEntries = 20
+
+// urlCacheTTL - время жизни ссылки в кэше, если расписание не требует обновить ее раньше
+const urlCacheTTL = time.Hour
+
+// CachePolicy задает кэширование отсутствующих ссылок и досрочное обновление горячих записей
+type CachePolicy struct {
+	NotFoundTTL time.Duration // Время жизни записи об отсутствии ссылки, 0 - не кэшировать
+	// EarlyRefreshBeta - коэффициент вероятностного досрочного обновления (XFetch), 0 - выключено.
+	// Чем он больше, тем раньше до истечения записи начинается фоновая загрузка из базы.
+	EarlyRefreshBeta float64
+}
+
 type URLService struct {
-	urlRepo   repository.URLRepository
-	cacheRepo repository.CacheRepository
+	urlRepo      repository.URLRepository
+	cacheRepo    repository.CacheRepository
+	variantRepo  repository.VariantRepository
+	scheduleRepo repository.ScheduleRepository
+	auditRepo    repository.AuditRepository
+	tx           repository.Transactor
+	checker      safety.Checker
+	canon        Canonicalizer
+	events       EventPublisher
+	domains      *DomainService
+	cachePolicy  CachePolicy
+	codes        *CodeFilter // nil, если фильтр кодов выключен
+
+	// loads объединяет одновременные загрузки одной ссылки из базы
+	loads singleflight.Group
+	// loadTime - скользящее среднее длительности загрузки ссылки из базы в наносекундах
+	loadTime atomic.Int64
 }
 
-func NewURLService(urlRepo repository.URLRepository, cacheRepo repository.CacheRepository) *URLService {
-	return &URLService{urlRepo, cacheRepo}
+func NewURLService(urlRepo repository.URLRepository, cacheRepo repository.CacheRepository, variantRepo repository.VariantRepository, scheduleRepo repository.ScheduleRepository, auditRepo repository.AuditRepository, tx repository.Transactor, checker safety.Checker, canon Canonicalizer, events EventPublisher, domains *DomainService, cachePolicy CachePolicy, codes *CodeFilter) *URLService {
+	return &URLService{
+		urlRepo:      urlRepo,
+		cacheRepo:    cacheRepo,
+		variantRepo:  variantRepo,
+		scheduleRepo: scheduleRepo,
+		auditRepo:    auditRepo,
+		tx:           tx,
+		checker:      checker,
+		canon:        canon,
+		events:       events,
+		domains:      domains,
+		cachePolicy:  cachePolicy,
+		codes:        codes,
+	}
 }
 
 func validateURL(urlStr string) error {
@@ -49,6 +109,19 @@ func validateURL(urlStr string) error {
 	return nil
 }
 
+// checkDestination выполняет базовую валидацию и проверку безопасности адреса назначения
+func (s *URLService) checkDestination(ctx context.Context, urlStr string) error {
+	if err := validateURL(urlStr); err != nil {
+		return err
+	}
+
+	if s.checker == nil {
+		return nil
+	}
+
+	return safety.CheckString(ctx, s.checker, urlStr)
+}
+
 func randomString(l int) string {
 	b := make([]byte, l)
 	for i := range b {
@@ -57,74 +130,774 @@ func randomString(l int) string {
 	return string(b)
 }
 
-func (s *URLService) CreateShortURL(ctx context.Context, originalURL string) (*models.URL, error) {
-	if err := validateURL(originalURL); err != nil {
+// CreateURLParams описывает запрос на создание короткой ссылки
+type CreateURLParams struct {
+	OwnerID     string
+	OriginalURL string
+	// Domain - брендированный домен владельца, пустая строка - домен по умолчанию
+	Domain string
+	// ReuseExisting - вернуть существующую ссылку этого же владельца на тот же адрес вместо создания новой
+	ReuseExisting bool
+}
+
+// CreateShortURL создает короткую ссылку. Второе значение равно false, если
+// по ReuseExisting была возвращена уже существующая ссылка владельца.
+func (s *URLService) CreateShortURL(ctx context.Context, params CreateURLParams) (*models.URL, bool, error) {
+	originalURL := params.OriginalURL
+	if err := s.checkDestination(ctx, originalURL); err != nil {
+		return nil, false, err
+	}
+
+	if err := s.domains.CheckOwned(ctx, params.OwnerID, params.Domain); err != nil {
+		return nil, false, err
+	}
+
+	canonicalURL, err := s.canon.Canonicalize(originalURL)
+	if err != nil {
+		return nil, false, err
+	}
+	canonicalHash := CanonicalHash(canonicalURL)
+
+	if params.ReuseExisting {
+		existing, err := s.urlRepo.FindByCanonicalHash(ctx, params.OwnerID, params.Domain, canonicalHash)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, false, err
+		}
+		if existing != nil {
+			return existing, false, nil
+		}
+	}
+
+	newURL := &models.URL{
+		OwnerID:          params.OwnerID,
+		Domain:           params.Domain,
+		OriginalURL:      originalURL,
+		CanonicalURL:     canonicalURL,
+		CanonicalHash:    canonicalHash,
+		QueryPassthrough: models.QueryPassthroughIgnore,
+		PendingBehavior:  models.PendingNotFound,
+	}
+
+	// Свободный при проверке код мог успеть занять другой экземпляр: тогда выбирается новый
+	for attempt := 1; ; attempt++ {
+		newURL.ShortCode, err = s.generateShortCode(ctx, params.Domain)
+		if err != nil {
+			return nil, false, err
+		}
+
+		err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+			if err := s.urlRepo.Create(ctx, newURL); err != nil {
+				return err
+			}
+			return s.audit(ctx, params.OwnerID, models.AuditActionCreate, newURL, map[string]interface{}{
+				"domain":       newURL.Domain,
+				"short_code":   newURL.ShortCode,
+				"original_url": newURL.OriginalURL,
+			})
+		})
+		if !errors.Is(err, repository.ErrShortCodeTaken) || attempt == shortCodeInsertAttempts {
+			break
+		}
+		slog.WarnContext(ctx, "short code was taken concurrently, retrying", "domain", newURL.Domain, "short_code", newURL.ShortCode)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if s.codes != nil {
+		s.codes.Add(ctx, newURL.Domain, newURL.ShortCode)
+	}
+
+	// Код мог быть запрошен до создания: сбрасывается запись об отсутствии ссылки на всех экземплярах
+	s.invalidate(ctx, newURL)
+	if err := s.cacheRepo.SetURL(ctx, newURL, urlCacheTTL); err != nil {
+		logCacheError(ctx, "failed to cache URL", err)
+	}
+
+	return newURL, true, nil
+}
+
+// generateShortCode подбирает случайный код, не занятый в домене
+func (s *URLService) generateShortCode(ctx context.Context, domain string) (string, error) {
+	for i := 0; i < shortCodeAttempts; i++ {
+		shortCode := randomString(6)
+		// Код, которого нет в фильтре, точно свободен. Гонку с другим экземпляром ловит уникальный индекс.
+		if s.codes != nil && !s.codes.MayContain(domain, shortCode) {
+			return shortCode, nil
+		}
+		exists, err := s.urlRepo.FindByShortCode(repository.WithPrimary(ctx), domain, shortCode)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return "", err
+		}
+		if exists == nil {
+			return shortCode, nil
+		}
+	}
+	return "", errors.New("failed to generate unique short code")
+}
+
+// GetURL возвращает ссылку по домену и коду, сначала из кэша, затем из базы.
+// Расписание вычисляется при загрузке: Destination содержит действующий адрес назначения,
+// Phase - состояние ссылки, а кэш живет не дольше ближайшего перехода.
+func (s *URLService) GetURL(ctx context.Context, domain, shortCode string) (_ *models.URL, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "URLService.GetURL", trace.WithAttributes(
+		tracing.AttrShortCode.String(shortCode),
+		tracing.AttrDomain.String(domain),
+	))
+	defer func() {
+		if errors.Is(err, sql.ErrNoRows) {
+			span.End()
+			return
+		}
+		tracing.End(span, err)
+	}()
+
+	if s.codes != nil && !s.codes.MayContain(domain, shortCode) {
+		span.SetAttributes(attribute.Bool("code_filter.rejected", true))
+		return nil, sql.ErrNoRows
+	}
+
+	// Ошибка кэша считается промахом: данные есть в базе
+	url, ttl, cacheErr := s.cacheRepo.GetURL(ctx, domain, shortCode)
+	switch {
+	case errors.Is(cacheErr, repository.ErrCachedNotFound):
+		span.SetAttributes(tracing.AttrCacheResult.String(metrics.CacheNegativeHit))
+		return nil, sql.ErrNoRows
+	case errors.Is(cacheErr, repository.ErrCacheUnavailable):
+		span.SetAttributes(tracing.AttrCacheResult.String(metrics.CacheSkipped))
+	case cacheErr != nil:
+		span.SetAttributes(tracing.AttrCacheResult.String(metrics.CacheError))
+		logCacheError(ctx, "failed to read cached URL", cacheErr)
+	case url != nil:
+		span.SetAttributes(tracing.AttrCacheResult.String(metrics.CacheHit))
+		// В записях, сохраненных до появления Destination, действующий адрес лежит в OriginalURL
+		if url.Destination == "" {
+			url.Destination = url.OriginalURL
+		}
+		if s.shouldRefreshEarly(ttl) {
+			span.SetAttributes(attribute.Bool("cache.early_refresh", true))
+			s.loads.DoChan(loadKey(domain, shortCode), func() (interface{}, error) {
+				return s.fetchURL(context.WithoutCancel(ctx), domain, shortCode)
+			})
+		}
+		return url, nil
+	default:
+		span.SetAttributes(tracing.AttrCacheResult.String(metrics.CacheMiss))
+	}
+
+	return s.loadURL(ctx, domain, shortCode)
+}
+
+func loadKey(domain, shortCode string) string {
+	return domain + "/" + shortCode
+}
+
+// loadURL загружает ссылку из базы. Одновременные промахи по одной ссылке дают один запрос,
+// результат которого получают все ожидающие. Запрос, который отменили, перестает ждать сразу.
+func (s *URLService) loadURL(ctx context.Context, domain, shortCode string) (*models.URL, error) {
+	// Загрузка не отменяется вместе с запросом, который ее начал: ее результат ждут и другие
+	ch := s.loads.DoChan(loadKey(domain, shortCode), func() (interface{}, error) {
+		return s.fetchURL(context.WithoutCancel(ctx), domain, shortCode)
+	})
+
+	select {
+	case result := <-ch:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		url := *result.Val.(*models.URL)
+		return &url, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// shouldRefreshEarly решает, обновить ли запись до истечения ttl. Вероятность растет по мере
+// приближения к истечению и со временем загрузки из базы, поэтому горячую запись обычно
+// обновляет один запрос заранее, а не все сразу после истечения.
+func (s *URLService) shouldRefreshEarly(ttl time.Duration) bool {
+	beta := s.cachePolicy.EarlyRefreshBeta
+	delta := s.loadTime.Load()
+	if beta <= 0 || ttl <= 0 || delta <= 0 {
+		return false
+	}
+	return float64(delta)*beta*-math.Log(rand.Float64()) >= float64(ttl)
+}
+
+// recordLoadTime обновляет скользящее среднее длительности загрузки
+func (s *URLService) recordLoadTime(d time.Duration) {
+	prev := s.loadTime.Load()
+	if prev == 0 {
+		s.loadTime.Store(int64(d))
+		return
+	}
+	s.loadTime.Store(prev + (int64(d)-prev)/8)
+}
+
+// fetchURL читает ссылку из базы вместе с вариантами и расписанием и кладет результат в кэш
+func (s *URLService) fetchURL(ctx context.Context, domain, shortCode string) (*models.URL, error) {
+	start := time.Now()
+
+	url, err := s.urlRepo.FindByShortCode(ctx, domain, shortCode)
+	if errors.Is(err, sql.ErrNoRows) && s.cachePolicy.NotFoundTTL > 0 {
+		if err := s.cacheRepo.SetNotFound(ctx, domain, shortCode, s.cachePolicy.NotFoundTTL); err != nil {
+			logCacheError(ctx, "failed to cache missing URL", err)
+		}
+	}
+	if err != nil {
 		return nil, err
 	}
 
-	existing, err := s.GetURLByOriginal(ctx, originalURL)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+	url.Variants, err = s.variantRepo.GetByURLID(ctx, url.ID)
+	if err != nil {
 		return nil, err
 	}
-	if existing != nil {
-		return existing, nil
+
+	url.Schedule, err = s.scheduleRepo.GetByURLID(ctx, url.ID)
+	if err != nil {
+		return nil, err
 	}
 
-	var shortCode string
-	maxAttempts := 10
+	now := time.Now()
+	url.Phase = url.PhaseAt(now)
+	url.Destination = url.DestinationAt(now)
 
-	for i := 0; i < maxAttempts; i++ {
-		shortCode = randomString(6)
-		exists, err := s.urlRepo.FindByShortCode(ctx, shortCode)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+	s.recordLoadTime(time.Since(start))
+
+	if err := s.cacheRepo.SetURL(ctx, url, scheduleCacheTTL(url, now)); err != nil {
+		logCacheError(ctx, "failed to cache URL", err)
+	}
+
+	return url, nil
+}
+
+// GetOwnedURL возвращает ссылку, только если она принадлежит ownerID.
+// Чужие ссылки неотличимы от несуществующих и дают sql.ErrNoRows.
+func (s *URLService) GetOwnedURL(ctx context.Context, ownerID, domain, shortCode string) (*models.URL, error) {
+	url, err := s.GetURL(ctx, domain, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if url.OwnerID != ownerID || url.IsDeleted() {
+		return nil, sql.ErrNoRows
+	}
+
+	return url, nil
+}
+
+func (s *URLService) findOwned(ctx context.Context, ownerID, domain, shortCode string) (*models.URL, error) {
+	// Найденная ссылка сразу изменяется: устаревшая строка с реплики затерла бы чужое изменение
+	url, err := s.urlRepo.FindByShortCode(repository.WithPrimary(ctx), domain, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if url.OwnerID != ownerID || url.IsDeleted() {
+		return nil, sql.ErrNoRows
+	}
+
+	return url, nil
+}
+
+func (s *URLService) GetURLByOriginal(ctx context.Context, ownerID, domain, originalURL string) (*models.URL, error) {
+	canonicalURL, err := s.canon.Canonicalize(originalURL)
+	if err != nil {
+		return nil, err
+	}
+	return s.urlRepo.FindByCanonicalHash(ctx, ownerID, domain, CanonicalHash(canonicalURL))
+}
+
+// UpdateURL меняет адрес назначения существующей короткой ссылки
+func (s *URLService) UpdateURL(ctx context.Context, ownerID, domain, shortCode, originalURL string) (*models.URL, error) {
+	if err := s.checkDestination(ctx, originalURL); err != nil {
+		return nil, err
+	}
+
+	canonicalURL, err := s.canon.Canonicalize(originalURL)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := s.findOwned(ctx, ownerID, domain, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	previousURL := url.OriginalURL
+	url.OriginalURL = originalURL
+	url.CanonicalURL = canonicalURL
+	url.CanonicalHash = CanonicalHash(canonicalURL)
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.urlRepo.Update(ctx, url); err != nil {
+			return err
+		}
+		return s.audit(ctx, ownerID, models.AuditActionUpdate, url, map[string]interface{}{
+			"original_url": map[string]string{"old": previousURL, "new": originalURL},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidate(ctx, url)
+
+	return url, nil
+}
+
+// SetVariants заменяет варианты A/B теста для короткой ссылки. Пустой список отключает тест.
+func (s *URLService) SetVariants(ctx context.Context, ownerID, domain, shortCode string, variants []models.URLVariant) (*models.URL, error) {
+	if len(variants) > maxVariants {
+		return nil, fmt.Errorf("too many variants, maximum is %d", maxVariants)
+	}
+
+	for _, v := range variants {
+		if err := s.checkDestination(ctx, v.DestinationURL); err != nil {
 			return nil, err
 		}
-		if exists == nil {
-			break
+		if v.Weight <= 0 {
+			return nil, errors.New("variant weight must be positive")
 		}
-		if i == maxAttempts-1 {
-			return nil, errors.New("failed to generate unique short code")
+	}
+
+	url, err := s.findOwned(ctx, ownerID, domain, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.variantRepo.ReplaceForURL(ctx, url.ID, variants); err != nil {
+			return err
 		}
+		return s.audit(ctx, ownerID, models.AuditActionVariants, url, map[string]interface{}{
+			"variants": variants,
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
+	url.Variants = variants
 
-	newURL := &models.URL{
-		ShortCode:   shortCode,
-		OriginalURL: originalURL,
+	s.invalidate(ctx, url)
+
+	return url, nil
+}
+
+// Preview - пользовательские Open Graph метаданные ссылки
+type Preview struct {
+	Title       string
+	Description string
+	Image       string
+}
+
+const (
+	maxPreviewTitle       = 200
+	maxPreviewDescription = 1000
+)
+
+// SetPreview задает превью, которое видят боты мессенджеров вместо метаданных страницы назначения.
+// Пустые поля сбрасывают соответствующую часть превью.
+func (s *URLService) SetPreview(ctx context.Context, ownerID, domain, shortCode string, preview Preview) (*models.URL, error) {
+	if len(preview.Title) > maxPreviewTitle {
+		return nil, fmt.Errorf("title is too long, maximum is %d characters", maxPreviewTitle)
+	}
+	if len(preview.Description) > maxPreviewDescription {
+		return nil, fmt.Errorf("description is too long, maximum is %d characters", maxPreviewDescription)
+	}
+	if preview.Image != "" {
+		if err := validateURL(preview.Image); err != nil {
+			return nil, fmt.Errorf("invalid image: %w", err)
+		}
 	}
 
-	if err := s.urlRepo.Create(ctx, newURL); err != nil {
+	url, err := s.findOwned(ctx, ownerID, domain, shortCode)
+	if err != nil {
 		return nil, err
 	}
 
-	if err := s.cacheRepo.SetURL(ctx, newURL); err != nil {
+	url.OGTitle = preview.Title
+	url.OGDescription = preview.Description
+	url.OGImage = preview.Image
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.urlRepo.Update(ctx, url); err != nil {
+			return err
+		}
+		return s.audit(ctx, ownerID, models.AuditActionPreview, url, map[string]interface{}{
+			"og_title":       preview.Title,
+			"og_description": preview.Description,
+			"og_image":       preview.Image,
+		})
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return newURL, nil
+	s.invalidate(ctx, url)
+
+	return url, nil
+}
+
+// DeepLinks - адреса для открытия мобильного приложения и магазины на случай, если оно не установлено
+type DeepLinks struct {
+	IOS             string
+	IOSStoreURL     string
+	Android         string
+	AndroidStoreURL string
 }
 
-func (s *URLService) GetURL(ctx context.Context, shortCode string) (*models.URL, error) {
-	url, err := s.cacheRepo.GetURL(ctx, shortCode)
-	if err != nil && !errors.Is(err, redis.Nil) {
+// SetDeepLinks задает переходы в мобильное приложение. Пустые поля отключают соответствующую платформу.
+func (s *URLService) SetDeepLinks(ctx context.Context, ownerID, domain, shortCode string, links DeepLinks) (*models.URL, error) {
+	for _, uri := range []string{links.IOS, links.Android} {
+		if uri == "" {
+			continue
+		}
+		if err := validateDeepLink(uri); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, store := range []string{links.IOSStoreURL, links.AndroidStoreURL} {
+		if store == "" {
+			continue
+		}
+		if err := s.checkDestination(ctx, store); err != nil {
+			return nil, fmt.Errorf("invalid store url: %w", err)
+		}
+	}
+
+	url, err := s.findOwned(ctx, ownerID, domain, shortCode)
+	if err != nil {
 		return nil, err
 	}
 
-	if url != nil {
-		return url, nil
+	url.IOSDeepLink = links.IOS
+	url.IOSStoreURL = links.IOSStoreURL
+	url.AndroidDeepLink = links.Android
+	url.AndroidStoreURL = links.AndroidStoreURL
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.urlRepo.Update(ctx, url); err != nil {
+			return err
+		}
+		return s.audit(ctx, ownerID, models.AuditActionDeepLink, url, map[string]interface{}{
+			"ios_deep_link":     links.IOS,
+			"ios_store_url":     links.IOSStoreURL,
+			"android_deep_link": links.Android,
+			"android_store_url": links.AndroidStoreURL,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.invalidate(ctx, url)
+
+	return url, nil
+}
+
+// forbiddenDeepLinkSchemes - схемы, которые браузер выполнит сам вместо открытия приложения
+var forbiddenDeepLinkSchemes = map[string]bool{
+	"javascript": true,
+	"data":       true,
+	"vbscript":   true,
+	"file":       true,
+	"blob":       true,
+	"intent":     true,
+}
+
+// validateDeepLink проверяет URI приложения: собственная схема (myapp://...) или
+// https адрес Universal Link / App Link
+func validateDeepLink(uri string) error {
+	if len(uri) > 2048 {
+		return errors.New("deep link is too long")
+	}
+
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme == "" {
+		return errors.New("deep link must be an absolute URI with a scheme")
+	}
+
+	scheme := strings.ToLower(parsed.Scheme)
+	if forbiddenDeepLinkSchemes[scheme] {
+		return fmt.Errorf("deep link scheme %q is not allowed", scheme)
+	}
+	if scheme == "http" {
+		return errors.New("deep link must use https or an app scheme")
+	}
+	if scheme == "https" {
+		return validateURL(uri)
+	}
+	// На Android ссылка встраивается в intent://, где после "#" идут параметры интента
+	if strings.Contains(uri, "#") {
+		return errors.New("app deep link must not contain a fragment")
 	}
 
-	url, err = s.urlRepo.FindByShortCode(ctx, shortCode)
+	return nil
+}
+
+// SetPassthrough задает, как параметры запроса и путь после кода передаются в адрес назначения
+func (s *URLService) SetPassthrough(ctx context.Context, ownerID, domain, shortCode, queryMode string, pathPassthrough bool) (*models.URL, error) {
+	if err := validatePassthrough(queryMode); err != nil {
+		return nil, err
+	}
+
+	url, err := s.findOwned(ctx, ownerID, domain, shortCode)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := s.cacheRepo.SetURL(ctx, url); err != nil {
-		log.Printf("Failed to cache URL: %v", err)
+	url.QueryPassthrough = queryMode
+	url.PathPassthrough = pathPassthrough
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.urlRepo.Update(ctx, url); err != nil {
+			return err
+		}
+		return s.audit(ctx, ownerID, models.AuditActionPassthru, url, map[string]interface{}{
+			"query_passthrough": queryMode,
+			"path_passthrough":  pathPassthrough,
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	s.invalidate(ctx, url)
+
 	return url, nil
 }
 
-func (s *URLService) GetURLByOriginal(ctx context.Context, originalURL string) (*models.URL, error) {
-	return s.urlRepo.FindByOriginalURL(ctx, originalURL)
+// scheduleCacheTTL возвращает время жизни кэша, которое заканчивается к ближайшему переходу по расписанию
+func scheduleCacheTTL(url *models.URL, now time.Time) time.Duration {
+	ttl := urlCacheTTL
+	if next := url.NextTransition(now); !next.IsZero() && next.Sub(now) < ttl {
+		ttl = next.Sub(now)
+	}
+	return ttl
+}
+
+// Schedule - окно активности ссылки и смена адреса назначения по времени
+type Schedule struct {
+	ActiveFrom      *time.Time
+	ActiveUntil     *time.Time
+	PendingBehavior string
+	Entries         []models.URLScheduleEntry
+}
+
+// SetSchedule заменяет расписание ссылки. Пустое расписание делает ссылку активной всегда.
+func (s *URLService) SetSchedule(ctx context.Context, ownerID, domain, shortCode string, schedule Schedule) (*models.URL, error) {
+	if schedule.PendingBehavior == "" {
+		schedule.PendingBehavior = models.PendingNotFound
+	}
+	if schedule.PendingBehavior != models.PendingNotFound && schedule.PendingBehavior != models.PendingComingSoon {
+		return nil, fmt.Errorf("unknown pending behavior %q", schedule.PendingBehavior)
+	}
+
+	if schedule.ActiveFrom != nil && schedule.ActiveUntil != nil && !schedule.ActiveUntil.After(*schedule.ActiveFrom) {
+		return nil, errors.New("active_until must be after active_from")
+	}
+
+	if len(schedule.Entries) > maxScheduleEntries {
+		return nil, fmt.Errorf("too many schedule entries, maximum is %d", maxScheduleEntries)
+	}
+
+	seen := make(map[time.Time]bool, len(schedule.Entries))
+	for _, entry := range schedule.Entries {
+		if entry.StartsAt.IsZero() {
+			return nil, errors.New("schedule entry must have starts_at")
+		}
+		if seen[entry.StartsAt] {
+			return nil, errors.New("schedule entries must have distinct starts_at")
+		}
+		seen[entry.StartsAt] = true
+
+		if err := s.checkDestination(ctx, entry.DestinationURL); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(schedule.Entries, func(i, j int) bool {
+		return schedule.Entries[i].StartsAt.Before(schedule.Entries[j].StartsAt)
+	})
+
+	url, err := s.findOwned(ctx, ownerID, domain, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	url.ActiveFrom = schedule.ActiveFrom
+	url.ActiveUntil = schedule.ActiveUntil
+	url.PendingBehavior = schedule.PendingBehavior
+	// Окно активности и записи расписания меняются вместе: половина изменения дала бы несогласованную фазу
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.urlRepo.Update(ctx, url); err != nil {
+			return err
+		}
+		if err := s.scheduleRepo.ReplaceForURL(ctx, url.ID, schedule.Entries); err != nil {
+			return err
+		}
+		return s.audit(ctx, ownerID, models.AuditActionSchedule, url, map[string]interface{}{
+			"active_from":      schedule.ActiveFrom,
+			"active_until":     schedule.ActiveUntil,
+			"pending_behavior": schedule.PendingBehavior,
+			"schedule":         schedule.Entries,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	url.Schedule = schedule.Entries
+	now := time.Now()
+	url.Phase = url.PhaseAt(now)
+	url.Destination = url.DestinationAt(now)
+
+	s.invalidate(ctx, url)
+
+	return url, nil
+}
+
+// DisableURL отключает ссылку: редирект перестает работать, но ссылка и ее история сохраняются
+func (s *URLService) DisableURL(ctx context.Context, ownerID, domain, shortCode, reason string) (*models.URL, error) {
+	url, err := s.findOwned(ctx, ownerID, domain, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.urlRepo.SetDisabled(ctx, url.ID, true, reason); err != nil {
+			return err
+		}
+		return s.audit(ctx, ownerID, models.AuditActionDisable, url, map[string]interface{}{
+			"reason": reason,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	url.Disabled = true
+	url.DisabledReason = reason
+
+	s.invalidate(ctx, url)
+
+	return url, nil
+}
+
+func (s *URLService) EnableURL(ctx context.Context, ownerID, domain, shortCode string) (*models.URL, error) {
+	url, err := s.findOwned(ctx, ownerID, domain, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.urlRepo.SetDisabled(ctx, url.ID, false, ""); err != nil {
+			return err
+		}
+		return s.audit(ctx, ownerID, models.AuditActionEnable, url, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	url.Disabled = false
+	url.DisabledReason = ""
+
+	s.invalidate(ctx, url)
+
+	return url, nil
+}
+
+// DeleteURL мягко удаляет ссылку. Короткий код остается занятым и не будет выдан повторно.
+func (s *URLService) DeleteURL(ctx context.Context, ownerID, domain, shortCode string) error {
+	url, err := s.findOwned(ctx, ownerID, domain, shortCode)
+	if err != nil {
+		return err
+	}
+
+	err = s.tx.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.urlRepo.Delete(ctx, url.ID); err != nil {
+			return err
+		}
+		return s.audit(ctx, ownerID, models.AuditActionDelete, url, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.invalidate(ctx, url)
+
+	return nil
+}
+
+// GetAuditLog возвращает журнал изменений ссылки владельца, начиная с последних
+func (s *URLService) GetAuditLog(ctx context.Context, ownerID, domain, shortCode string) ([]models.AuditEntry, error) {
+	url, err := s.urlRepo.FindByShortCode(ctx, domain, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	// Журнал удаленной ссылки остается доступен владельцу
+	if url.OwnerID != ownerID {
+		return nil, sql.ErrNoRows
+	}
+
+	return s.auditRepo.ListByURLID(ctx, url.ID)
+}
+
+func (s *URLService) invalidate(ctx context.Context, url *models.URL) {
+	if err := s.cacheRepo.DeleteURL(ctx, url.Domain, url.ShortCode); err != nil {
+		logCacheError(ctx, "failed to invalidate cached URL", err)
+	}
+}
+
+// logCacheError пишет ошибку кэша в журнал. Пока Redis отключен выключателем,
+// каждый запрос не логируется: о переходе в этот режим сообщает сам кэш.
+func logCacheError(ctx context.Context, msg string, err error) {
+	if errors.Is(err, repository.ErrCacheUnavailable) {
+		return
+	}
+	slog.WarnContext(ctx, msg, "error", err)
+}
+
+// auditEvents сопоставляет действия журнала аудита событиям вебхуков
+var auditEvents = map[string]string{
+	models.AuditActionCreate:   models.EventLinkCreated,
+	models.AuditActionUpdate:   models.EventLinkUpdated,
+	models.AuditActionVariants: models.EventLinkUpdated,
+	models.AuditActionPreview:  models.EventLinkUpdated,
+	models.AuditActionDeepLink: models.EventLinkUpdated,
+	models.AuditActionPassthru: models.EventLinkUpdated,
+	models.AuditActionSchedule: models.EventLinkUpdated,
+	models.AuditActionDisable:  models.EventLinkDisabled,
+	models.AuditActionEnable:   models.EventLinkEnabled,
+	models.AuditActionDelete:   models.EventLinkDeleted,
+}
+
+// audit записывает изменение в журнал и публикует соответствующее событие. Вызывается
+// внутри транзакции изменения: если запись журнала или события не удалась, изменение откатывается.
+func (s *URLService) audit(ctx context.Context, ownerID, action string, url *models.URL, changes map[string]interface{}) error {
+	entry := &models.AuditEntry{
+		URLID:   url.ID,
+		Actor:   auditActor(ownerID),
+		Action:  action,
+		Changes: changes,
+	}
+
+	if err := s.auditRepo.Record(ctx, entry); err != nil {
+		return fmt.Errorf("failed to record audit entry %s for URL ID %d: %w", action, url.ID, err)
+	}
+
+	if event, ok := auditEvents[action]; ok && s.events != nil {
+		return s.events.Publish(ctx, url.OwnerID, event, map[string]interface{}{
+			"domain":       url.Domain,
+			"short_code":   url.ShortCode,
+			"original_url": url.OriginalURL,
+			"owner_id":     url.OwnerID,
+			"changes":      changes,
+		})
+	}
+
+	return nil
+}
+
+func auditActor(ownerID string) string {
+	if ownerID == "" {
+		return "anonymous"
+	}
+	return ownerID
 }
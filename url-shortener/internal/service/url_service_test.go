@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"url-shortener/internal/metrics"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// stubCache хранит ссылки в map без срока жизни
+type stubCache struct {
+	urls map[string]*models.URL
+}
+
+func (c *stubCache) GetURL(ctx context.Context, domain, shortCode string) (*models.URL, time.Duration, error) {
+	if url, ok := c.urls[loadKey(domain, shortCode)]; ok {
+		copied := *url
+		return &copied, time.Minute, nil
+	}
+	return nil, 0, nil
+}
+
+func (c *stubCache) SetURL(ctx context.Context, url *models.URL, ttl time.Duration) error {
+	c.urls[loadKey(url.Domain, url.ShortCode)] = url
+	return nil
+}
+
+func (c *stubCache) SetNotFound(ctx context.Context, domain, shortCode string, ttl time.Duration) error {
+	return nil
+}
+
+func (c *stubCache) DeleteURL(ctx context.Context, domain, shortCode string) error {
+	delete(c.urls, loadKey(domain, shortCode))
+	return nil
+}
+
+// codeURLRepo находит ссылки по короткому коду
+type codeURLRepo struct {
+	repository.URLRepository
+	urls map[string]models.URL
+}
+
+func (r *codeURLRepo) FindByShortCode(ctx context.Context, domain, shortCode string) (*models.URL, error) {
+	url, ok := r.urls[loadKey(domain, shortCode)]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &url, nil
+}
+
+type emptyVariantRepo struct{ repository.VariantRepository }
+
+func (emptyVariantRepo) GetByURLID(ctx context.Context, urlID int) ([]models.URLVariant, error) {
+	return nil, nil
+}
+
+type emptyScheduleRepo struct{ repository.ScheduleRepository }
+
+func (emptyScheduleRepo) GetByURLID(ctx context.Context, urlID int) ([]models.URLScheduleEntry, error) {
+	return nil, nil
+}
+
+func TestGetURLSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	cache := &stubCache{urls: make(map[string]*models.URL)}
+	svc := &URLService{
+		urlRepo: &codeURLRepo{urls: map[string]models.URL{
+			loadKey("", "abc123"): {ID: 1, ShortCode: "abc123", OriginalURL: "https://example.com"},
+		}},
+		cacheRepo:    cache,
+		variantRepo:  emptyVariantRepo{},
+		scheduleRepo: emptyScheduleRepo{},
+	}
+
+	// Первый запрос - промах кэша и загрузка из базы, второй - попадание
+	for _, want := range []string{metrics.CacheMiss, metrics.CacheHit} {
+		t.Run(want, func(t *testing.T) {
+			ctx, parent := tracing.Tracer().Start(context.Background(), "request")
+			url, err := svc.GetURL(ctx, "", "abc123")
+			parent.End()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if url.Destination != "https://example.com" {
+				t.Errorf("Destination = %q", url.Destination)
+			}
+
+			var span sdktrace.ReadOnlySpan
+			for _, s := range recorder.Ended() {
+				if s.Name() == "URLService.GetURL" && s.SpanContext().TraceID() == parent.SpanContext().TraceID() {
+					span = s
+				}
+			}
+			if span == nil {
+				t.Fatal("URLService.GetURL span not recorded")
+			}
+			if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Error("GetURL span is not a child of the request span")
+			}
+
+			attrs := attribute.NewSet(span.Attributes()...)
+			if v, _ := attrs.Value(tracing.AttrCacheResult); v.AsString() != want {
+				t.Errorf("cache.result = %q, want %q", v.AsString(), want)
+			}
+			if v, _ := attrs.Value(tracing.AttrShortCode); v.AsString() != "abc123" {
+				t.Errorf("url.short_code = %q", v.AsString())
+			}
+		})
+	}
+}
+
+func TestGetURLNotFoundIsNotSpanError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	svc := &URLService{
+		urlRepo:   &codeURLRepo{},
+		cacheRepo: &stubCache{urls: make(map[string]*models.URL)},
+	}
+
+	if _, err := svc.GetURL(context.Background(), "", "missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("err = %v, want sql.ErrNoRows", err)
+	}
+
+	for _, span := range recorder.Ended() {
+		if span.Name() == "URLService.GetURL" && len(span.Events()) > 0 {
+			t.Errorf("missing link recorded as span error: %v", span.Status())
+		}
+	}
+}
+
+// blockingURLRepo отвечает только после закрытия release
+type blockingURLRepo struct {
+	repository.URLRepository
+	release chan struct{}
+}
+
+func (r *blockingURLRepo) FindByShortCode(ctx context.Context, domain, shortCode string) (*models.URL, error) {
+	<-r.release
+	return &models.URL{ID: 1, ShortCode: shortCode, OriginalURL: "https://example.com"}, nil
+}
+
+func TestLoadURLStopsWaitingOnCancel(t *testing.T) {
+	repo := &blockingURLRepo{release: make(chan struct{})}
+	svc := &URLService{
+		urlRepo:      repo,
+		cacheRepo:    &stubCache{urls: make(map[string]*models.URL)},
+		variantRepo:  emptyVariantRepo{},
+		scheduleRepo: emptyScheduleRepo{},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := svc.loadURL(ctx, "", "abc123")
+		errs <- err
+	}()
+
+	cancel()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("err = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("loadURL kept waiting for the database after cancel")
+	}
+
+	// Загрузка продолжается и достается следующим запросам
+	close(repo.release)
+	url, err := svc.loadURL(context.Background(), "", "abc123")
+	if err != nil || url.Destination != "https://example.com" {
+		t.Errorf("loadURL = %v, %v", url, err)
+	}
+}
+
+func TestValidateDeepLink(t *testing.T) {
+	tests := []struct {
+		uri     string
+		wantErr bool
+	}{
+		{uri: "myapp://product/42"},
+		{uri: "myapp://product/42?ref=sms"},
+		{uri: "myapp:open"},
+		{uri: "https://app.example.com/product/42"},
+		{uri: "https://app.example.com/product#reviews"},
+		{uri: "myapp://x#Intent;component=evil/.Main;S.foo=bar;end", wantErr: true},
+		{uri: "myapp://x#", wantErr: true},
+		{uri: "http://app.example.com/", wantErr: true},
+		{uri: "javascript:alert(1)", wantErr: true},
+		{uri: "intent://x#Intent;scheme=app;end", wantErr: true},
+		{uri: "product/42", wantErr: true},
+		{uri: "myapp://" + strings.Repeat("a", 2048), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			if err := validateDeepLink(tt.uri); (err != nil) != tt.wantErr {
+				t.Errorf("validateDeepLink() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetURLFallsThroughUntrustedCodeFilter(t *testing.T) {
+	repo := &pausedCodeRepo{started: make(chan struct{}), release: make(chan struct{})}
+	close(repo.release)
+	broadcast := &chanBroadcast{codes: make(chan [2]string)}
+	broadcast.down.Store(true)
+	codes := NewCodeFilter(repo, broadcast, CodeFilterConfig{FalsePositiveRate: 0.001})
+	if err := codes.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ссылку создал другой экземпляр, пока рассылка кодов не работала
+	svc := &URLService{
+		urlRepo: &codeURLRepo{urls: map[string]models.URL{
+			loadKey("", "fresh"): {ID: 1, ShortCode: "fresh", OriginalURL: "https://example.com"},
+		}},
+		cacheRepo:    &stubCache{urls: make(map[string]*models.URL)},
+		variantRepo:  emptyVariantRepo{},
+		scheduleRepo: emptyScheduleRepo{},
+		codes:        codes,
+	}
+
+	url, err := svc.GetURL(context.Background(), "", "fresh")
+	if err != nil {
+		t.Fatalf("GetURL: %v", err)
+	}
+	if url.ID != 1 {
+		t.Errorf("GetURL = %+v", url)
+	}
+}
+
+// takenCodeURLRepo отвечает на первые вставки нарушением уникального индекса,
+// как если бы код успел занять другой экземпляр
+type takenCodeURLRepo struct {
+	codeURLRepo
+	taken int
+	codes []string
+}
+
+func (r *takenCodeURLRepo) Create(ctx context.Context, url *models.URL) error {
+	r.codes = append(r.codes, url.ShortCode)
+	if len(r.codes) <= r.taken {
+		return repository.ErrShortCodeTaken
+	}
+	url.ID = len(r.codes)
+	return nil
+}
+
+func TestCreateShortURLRetriesTakenCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		taken   int
+		wantErr error
+	}{
+		{name: "free code", taken: 0},
+		{name: "code taken concurrently", taken: 2},
+		{name: "attempts exhausted", taken: shortCodeInsertAttempts, wantErr: repository.ErrShortCodeTaken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &takenCodeURLRepo{taken: tt.taken}
+			svc := &URLService{
+				urlRepo:   repo,
+				cacheRepo: &stubCache{urls: make(map[string]*models.URL)},
+				auditRepo: &countingAudit{},
+				tx:        &serialTx{},
+				domains:   &DomainService{},
+			}
+
+			url, created, err := svc.CreateShortURL(context.Background(), CreateURLParams{OriginalURL: "https://example.com/page"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if !created || url.ID != tt.taken+1 {
+				t.Errorf("CreateShortURL = %+v, %v", url, created)
+			}
+			if len(repo.codes) != tt.taken+1 || url.ShortCode != repo.codes[tt.taken] {
+				t.Errorf("inserted codes %v, link got %q", repo.codes, url.ShortCode)
+			}
+		})
+	}
+}
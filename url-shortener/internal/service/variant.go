@@ -0,0 +1,43 @@
+package service
+
+import (
+	"hash/fnv"
+	"url-shortener/internal/models"
+)
+
+// ChooseVariant выбирает вариант назначения с учетом весов. assignedID - вариант, выданный
+// посетителю раньше: он сохраняется, пока остается в тесте, даже если веса или порядок
+// вариантов изменились. Без него выбор детерминирован для пары (visitorKey, shortCode),
+// но зависит от весов и порядка. Возвращает nil, если у ссылки нет вариантов.
+func ChooseVariant(url *models.URL, visitorKey string, assignedID int) *models.URLVariant {
+	if assignedID != 0 {
+		for i := range url.Variants {
+			if url.Variants[i].ID == assignedID {
+				return &url.Variants[i]
+			}
+		}
+	}
+
+	totalWeight := 0
+	for _, v := range url.Variants {
+		totalWeight += v.Weight
+	}
+	if totalWeight <= 0 {
+		return nil
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(visitorKey))
+	h.Write([]byte{':'})
+	h.Write([]byte(url.ShortCode))
+	point := int(h.Sum32() % uint32(totalWeight))
+
+	for i := range url.Variants {
+		point -= url.Variants[i].Weight
+		if point < 0 {
+			return &url.Variants[i]
+		}
+	}
+
+	return nil
+}
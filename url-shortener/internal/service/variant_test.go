@@ -0,0 +1,113 @@
+package service
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"url-shortener/internal/models"
+)
+
+func testVariantURL(weights ...int) *models.URL {
+	url := &models.URL{ShortCode: "abc123"}
+	for i, w := range weights {
+		url.Variants = append(url.Variants, models.URLVariant{
+			ID:             i + 1,
+			DestinationURL: "https://example.com/" + strconv.Itoa(i+1),
+			Weight:         w,
+		})
+	}
+	return url
+}
+
+func TestChooseVariantSplitsByWeight(t *testing.T) {
+	const visitors = 20000
+
+	tests := []struct {
+		name    string
+		weights []int
+	}{
+		{name: "even", weights: []int{1, 1}},
+		{name: "skewed", weights: []int{90, 10}},
+		{name: "three way", weights: []int{50, 30, 20}},
+		{name: "single", weights: []int{5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := testVariantURL(tt.weights...)
+			total := 0
+			for _, w := range tt.weights {
+				total += w
+			}
+
+			counts := make(map[int]int)
+			for i := 0; i < visitors; i++ {
+				v := ChooseVariant(url, "visitor-"+strconv.Itoa(i), 0)
+				if v == nil {
+					t.Fatal("no variant chosen")
+				}
+				counts[v.ID]++
+			}
+
+			for i, w := range tt.weights {
+				want := float64(w) / float64(total)
+				got := float64(counts[i+1]) / visitors
+				if math.Abs(got-want) > 0.02 {
+					t.Errorf("variant %d got %.3f of visitors, want %.3f", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestChooseVariantIsSticky(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        *models.URL
+		assignedID int
+		wantID     int
+	}{
+		{
+			name:       "assigned variant survives weight change",
+			url:        testVariantURL(1, 1000),
+			assignedID: 1,
+			wantID:     1,
+		},
+		{
+			name:       "assigned variant survives reorder",
+			url:        &models.URL{ShortCode: "abc123", Variants: []models.URLVariant{{ID: 7, Weight: 1}, {ID: 3, Weight: 1}}},
+			assignedID: 3,
+			wantID:     3,
+		},
+		{
+			name:       "retired variant is reassigned",
+			url:        testVariantURL(0, 1),
+			assignedID: 9,
+			wantID:     2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := ChooseVariant(tt.url, "visitor", tt.assignedID)
+			if v == nil || v.ID != tt.wantID {
+				t.Fatalf("ChooseVariant = %v, want variant %d", v, tt.wantID)
+			}
+		})
+	}
+
+	// Без сохраненного варианта повторный визит попадает туда же
+	url := testVariantURL(1, 1, 1)
+	for i := 0; i < 100; i++ {
+		key := "visitor-" + strconv.Itoa(i)
+		if a, b := ChooseVariant(url, key, 0), ChooseVariant(url, key, 0); a.ID != b.ID {
+			t.Errorf("visitor %s got variants %d and %d", key, a.ID, b.ID)
+		}
+	}
+}
+
+func TestChooseVariantWithoutVariants(t *testing.T) {
+	if v := ChooseVariant(&models.URL{ShortCode: "abc123"}, "visitor", 0); v != nil {
+		t.Errorf("ChooseVariant = %v, want nil", v)
+	}
+}
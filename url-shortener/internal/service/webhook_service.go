@@ -0,0 +1,505 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	"url-shortener/internal/models"
+	"url-shortener/internal/repository"
+	"url-shortener/internal/safety"
+)
+
+const (
+	webhookClaimBatchSize = 50
+	webhookDeliveriesPage = 100
+	webhookMaxPerOwner    = 20
+	webhookUserAgent      = "url-shortener-webhooks/1.0"
+	// webhookResponseLimit - сколько байт ответа сохранять в тексте ошибки
+	webhookResponseLimit = 512
+)
+
+// webhookEvents - события, на которые разрешено подписываться
+var webhookEvents = []string{
+	models.EventLinkCreated,
+	models.EventLinkUpdated,
+	models.EventLinkDisabled,
+	models.EventLinkEnabled,
+	models.EventLinkDeleted,
+	models.EventLinkExpired,
+	models.EventLinkClickThreshold,
+}
+
+// EventPublisher принимает события об изменениях ссылок. Publish вызывается внутри
+// транзакции изменения: ошибка откатывает изменение, и событие не теряется.
+type EventPublisher interface {
+	Publish(ctx context.Context, ownerID, event string, data map[string]interface{}) error
+}
+
+// WebhookConfig задает параметры отправки вебхуков
+type WebhookConfig struct {
+	PollInterval time.Duration // Как часто диспетчер проверяет outbox
+	Timeout      time.Duration // Таймаут одного запроса
+	MaxAttempts  int           // После стольких неудач доставка помечается failed
+	BaseBackoff  time.Duration // Пауза перед второй попыткой, дальше удваивается
+	MaxBackoff   time.Duration // Верхняя граница паузы между попытками
+}
+
+// WebhookService регистрирует вебхуки, складывает события в outbox и доставляет их
+// с подписью HMAC-SHA256 и повторами с экспоненциальной паузой
+type WebhookService struct {
+	repo    repository.WebhookRepository
+	urlRepo repository.URLRepository
+	checker safety.Checker
+	client  *http.Client
+	cfg     WebhookConfig
+
+	// thresholds - все пороги кликов активных вебхуков. OnClick обращается к базе,
+	// только если число кликов совпало с одним из них. nil - пороги еще не загружены.
+	mu         sync.RWMutex
+	thresholds map[int]struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewWebhookService создает сервис. client может быть nil, тогда используется клиент,
+// который не ходит на внутренние адреса.
+func NewWebhookService(repo repository.WebhookRepository, urlRepo repository.URLRepository, checker safety.Checker, client *http.Client, cfg WebhookConfig) *WebhookService {
+	if client == nil {
+		dialer := &net.Dialer{Timeout: cfg.Timeout, Control: safety.DialControl}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = dialer.DialContext
+		transport.Proxy = nil
+
+		client = &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: transport,
+			// Редиректы не выполняются: получатель должен ответить сам
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WebhookService{
+		repo:    repo,
+		urlRepo: urlRepo,
+		checker: checker,
+		client:  client,
+		cfg:     cfg,
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+}
+
+// Register создает вебхук владельца и генерирует ключ подписи
+func (s *WebhookService) Register(ctx context.Context, ownerID, targetURL string, events []string, thresholds []int) (*models.Webhook, error) {
+	if ownerID == "" {
+		return nil, errors.New("owner is required")
+	}
+
+	if err := validateURL(targetURL); err != nil {
+		return nil, err
+	}
+	if s.checker != nil {
+		if err := safety.CheckString(ctx, s.checker, targetURL); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, event := range events {
+		if !slices.Contains(webhookEvents, event) {
+			return nil, fmt.Errorf("unknown event %q", event)
+		}
+	}
+	for _, t := range thresholds {
+		if t <= 0 {
+			return nil, errors.New("click thresholds must be positive")
+		}
+	}
+
+	existing, err := s.repo.ListByOwner(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= webhookMaxPerOwner {
+		return nil, fmt.Errorf("too many webhooks, maximum is %d", webhookMaxPerOwner)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+
+	if events == nil {
+		events = []string{}
+	}
+	if thresholds == nil {
+		thresholds = []int{}
+	}
+
+	webhook := &models.Webhook{
+		OwnerID:         ownerID,
+		URL:             targetURL,
+		Secret:          hex.EncodeToString(secret),
+		Events:          events,
+		ClickThresholds: thresholds,
+		Active:          true,
+	}
+
+	if err := s.repo.Create(ctx, webhook); err != nil {
+		return nil, err
+	}
+	s.addThresholds(thresholds)
+
+	return webhook, nil
+}
+
+func (s *WebhookService) List(ctx context.Context, ownerID string) ([]models.Webhook, error) {
+	return s.repo.ListByOwner(ctx, ownerID)
+}
+
+func (s *WebhookService) getOwned(ctx context.Context, ownerID string, webhookID int) (*models.Webhook, error) {
+	webhook, err := s.repo.GetByID(ctx, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if webhook.OwnerID != ownerID {
+		return nil, sql.ErrNoRows
+	}
+	return webhook, nil
+}
+
+func (s *WebhookService) Delete(ctx context.Context, ownerID string, webhookID int) error {
+	if _, err := s.getOwned(ctx, ownerID, webhookID); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, webhookID); err != nil {
+		return err
+	}
+	s.refreshThresholds(ctx)
+	return nil
+}
+
+// ListDeliveries возвращает последние доставки вебхука
+func (s *WebhookService) ListDeliveries(ctx context.Context, ownerID string, webhookID int) ([]models.WebhookDelivery, error) {
+	if _, err := s.getOwned(ctx, ownerID, webhookID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListDeliveries(ctx, webhookID, webhookDeliveriesPage)
+}
+
+// ListAttempts возвращает журнал попыток доставки
+func (s *WebhookService) ListAttempts(ctx context.Context, ownerID string, webhookID, deliveryID int) ([]models.WebhookAttempt, error) {
+	if _, err := s.getOwnedDelivery(ctx, ownerID, webhookID, deliveryID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListAttempts(ctx, deliveryID)
+}
+
+// Replay ставит доставку в очередь повторно, например после исправления ошибки на стороне получателя
+func (s *WebhookService) Replay(ctx context.Context, ownerID string, webhookID, deliveryID int) error {
+	if _, err := s.getOwnedDelivery(ctx, ownerID, webhookID, deliveryID); err != nil {
+		return err
+	}
+	return s.repo.Replay(ctx, deliveryID)
+}
+
+func (s *WebhookService) getOwnedDelivery(ctx context.Context, ownerID string, webhookID, deliveryID int) (*models.WebhookDelivery, error) {
+	if _, err := s.getOwned(ctx, ownerID, webhookID); err != nil {
+		return nil, err
+	}
+
+	delivery, err := s.repo.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.WebhookID != webhookID {
+		return nil, sql.ErrNoRows
+	}
+
+	return delivery, nil
+}
+
+// Publish складывает событие в outbox для всех подписанных вебхуков владельца. Вызывающий
+// передает контекст своей транзакции, поэтому доставки появляются в outbox вместе
+// с изменением и пропадают при его откате.
+func (s *WebhookService) Publish(ctx context.Context, ownerID, event string, data map[string]interface{}) error {
+	if ownerID == "" {
+		return nil
+	}
+
+	webhooks, err := s.repo.ListSubscribed(ctx, ownerID, event)
+	if err != nil {
+		return fmt.Errorf("failed to list webhooks for %s: %w", event, err)
+	}
+
+	return s.enqueue(ctx, webhooks, event, data)
+}
+
+// OnClick вызывается воркером после сохранения клика и отправляет событие
+// достижения порога, если новое число кликов совпало с порогом какого-либо вебхука
+func (s *WebhookService) OnClick(ctx context.Context, urlID, clickCount int) {
+	if !s.isThreshold(clickCount) {
+		return
+	}
+
+	webhooks, err := s.repo.ListForClickThreshold(ctx, urlID, clickCount)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to list click threshold webhooks", "url_id", urlID, "error", err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	url, err := s.urlRepo.GetByID(ctx, urlID)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to load URL for click threshold event", "url_id", urlID, "error", err)
+		return
+	}
+
+	err = s.enqueue(ctx, webhooks, models.EventLinkClickThreshold, map[string]interface{}{
+		"domain":       url.Domain,
+		"short_code":   url.ShortCode,
+		"original_url": url.OriginalURL,
+		"owner_id":     url.OwnerID,
+		"click_count":  clickCount,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to enqueue click threshold event", "url_id", urlID, "error", err)
+	}
+}
+
+func (s *WebhookService) enqueue(ctx context.Context, webhooks []models.Webhook, event string, data map[string]interface{}) error {
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"event":       event,
+		"occurred_at": time.Now().UTC(),
+		"data":        data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload for %s: %w", event, err)
+	}
+
+	for _, webhook := range webhooks {
+		delivery := &models.WebhookDelivery{
+			WebhookID: webhook.ID,
+			Event:     event,
+			Payload:   payload,
+		}
+		if err := s.repo.EnqueueDelivery(ctx, delivery); err != nil {
+			return fmt.Errorf("failed to enqueue %s for webhook %d: %w", event, webhook.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// isThreshold сообщает, может ли clickCount быть порогом какого-либо вебхука.
+// Пока пороги не загружены, ответ всегда true, и решение принимает база.
+func (s *WebhookService) isThreshold(clickCount int) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.thresholds == nil {
+		return true
+	}
+	_, ok := s.thresholds[clickCount]
+	return ok
+}
+
+func (s *WebhookService) addThresholds(thresholds []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.thresholds == nil {
+		return
+	}
+	for _, t := range thresholds {
+		s.thresholds[t] = struct{}{}
+	}
+}
+
+// refreshThresholds перечитывает пороги из базы. Вебхуки, созданные другими экземплярами
+// сервиса, попадают в набор при следующем обновлении, не позже чем через PollInterval.
+func (s *WebhookService) refreshThresholds(ctx context.Context) {
+	list, err := s.repo.ListClickThresholds(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to load webhook click thresholds", "error", err)
+		return
+	}
+
+	thresholds := make(map[int]struct{}, len(list))
+	for _, t := range list {
+		thresholds[t] = struct{}{}
+	}
+
+	s.mu.Lock()
+	s.thresholds = thresholds
+	s.mu.Unlock()
+}
+
+func (s *WebhookService) Start() {
+	s.refreshThresholds(s.ctx)
+	go s.run()
+}
+
+func (s *WebhookService) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.refreshThresholds(s.ctx)
+			if err := s.DispatchDue(s.ctx); err != nil && !errors.Is(err, context.Canceled) {
+				slog.ErrorContext(s.ctx, "webhook dispatch failed", "error", err)
+			}
+		}
+	}
+}
+
+// DispatchDue отправляет все доставки, у которых наступило время следующей попытки
+func (s *WebhookService) DispatchDue(ctx context.Context) error {
+	for {
+		// Пока доставка отправляется, другие экземпляры ее не берут
+		lease := 2*s.cfg.Timeout + time.Minute
+		deliveries, err := s.repo.ClaimDue(ctx, webhookClaimBatchSize, lease)
+		if err != nil {
+			return err
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		for i := range deliveries {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.deliver(ctx, &deliveries[i])
+		}
+	}
+}
+
+func (s *WebhookService) deliver(ctx context.Context, d *models.WebhookDelivery) {
+	d.Attempts++
+	attempt := &models.WebhookAttempt{DeliveryID: d.ID, Attempt: d.Attempts}
+
+	start := time.Now()
+	statusCode, err := s.send(ctx, d)
+	attempt.DurationMS = time.Since(start).Milliseconds()
+	attempt.StatusCode = statusCode
+	d.LastStatusCode = statusCode
+
+	if err == nil {
+		now := time.Now()
+		d.Status = models.DeliveryStatusDelivered
+		d.DeliveredAt = &now
+		d.LastError = ""
+		slog.InfoContext(ctx, "webhook delivered", "webhook_id", d.WebhookID, "event", d.Event, "delivery_id", d.ID, "attempt", d.Attempts)
+	} else {
+		attempt.Error = err.Error()
+		d.LastError = err.Error()
+		if d.Attempts >= s.cfg.MaxAttempts {
+			d.Status = models.DeliveryStatusFailed
+			slog.ErrorContext(ctx, "webhook delivery failed, giving up", "webhook_id", d.WebhookID, "delivery_id", d.ID, "attempts", d.Attempts, "error", err)
+		} else {
+			d.Status = models.DeliveryStatusPending
+			d.NextAttemptAt = time.Now().Add(s.backoff(d.Attempts))
+			slog.WarnContext(ctx, "webhook delivery attempt failed", "webhook_id", d.WebhookID, "delivery_id", d.ID,
+				"attempt", d.Attempts, "retry_at", d.NextAttemptAt, "error", err)
+		}
+	}
+
+	if err := s.repo.SaveAttempt(ctx, d, attempt); err != nil {
+		slog.ErrorContext(ctx, "failed to save webhook delivery state", "webhook_id", d.WebhookID, "delivery_id", d.ID, "error", err)
+	}
+}
+
+func (s *WebhookService) send(ctx context.Context, d *models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.WebhookURL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", webhookUserAgent)
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.Itoa(d.ID))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhook(d.Secret, timestamp, d.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+		return resp.StatusCode, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	return resp.StatusCode, nil
+}
+
+// backoff возвращает паузу перед следующей попыткой: BaseBackoff * 2^(attempt-1)
+// с ограничением MaxBackoff и случайным разбросом до 10%, чтобы повторы не шли пачкой
+func (s *WebhookService) backoff(attempt int) time.Duration {
+	delay := s.cfg.BaseBackoff
+	for i := 1; i < attempt && delay < s.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > s.cfg.MaxBackoff {
+		delay = s.cfg.MaxBackoff
+	}
+
+	if jitter := int64(delay / 10); jitter > 0 {
+		delay += time.Duration(mathrand.Int63n(jitter))
+	}
+
+	return delay
+}
+
+// SignWebhook вычисляет подпись HMAC-SHA256 от "timestamp.payload". Получатель
+// проверяет ее по заголовкам X-Webhook-Timestamp и X-Webhook-Signature.
+func SignWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *WebhookService) Shutdown() {
+	s.cancel()
+	<-s.done
+}
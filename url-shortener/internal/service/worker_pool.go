@@ -2,27 +2,49 @@ package service
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
+	"time"
+	"url-shortener/internal/logging"
+	"url-shortener/internal/metrics"
 	"url-shortener/internal/models"
+	"url-shortener/internal/tracing"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
+// queueSaturation - доля заполнения очереди кликов, при которой экземпляр перестает быть готовым
+const queueSaturation = 0.9
+
 type WorkerService struct {
 	analyticsService *AnalyticsService
-	clickQueue       chan *models.Click
+	webhookService   *WebhookService
+	clickQueue       chan clickJob
 	workerCount      int
 }
 
+// clickJob - клик в очереди вместе со ссылкой на спан и идентификатором запроса, в котором он произошел.
+// Обработка идет в отдельной трассе, связанной с исходной через span link.
+type clickJob struct {
+	click     *models.Click
+	link      trace.Link
+	requestID string
+}
+
 type ClickData struct {
 	URLID     int
 	IPAddress string
 	UserAgent string
 	Referer   string
+	VariantID *int
+	Source    string
 }
 
-func NewWorkerService(analyticsService *AnalyticsService, workerCount int) *WorkerService {
+func NewWorkerService(analyticsService *AnalyticsService, webhookService *WebhookService, workerCount int) *WorkerService {
 	ws := &WorkerService{
 		analyticsService: analyticsService,
-		clickQueue:       make(chan *models.Click, 1000),
+		webhookService:   webhookService,
+		clickQueue:       make(chan clickJob, 1000),
 		workerCount:      workerCount,
 	}
 
@@ -30,21 +52,43 @@ func NewWorkerService(analyticsService *AnalyticsService, workerCount int) *Work
 	return ws
 }
 
-func (ws *WorkerService) ProcessClickAsync(clickData *ClickData) {
+func (ws *WorkerService) ProcessClickAsync(ctx context.Context, clickData *ClickData) {
 	click := &models.Click{
 		URLID:     clickData.URLID,
 		IPAddress: clickData.IPAddress,
 		UserAgent: clickData.UserAgent,
 		Referer:   clickData.Referer,
+		VariantID: clickData.VariantID,
+		Source:    clickData.Source,
 	}
 
 	select {
-	case ws.clickQueue <- click:
+	case ws.clickQueue <- clickJob{click: click, link: trace.LinkFromContext(ctx), requestID: logging.RequestID(ctx)}:
 	default:
-		log.Printf("Click queue is full, dropping click for URL ID: %d", clickData.URLID)
+		metrics.ClicksDropped.Inc()
+		slog.WarnContext(ctx, "click queue is full, dropping click", "url_id", clickData.URLID)
 	}
 }
 
+// QueueDepth возвращает число кликов, ожидающих обработки
+func (ws *WorkerService) QueueDepth() int {
+	return len(ws.clickQueue)
+}
+
+// QueueCapacity возвращает емкость очереди кликов
+func (ws *WorkerService) QueueCapacity() int {
+	return cap(ws.clickQueue)
+}
+
+// CheckQueue возвращает ошибку, если очередь кликов почти заполнена и новые клики скоро начнут теряться
+func (ws *WorkerService) CheckQueue(ctx context.Context) error {
+	depth, capacity := ws.QueueDepth(), ws.QueueCapacity()
+	if float64(depth) >= queueSaturation*float64(capacity) {
+		return fmt.Errorf("click queue saturated: %d/%d", depth, capacity)
+	}
+	return nil
+}
+
 func (ws *WorkerService) startWorkers() {
 	for i := 0; i < ws.workerCount; i++ {
 		go ws.worker(i)
@@ -52,14 +96,34 @@ func (ws *WorkerService) startWorkers() {
 }
 
 func (ws *WorkerService) worker(id int) {
-	for click := range ws.clickQueue {
-		ctx := context.Background()
-		if err := ws.analyticsService.SaveClick(ctx, click); err != nil {
-			log.Printf("Worker %d: failed to save click: %v", id, err)
-		} else {
-			log.Printf("Worker %d: successfully processed click for URL ID: %d", id, click.URLID)
-		}
+	for job := range ws.clickQueue {
+		ws.process(id, job)
+	}
+}
+
+func (ws *WorkerService) process(id int, job clickJob) {
+	click := job.click
+	ctx := logging.WithRequestID(context.Background(), job.requestID)
+	ctx, span := tracing.Tracer().Start(ctx, "WorkerService.ProcessClick",
+		trace.WithLinks(job.link),
+		trace.WithAttributes(tracing.AttrURLID.Int(click.URLID)),
+	)
+
+	start := time.Now()
+	clickCount, err := ws.analyticsService.SaveClick(ctx, click)
+	if err != nil {
+		metrics.ClickSaveDuration.WithLabelValues("error").Observe(time.Since(start).Seconds())
+		slog.ErrorContext(ctx, "failed to save click", "worker", id, "url_id", click.URLID, "error", err)
+		tracing.End(span, err)
+		return
+	}
+	metrics.ClickSaveDuration.WithLabelValues("ok").Observe(time.Since(start).Seconds())
+	slog.DebugContext(ctx, "click processed", "worker", id, "url_id", click.URLID, "click_count", clickCount)
+
+	if ws.webhookService != nil {
+		ws.webhookService.OnClick(ctx, click.URLID, clickCount)
 	}
+	span.End()
 }
 
 func (ws *WorkerService) Shutdown() {
@@ -0,0 +1,93 @@
+// Package tracing настраивает OpenTelemetry и содержит общие атрибуты спанов сервиса
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "url-shortener"
+
+// Экспортеры спанов
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Атрибуты спанов, общие для слоев сервиса
+const (
+	AttrShortCode   = attribute.Key("url.short_code")
+	AttrDomain      = attribute.Key("url.domain")
+	AttrURLID       = attribute.Key("url.id")
+	AttrCacheResult = attribute.Key("cache.result")
+	AttrRows        = attribute.Key("db.response.returned_rows")
+)
+
+// Config задает экспортер и долю сэмплируемых трасс
+type Config struct {
+	Exporter    string  // none, stdout или otlp
+	ServiceName string  // Значение service.name в ресурсе
+	SampleRatio float64 // Доля новых трасс, попадающих в выборку; родительское решение сохраняется
+}
+
+// Tracer возвращает трейсер сервиса. До вызова Init спаны ничего не записывают.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Init устанавливает глобальные TracerProvider и propagator. Возвращает функцию,
+// которая выгружает накопленные спаны при остановке сервиса.
+// Настройки OTLP (адрес, заголовки) читаются из стандартных переменных OTEL_EXPORTER_OTLP_*.
+func Init(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s exporter: %w", cfg.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// End завершает спан, отмечая его ошибкой, если err не nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
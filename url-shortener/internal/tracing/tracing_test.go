@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return recorder
+}
+
+func TestEnd(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status codes.Code
+		events int
+	}{
+		{name: "success", status: codes.Unset},
+		{name: "error", err: errors.New("boom"), status: codes.Error, events: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := newRecorder(t)
+
+			_, span := Tracer().Start(context.Background(), "op")
+			End(span, tt.err)
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("got %d ended spans, want 1", len(spans))
+			}
+			if got := spans[0].Status().Code; got != tt.status {
+				t.Errorf("status = %v, want %v", got, tt.status)
+			}
+			if got := len(spans[0].Events()); got != tt.events {
+				t.Errorf("got %d events, want %d", got, tt.events)
+			}
+		})
+	}
+}
+
+func TestInitNone(t *testing.T) {
+	shutdown, err := Init(context.Background(), Config{Exporter: ExporterNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Init(context.Background(), Config{Exporter: "zipkin"}); err == nil {
+		t.Error("expected error for unknown exporter")
+	}
+}
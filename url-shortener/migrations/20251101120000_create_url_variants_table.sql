@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE url_variants(
+    id SERIAL PRIMARY KEY,
+    url_id INTEGER NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    destination_url TEXT NOT NULL CHECK (destination_url LIKE 'http%'),
+    weight INT NOT NULL CHECK (weight > 0),
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX idx_url_variants_url_id ON url_variants(url_id);
+
+ALTER TABLE clicks ADD COLUMN variant_id INTEGER REFERENCES url_variants(id) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE clicks DROP COLUMN variant_id;
+DROP TABLE url_variants;
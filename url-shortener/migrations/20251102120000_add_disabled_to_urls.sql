@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE urls ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE urls ADD COLUMN disabled_reason TEXT;
+
+-- +goose Down
+ALTER TABLE urls DROP COLUMN disabled_reason;
+ALTER TABLE urls DROP COLUMN disabled;
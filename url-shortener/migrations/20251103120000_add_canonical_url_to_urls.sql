@@ -0,0 +1,16 @@
+-- +goose Up
+ALTER TABLE urls ADD COLUMN canonical_url TEXT;
+ALTER TABLE urls ADD COLUMN canonical_hash CHAR(64);
+
+-- Для существующих ссылок канонической формой считается исходный адрес
+UPDATE urls
+SET canonical_url = original_url,
+    canonical_hash = encode(sha256(convert_to(original_url, 'UTF8')), 'hex')
+WHERE canonical_hash IS NULL;
+
+CREATE INDEX idx_urls_canonical_hash ON urls(canonical_hash);
+
+-- +goose Down
+DROP INDEX idx_urls_canonical_hash;
+ALTER TABLE urls DROP COLUMN canonical_hash;
+ALTER TABLE urls DROP COLUMN canonical_url;
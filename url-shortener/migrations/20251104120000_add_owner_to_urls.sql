@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE urls ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';
+
+DROP INDEX idx_urls_canonical_hash;
+CREATE INDEX idx_urls_owner_canonical_hash ON urls(owner_id, canonical_hash);
+
+-- +goose Down
+DROP INDEX idx_urls_owner_canonical_hash;
+CREATE INDEX idx_urls_canonical_hash ON urls(canonical_hash);
+ALTER TABLE urls DROP COLUMN owner_id;
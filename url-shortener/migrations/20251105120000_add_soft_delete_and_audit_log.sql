@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE urls ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE TABLE audit_log(
+    id SERIAL PRIMARY KEY,
+    url_id INTEGER NOT NULL REFERENCES urls(id),
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    changes JSONB,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX idx_audit_log_url_id ON audit_log(url_id, created_at);
+
+-- +goose Down
+DROP TABLE audit_log;
+ALTER TABLE urls DROP COLUMN deleted_at;
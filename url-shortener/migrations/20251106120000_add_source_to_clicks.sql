@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE clicks ADD COLUMN source TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE clicks DROP COLUMN source;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE urls ADD COLUMN og_title TEXT;
+ALTER TABLE urls ADD COLUMN og_description TEXT;
+ALTER TABLE urls ADD COLUMN og_image TEXT;
+
+-- +goose Down
+ALTER TABLE urls DROP COLUMN og_image;
+ALTER TABLE urls DROP COLUMN og_description;
+ALTER TABLE urls DROP COLUMN og_title;
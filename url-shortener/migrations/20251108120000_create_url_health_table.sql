@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE url_health(
+    url_id INTEGER PRIMARY KEY REFERENCES urls(id),
+    healthy BOOLEAN NOT NULL,
+    status_code INT,
+    latency_ms INT NOT NULL DEFAULT 0,
+    final_url TEXT,
+    error TEXT,
+    consecutive_failures INT NOT NULL DEFAULT 0,
+    checked_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_url_health_unhealthy ON url_health(url_id) WHERE NOT healthy;
+
+-- +goose Down
+DROP TABLE url_health;
@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE domains(
+    id SERIAL PRIMARY KEY,
+    hostname TEXT UNIQUE NOT NULL,
+    owner_id TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+CREATE INDEX idx_domains_owner_id ON domains(owner_id);
+
+-- NULL - домен по умолчанию из конфигурации
+ALTER TABLE urls ADD COLUMN domain TEXT REFERENCES domains(hostname);
+
+-- Короткий код уникален в пределах домена
+ALTER TABLE urls DROP CONSTRAINT urls_short_code_key;
+CREATE UNIQUE INDEX idx_urls_domain_short_code ON urls(COALESCE(domain, ''), short_code);
+
+-- +goose Down
+DROP INDEX idx_urls_domain_short_code;
+ALTER TABLE urls ADD CONSTRAINT urls_short_code_key UNIQUE (short_code);
+ALTER TABLE urls DROP COLUMN domain;
+DROP TABLE domains;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE domains ADD COLUMN fallback_mode TEXT NOT NULL DEFAULT 'page';
+ALTER TABLE domains ADD COLUMN fallback_url TEXT;
+ALTER TABLE domains ADD COLUMN fallback_template TEXT;
+
+-- +goose Down
+ALTER TABLE domains DROP COLUMN fallback_template;
+ALTER TABLE domains DROP COLUMN fallback_url;
+ALTER TABLE domains DROP COLUMN fallback_mode;
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE urls ADD COLUMN ios_deep_link TEXT;
+ALTER TABLE urls ADD COLUMN ios_store_url TEXT;
+ALTER TABLE urls ADD COLUMN android_deep_link TEXT;
+ALTER TABLE urls ADD COLUMN android_store_url TEXT;
+
+-- +goose Down
+ALTER TABLE urls DROP COLUMN android_store_url;
+ALTER TABLE urls DROP COLUMN android_deep_link;
+ALTER TABLE urls DROP COLUMN ios_store_url;
+ALTER TABLE urls DROP COLUMN ios_deep_link;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE urls ADD COLUMN query_passthrough TEXT NOT NULL DEFAULT 'ignore';
+ALTER TABLE urls ADD COLUMN path_passthrough BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE urls DROP COLUMN path_passthrough;
+ALTER TABLE urls DROP COLUMN query_passthrough;
@@ -0,0 +1,25 @@
+-- +goose Up
+ALTER TABLE urls ADD COLUMN active_from TIMESTAMP;
+ALTER TABLE urls ADD COLUMN active_until TIMESTAMP;
+ALTER TABLE urls ADD COLUMN pending_behavior TEXT NOT NULL DEFAULT 'not_found';
+ALTER TABLE urls ADD COLUMN expiry_notified BOOLEAN NOT NULL DEFAULT false;
+
+-- Поиск истекших ссылок, о которых еще не отправлено событие
+CREATE INDEX idx_urls_active_until ON urls(active_until) WHERE active_until IS NOT NULL AND NOT expiry_notified;
+
+CREATE TABLE url_schedule(
+    id SERIAL PRIMARY KEY,
+    url_id INTEGER NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    starts_at TIMESTAMP NOT NULL,
+    destination_url TEXT NOT NULL CHECK (destination_url LIKE 'http%'),
+    created_at TIMESTAMP DEFAULT now(),
+    UNIQUE (url_id, starts_at)
+);
+
+-- +goose Down
+DROP TABLE url_schedule;
+DROP INDEX idx_urls_active_until;
+ALTER TABLE urls DROP COLUMN expiry_notified;
+ALTER TABLE urls DROP COLUMN pending_behavior;
+ALTER TABLE urls DROP COLUMN active_until;
+ALTER TABLE urls DROP COLUMN active_from;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE alerts(
+    id SERIAL PRIMARY KEY,
+    url_id INTEGER NOT NULL REFERENCES urls(id),
+    owner_id TEXT NOT NULL DEFAULT '',
+    kind TEXT NOT NULL,
+    clicks INT NOT NULL,
+    baseline_mean DOUBLE PRECISION NOT NULL,
+    baseline_stddev DOUBLE PRECISION NOT NULL,
+    z_score DOUBLE PRECISION NOT NULL,
+    auto_disabled BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_alerts_owner_created_at ON alerts(owner_id, created_at DESC);
+CREATE INDEX idx_alerts_url_kind_created_at ON alerts(url_id, kind, created_at DESC);
+
+-- Подсчет кликов за последние окна для детектора аномалий
+CREATE INDEX idx_clicks_created_at ON clicks(created_at);
+
+-- +goose Down
+DROP INDEX idx_clicks_created_at;
+DROP TABLE alerts;
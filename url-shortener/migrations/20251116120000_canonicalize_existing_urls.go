@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"url-shortener/internal/service"
+)
+
+// canonicalizeExistingURLs пересчитывает каноническую форму ссылок, созданных до
+// появления канонизации. Миграция 20251103120000 записала им исходный адрес как есть,
+// поэтому новые ссылки на тот же адрес с ними не совпадали.
+func canonicalizeExistingURLs(canon service.Canonicalizer) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT id, original_url FROM urls WHERE canonical_url = original_url`)
+		if err != nil {
+			return fmt.Errorf("failed to list URLs: %w", err)
+		}
+
+		type row struct {
+			id          int
+			originalURL string
+		}
+		var pending []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.originalURL); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan URL: %w", err)
+			}
+			pending = append(pending, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, r := range pending {
+			canonicalURL, err := canon.Canonicalize(r.originalURL)
+			// Адрес, который канонизатор не принимает, остается в прежнем виде
+			if err != nil || canonicalURL == r.originalURL {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE urls SET canonical_url = $1, canonical_hash = $2 WHERE id = $3`,
+				canonicalURL, service.CanonicalHash(canonicalURL), r.id); err != nil {
+				return fmt.Errorf("failed to update URL %d: %w", r.id, err)
+			}
+		}
+
+		return nil
+	}
+}
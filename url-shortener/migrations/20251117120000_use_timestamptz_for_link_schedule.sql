@@ -0,0 +1,11 @@
+-- +goose Up
+-- Границы расписания сравниваются с моментами времени, поэтому хранятся с часовым поясом.
+-- Прежние значения записаны сервером, работающим в UTC.
+ALTER TABLE urls ALTER COLUMN active_from TYPE TIMESTAMPTZ USING active_from AT TIME ZONE 'UTC';
+ALTER TABLE urls ALTER COLUMN active_until TYPE TIMESTAMPTZ USING active_until AT TIME ZONE 'UTC';
+ALTER TABLE url_schedule ALTER COLUMN starts_at TYPE TIMESTAMPTZ USING starts_at AT TIME ZONE 'UTC';
+
+-- +goose Down
+ALTER TABLE url_schedule ALTER COLUMN starts_at TYPE TIMESTAMP USING starts_at AT TIME ZONE 'UTC';
+ALTER TABLE urls ALTER COLUMN active_until TYPE TIMESTAMP USING active_until AT TIME ZONE 'UTC';
+ALTER TABLE urls ALTER COLUMN active_from TYPE TIMESTAMP USING active_from AT TIME ZONE 'UTC';
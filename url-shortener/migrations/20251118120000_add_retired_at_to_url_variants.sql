@@ -0,0 +1,7 @@
+-- +goose Up
+-- Убранные из теста варианты не удаляются: прошлые клики сохраняют привязку к варианту
+ALTER TABLE url_variants ADD COLUMN retired_at TIMESTAMPTZ;
+
+-- +goose Down
+DELETE FROM url_variants WHERE retired_at IS NOT NULL;
+ALTER TABLE url_variants DROP COLUMN retired_at;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Заявка на домен до подтверждения владения записью TXT. Домен попадает в domains
+-- только после проверки, поэтому заявка не мешает настоящему владельцу.
+CREATE TABLE domain_claims(
+    id SERIAL PRIMARY KEY,
+    hostname TEXT NOT NULL,
+    owner_id TEXT NOT NULL,
+    token TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    UNIQUE (hostname, owner_id)
+);
+
+CREATE INDEX idx_domain_claims_owner_id ON domain_claims(owner_id);
+
+-- +goose Down
+DROP TABLE domain_claims;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Окно, в котором поднято оповещение: несколько экземпляров детектора не создают дубликатов
+ALTER TABLE alerts ADD COLUMN window_start TIMESTAMPTZ;
+UPDATE alerts SET window_start = created_at;
+ALTER TABLE alerts ALTER COLUMN window_start SET NOT NULL;
+
+CREATE UNIQUE INDEX idx_alerts_url_kind_window_start ON alerts(url_id, kind, window_start);
+DROP INDEX idx_alerts_url_kind_created_at;
+
+-- +goose Down
+CREATE INDEX idx_alerts_url_kind_created_at ON alerts(url_id, kind, created_at DESC);
+DROP INDEX idx_alerts_url_kind_window_start;
+ALTER TABLE alerts DROP COLUMN window_start;
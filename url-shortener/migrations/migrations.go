@@ -0,0 +1,24 @@
+// Package migrations встраивает SQL миграции схемы в бинарник и содержит миграции данных на Go
+package migrations
+
+import (
+	"embed"
+	"url-shortener/internal/migrate"
+	"url-shortener/internal/service"
+)
+
+// FS содержит файлы миграций в формате goose: <version>_<name>.sql с разделами Up и Down
+//
+//go:embed *.sql
+var FS embed.FS
+
+// Go возвращает миграции данных, которым нужен код сервиса
+func Go(canon service.Canonicalizer) []migrate.Migration {
+	return []migrate.Migration{
+		{
+			Version: 20251116120000,
+			Name:    "canonicalize_existing_urls",
+			UpFunc:  canonicalizeExistingURLs(canon),
+		},
+	}
+}